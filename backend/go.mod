@@ -3,7 +3,6 @@ module aprsmessenger-gateway
 go 1.24.0
 
 require (
-	github.com/dustin/go-aprs v0.0.0-20211010173338-0d55c6a34f67
 	github.com/gorilla/websocket v1.5.3
 	github.com/mattn/go-sqlite3 v1.14.28
 	golang.org/x/crypto v0.40.0
@@ -0,0 +1,109 @@
+package aprs
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+)
+
+// ackKey identifies the ack of one message: the station acking it, the
+// sender it acks and the message number.
+type ackKey struct {
+	from, to, msgNo string
+}
+
+// ackWatch remembers acks members' own stations sent, so the gateway does
+// not ack the same message on their behalf, and the acks the gateway sent,
+// so it does not mistake its own acks heard back for the member's.
+type ackWatch struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	station *expiringSet[ackKey, struct{}]
+	ours    *expiringSet[ackKey, struct{}]
+}
+
+func newAckWatch(now func() time.Time) *ackWatch {
+	return &ackWatch{
+		now:     now,
+		station: newExpiringSet[ackKey, struct{}](retryWindow[ackKey]),
+		ours:    newExpiringSet[ackKey, struct{}](retryWindow[ackKey]),
+	}
+}
+
+// retryWindow is how long a sender may retry a numbered message, and so how
+// long what we know about it stays useful.
+func retryWindow[K any](K) time.Duration {
+	return config.Get().Inbound.RetryWindow.D()
+}
+
+// heard records an ack seen from a member's station.
+func (w *ackWatch) heard(k ackKey) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	if w.ours.has(k, now) {
+		return
+	}
+	w.station.add(k, struct{}{}, now)
+}
+
+// claim reports whether the gateway may send ack k, and records that it did.
+// It refuses when the member's station already acked the message.
+func (w *ackWatch) claim(k ackKey) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	if w.station.has(k, now) {
+		return false
+	}
+	w.ours.add(k, struct{}{}, now)
+	return true
+}
+
+// clientAttached reports whether the member has the web app or an APRS app connected.
+func (am *APRSManager) clientAttached(base string) bool {
+	if session := GetSessionsManager().GetSession(base); session != nil && session.Attached() {
+		return true
+	}
+	return am.server != nil && am.server.Connected(base)
+}
+
+// ackReceived acks a numbered message received for a member, as their ack
+// policy allows. With an ack delay the ack waits, and is dropped if the
+// member's own station acks in the meantime.
+func (am *APRSManager) ackReceived(msg *MessagePacket, policy string) {
+	base := baseCallsign(toUpperNoSpace(msg.Addressee))
+	switch policy {
+	case db.AckNever:
+		return
+	case db.AckSession:
+		if !am.clientAttached(base) {
+			log.Printf("[APRS] Not acking %s from %s: %s has no client attached", msg.MsgNo, msg.Source, base)
+			return
+		}
+	}
+
+	key := ackKey{toUpperNoSpace(msg.Addressee), toUpperNoSpace(msg.Source), msg.MsgNo}
+	send := func() {
+		if !am.acks.claim(key) {
+			log.Printf("[APRS] Not acking %s from %s: %s already acked it", msg.MsgNo, msg.Source, msg.Addressee)
+			return
+		}
+		am.SendMessage(msg.Addressee, msg.Source, "ack"+msg.MsgNo)
+	}
+	delay := config.Get().Inbound.AckDelay.D()
+	if delay <= 0 {
+		send()
+		return
+	}
+	go func() {
+		select {
+		case <-am.clock.After(delay):
+			send()
+		case <-am.stopCh:
+		}
+	}()
+}
@@ -0,0 +1,32 @@
+package aprs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAckWatch tests that a member station's ack stops ours, and our own acks heard back do not
+func TestAckWatch(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := newAckWatch(func() time.Time { return now })
+
+	theirs := ackKey{"N0CALL-7", "W1AW", "01"}
+	w.heard(theirs)
+	if w.claim(theirs) {
+		t.Fatal("Claimed an ack the member's station already sent")
+	}
+
+	ours := ackKey{"N0CALL-7", "W1AW", "02"}
+	if !w.claim(ours) {
+		t.Fatal("Could not claim a fresh ack")
+	}
+	w.heard(ours) // Our own ack, digipeated back
+	if !w.claim(ours) {
+		t.Fatal("Our own ack heard back stopped a re-ack")
+	}
+
+	now = now.Add(31 * time.Minute)
+	if !w.claim(theirs) {
+		t.Fatal("A station ack past the retry window still stops ours")
+	}
+}
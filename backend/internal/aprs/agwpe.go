@@ -0,0 +1,228 @@
+package aprs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+)
+
+// agwHeaderLen is the fixed size of every AGWPE frame header.
+const agwHeaderLen = 36
+
+// AGWPE data kinds used by the gateway.
+const (
+	agwRegister    = 'X' // Register a callsign
+	agwToggleRaw   = 'k' // Toggle raw AX.25 monitoring ('K' frames)
+	agwToggleMon   = 'm' // Toggle text monitoring ('U' and friends)
+	agwUnproto     = 'M' // Send UI frame without digipeaters
+	agwUnprotoVia  = 'V' // Send UI frame via digipeaters
+	agwMonUnproto  = 'U' // Monitored UI frame, as text
+	agwRawFrame    = 'K' // Monitored frame, raw AX.25
+	agwMonitorRaw  = "raw"
+	agwMonitorText = "text"
+)
+
+// AGWFrame is one AGWPE API frame.
+type AGWFrame struct {
+	Port     int
+	DataKind byte
+	PID      byte
+	CallFrom string
+	CallTo   string
+	Data     []byte
+}
+
+// Encode serialises the frame with its 36-byte little-endian header.
+func (f *AGWFrame) Encode() []byte {
+	out := make([]byte, agwHeaderLen, agwHeaderLen+len(f.Data))
+	out[0] = byte(f.Port)
+	out[4] = f.DataKind
+	out[6] = f.PID
+	copy(out[8:18], f.CallFrom)
+	copy(out[18:28], f.CallTo)
+	binary.LittleEndian.PutUint32(out[28:32], uint32(len(f.Data)))
+	return append(out, f.Data...)
+}
+
+// agwMaxData bounds the data length we accept from the server.
+const agwMaxData = 64 * 1024
+
+// ReadAGWFrame reads one frame from r.
+func ReadAGWFrame(r io.Reader) (*AGWFrame, error) {
+	hdr := make([]byte, agwHeaderLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(hdr[28:32])
+	if n > agwMaxData {
+		return nil, fmt.Errorf("agwpe: data length %d too large", n)
+	}
+	f := &AGWFrame{
+		Port:     int(hdr[0]),
+		DataKind: hdr[4],
+		PID:      hdr[6],
+		CallFrom: agwCall(hdr[8:18]),
+		CallTo:   agwCall(hdr[18:28]),
+		Data:     make([]byte, n),
+	}
+	if _, err := io.ReadFull(r, f.Data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// agwCall extracts a NUL-padded callsign field.
+func agwCall(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// decodeAGWMonitor converts the text of a monitored 'U' frame into TNC2, e.g.
+// " 1:Fm N0CALL-9 To APRS Via WIDE1-1*,WIDE2-1 <UI pid=F0 Len=5 >[12:00:00]\rhello\r".
+func decodeAGWMonitor(data []byte) (string, error) {
+	text := string(bytes.TrimRight(data, "\x00"))
+	hdrEnd := strings.Index(text, "\r")
+	if hdrEnd < 0 {
+		return "", fmt.Errorf("agwpe: monitor frame has no info separator")
+	}
+	hdr, info := text[:hdrEnd], strings.TrimSuffix(text[hdrEnd+1:], "\r")
+	if i := strings.Index(hdr, "<"); i >= 0 {
+		hdr = hdr[:i]
+	}
+	if i := strings.Index(hdr, "Fm "); i >= 0 {
+		hdr = hdr[i:] // Drop the " 1:" port prefix
+	}
+	fields := strings.Fields(hdr)
+	var src, dst, via string
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "Fm":
+			src = fields[i+1]
+		case "To":
+			dst = fields[i+1]
+		case "Via":
+			via = fields[i+1]
+		}
+	}
+	if src == "" || dst == "" {
+		return "", fmt.Errorf("agwpe: monitor header %q missing Fm/To", hdr)
+	}
+	line := src + ">" + dst
+	if via != "" {
+		line += "," + via
+	}
+	return line + ":" + info, nil
+}
+
+// AGWPETransport is a PacketTransport for soundmodems that expose the AGWPE TCP API.
+type AGWPETransport struct {
+	link    *tncLink
+	port    int
+	monitor string // agwMonitorRaw or agwMonitorText
+}
+
+// NewAGWPETransport creates a transport for the AGWPE server at addr, radio port port.
+// monitor selects raw ('K') or text ('U') monitoring; empty means raw.
+func NewAGWPETransport(name, addr string, port int, monitor string) *AGWPETransport {
+	if monitor == "" {
+		monitor = agwMonitorRaw
+	}
+	return &AGWPETransport{link: newTNCLink(name, addr, "AGWPE"), port: port, monitor: monitor}
+}
+
+// Name returns the transport's name.
+func (t *AGWPETransport) Name() string { return t.link.name }
+
+// Kind reports that an AGWPE soundmodem is a radio link.
+func (t *AGWPETransport) Kind() TransportKind { return TransportRF }
+
+// State returns the TCP link state.
+func (t *AGWPETransport) State() TransportState { return t.link.snapshot() }
+
+// Run registers the gateway callsign, enables monitoring and decodes frames until stop is closed.
+func (t *AGWPETransport) Run(stop <-chan struct{}, host TransportHost) {
+	t.link.run(stop, host, t, func(conn net.Conn) error {
+		call := config.Get().Gateway.Callsign
+		toggle := byte(agwToggleRaw)
+		if t.monitor == agwMonitorText {
+			toggle = agwToggleMon
+		}
+		for _, f := range []*AGWFrame{
+			{Port: t.port, DataKind: agwRegister, CallFrom: call},
+			{Port: t.port, DataKind: toggle},
+		} {
+			if err := t.link.write(f.Encode()); err != nil {
+				return err
+			}
+		}
+
+		for {
+			f, err := ReadAGWFrame(conn)
+			if err != nil {
+				return err
+			}
+			if f.Port != t.port {
+				continue
+			}
+			var line string
+			switch {
+			case f.DataKind == agwRegister:
+				if len(f.Data) > 0 && f.Data[0] != 1 {
+					log.Printf("[AGWPE] %s: server refused to register %s", t.Name(), call)
+				}
+				continue
+			case f.DataKind == agwRawFrame && t.monitor == agwMonitorRaw && len(f.Data) > 1:
+				ax, derr := DecodeAX25(f.Data[1:]) // First byte is the KISS port/command byte
+				if derr != nil {
+					continue // Not a UI frame, or garbled
+				}
+				line = ax.TNC2()
+			case f.DataKind == agwMonUnproto && t.monitor == agwMonitorText:
+				line, err = decodeAGWMonitor(f.Data)
+				if err != nil {
+					log.Printf("[AGWPE] %s: %v", t.Name(), err)
+					continue
+				}
+			default:
+				continue
+			}
+			host.Receive(Frame{Line: line, Transport: t.Name(), Kind: TransportRF, Heard: time.Now()})
+		}
+	})
+}
+
+// Send transmits a TNC2 frame as an unproto 'M' frame, or 'V' when it has a via path.
+func (t *AGWPETransport) Send(tnc2 string) error {
+	ax, err := ParseTNC2(tnc2)
+	if err != nil {
+		return err
+	}
+	f := &AGWFrame{
+		Port:     t.port,
+		DataKind: agwUnproto,
+		PID:      ax25PIDNoL3,
+		CallFrom: ax.Src.String(),
+		CallTo:   ax.Dest.String(),
+		Data:     ax.Info,
+	}
+	if len(ax.Path) > 0 {
+		f.DataKind = agwUnprotoVia
+		data := []byte{byte(len(ax.Path))}
+		for _, d := range ax.Path {
+			field := make([]byte, 10)
+			copy(field, d.String())
+			data = append(data, field...)
+		}
+		f.Data = append(data, ax.Info...)
+	}
+	return t.link.write(f.Encode())
+}
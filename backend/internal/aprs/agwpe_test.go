@@ -0,0 +1,114 @@
+package aprs
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestAGWFrameHeader tests the 36-byte header layout
+func TestAGWFrameHeader(t *testing.T) {
+	f := &AGWFrame{Port: 1, DataKind: 'M', PID: 0xF0, CallFrom: "K8SDR-10", CallTo: "APRS", Data: []byte("hi")}
+	b := f.Encode()
+	if len(b) != agwHeaderLen+2 {
+		t.Fatalf("Expected %d bytes, got %d", agwHeaderLen+2, len(b))
+	}
+	if b[0] != 1 || b[4] != 'M' || b[6] != 0xF0 || b[28] != 2 || b[29] != 0 {
+		t.Fatalf("Header fields in wrong place: % x", b[:agwHeaderLen])
+	}
+	if !bytes.Equal(b[8:18], []byte("K8SDR-10\x00\x00")) || !bytes.Equal(b[18:22], []byte("APRS")) {
+		t.Fatalf("Callsign fields wrong: % x", b[8:28])
+	}
+	back, err := ReadAGWFrame(bytes.NewReader(b))
+	if err != nil || back.CallFrom != "K8SDR-10" || back.CallTo != "APRS" || string(back.Data) != "hi" {
+		t.Fatalf("Round trip failed: %+v %v", back, err)
+	}
+}
+
+// TestDecodeAGWMonitor tests conversion of monitored 'U' text into TNC2
+func TestDecodeAGWMonitor(t *testing.T) {
+	data := []byte(" 1:Fm N0CALL-9 To APRS Via WIDE1-1*,WIDE2-1 <UI pid=F0 Len=22 >[12:00:00]\r:K8SDR    :Hello{1\r\x00")
+	line, err := decodeAGWMonitor(data)
+	if err != nil {
+		t.Fatalf("decodeAGWMonitor: %v", err)
+	}
+	expected := "N0CALL-9>APRS,WIDE1-1*,WIDE2-1::K8SDR    :Hello{1"
+	if line != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, line)
+	}
+}
+
+// TestAGWPETransport tests registration, raw monitoring and unproto sends against a fake AGWPE server
+func TestAGWPETransport(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	inbound := "N0CALL-9>APRS,WIDE1-1*::K8SDR    :Hello{1"
+	got := make(chan *AGWFrame, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 3; i++ {
+			f, err := ReadAGWFrame(conn)
+			if err != nil {
+				return
+			}
+			got <- f
+			if f.DataKind == 'k' {
+				ax, _ := ParseTNC2(inbound)
+				raw := &AGWFrame{DataKind: 'K', Data: append([]byte{0}, ax.Encode()...)}
+				conn.Write(raw.Encode())
+			}
+		}
+	}()
+
+	tr := NewAGWPETransport("agw", ln.Addr().String(), 0, "")
+	host := &testHost{frames: make(chan Frame, 1)}
+	stop := make(chan struct{})
+	defer close(stop)
+	go tr.Run(stop, host)
+
+	expectKind := func(kind byte) *AGWFrame {
+		select {
+		case f := <-got:
+			if f.DataKind != kind {
+				t.Fatalf("Expected '%c' frame, got '%c'", kind, f.DataKind)
+			}
+			return f
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Fake AGWPE server got no '%c' frame", kind)
+		}
+		return nil
+	}
+	if reg := expectKind('X'); reg.CallFrom == "" {
+		t.Fatal("Register frame has no callsign")
+	}
+	expectKind('k')
+
+	select {
+	case f := <-host.frames:
+		if f.Line != inbound {
+			t.Fatalf("Expected '%s', got '%s'", inbound, f.Line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No frame decoded from fake AGWPE server")
+	}
+
+	if err := tr.Send("K8SDR-10>APRS,WIDE1-1,WIDE2-1::N0CALL   :ack1"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	v := expectKind('V')
+	if v.CallFrom != "K8SDR-10" || v.CallTo != "APRS" || v.Data[0] != 2 {
+		t.Fatalf("Bad 'V' frame: %+v", v)
+	}
+	if !bytes.Equal(v.Data[1:8], []byte("WIDE1-1")) || string(v.Data[21:]) != ":N0CALL   :ack1" {
+		t.Fatalf("Bad via list or info in 'V' frame: %q", v.Data)
+	}
+}
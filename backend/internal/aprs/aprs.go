@@ -5,58 +5,64 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 )
 
-// Connects to APRS-IS and returns the connection and a channel for incoming lines (authenticated version).
-func ConnectAndLogin(server, loginCallsign, passcode, filter string) (net.Conn, chan string, error) {
+// Software name and version sent in the APRS-IS login line.
+const (
+	softwareName    = "aprsmessenger-gateway"
+	softwareVersion = "1.0"
+)
+
+// isConn is a line-oriented APRS-IS client connection.
+type isConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	wmu  sync.Mutex
+}
+
+// dialAPRSIS connects to an APRS-IS server and sends the login line.
+// A passcode of "-1" logs in receive-only. An empty filter is omitted.
+func dialAPRSIS(server, login, passcode, filter string) (*isConn, error) {
 	conn, err := net.DialTimeout("tcp", server, 10*time.Second)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	c := &isConn{conn: conn, r: bufio.NewReader(conn)}
 
-	loginLine := fmt.Sprintf("user %s pass %s vers aprsmessenger-gateway 1.0 filter %s\r\n", loginCallsign, passcode, filter)
-	_, err = conn.Write([]byte(loginLine))
-	if err != nil {
+	loginLine := fmt.Sprintf("user %s pass %s vers %s %s", login, passcode, softwareName, softwareVersion)
+	if filter != "" {
+		loginLine += " filter " + filter
+	}
+	if err := c.writeLine(loginLine); err != nil {
 		conn.Close()
-		return nil, nil, err
+		return nil, err
 	}
-
-	lines := make(chan string)
-	go func() {
-		scanner := bufio.NewScanner(conn)
-		for scanner.Scan() {
-			lines <- scanner.Text()
-		}
-		close(lines)
-	}()
-	return conn, lines, nil
+	return c, nil
 }
 
-// Connects to APRS-IS in listen-only (no login required for read-only).
-// Returns the connection and a channel for incoming lines.
-func ConnectAndListen(server, callsign, filter string) (net.Conn, chan string, error) {
-	conn, err := net.DialTimeout("tcp", server, 10*time.Second)
+// readLine returns the next line from the server without its line ending.
+func (c *isConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
 	if err != nil {
-		return nil, nil, err
+		return "", err
 	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
 
-	loginLine := fmt.Sprintf("user %s pass -1 vers aprsmessenger-gateway-listener 1.0 filter %s\r\n", callsign, filter)
-	_, err = conn.Write([]byte(loginLine))
-	if err != nil {
-		conn.Close()
-		return nil, nil, err
-	}
+// writeLine sends one line, adding the CRLF APRS-IS expects.
+func (c *isConn) writeLine(line string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
 
-	lines := make(chan string)
-	go func() {
-		scanner := bufio.NewScanner(conn)
-		for scanner.Scan() {
-			lines <- scanner.Text()
-		}
-		close(lines)
-	}()
-	return conn, lines, nil
+// Close closes the underlying TCP connection.
+func (c *isConn) Close() error {
+	return c.conn.Close()
 }
 
 // ParseAPRSMessage parses an APRS-IS line for a message.
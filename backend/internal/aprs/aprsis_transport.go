@@ -0,0 +1,472 @@
+package aprs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+)
+
+// APRSISTransport is the PacketTransport for APRS-IS. It keeps one connection
+// per slice of the server-side filter, picks servers by health, and fails over
+// with backoff when a server refuses, drops or stalls.
+type APRSISTransport struct {
+	name    string
+	servers *serverPool
+	fixed   []string // Servers given at construction; nil follows the config
+	clock   Clock
+
+	mu      sync.Mutex
+	feeds   []*aprsisFeed // feeds[0] is the primary (sending) feed
+	filters []string
+	host    TransportHost
+	stop    <-chan struct{}
+}
+
+// APRSISDetail is the transport-specific part of an APRS-IS TransportState.
+type APRSISDetail struct {
+	Feeds   []FeedStatus   `json:"feeds"`
+	Servers []ServerHealth `json:"servers"`
+}
+
+// NewAPRSISTransport creates an APRS-IS transport using the configured login.
+// servers overrides the configured server list when non-empty, and clock
+// defaults to the system clock when nil.
+func NewAPRSISTransport(name string, servers []string, clock Clock) *APRSISTransport {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	t := &APRSISTransport{
+		name:    name,
+		servers: newServerPool(clock),
+		fixed:   append([]string(nil), servers...),
+		clock:   clock,
+		filters: []string{""},
+	}
+	t.servers.setServers(t.serverList())
+	return t
+}
+
+// serverList returns the servers to connect to, in order of preference.
+func (t *APRSISTransport) serverList() []string {
+	if len(t.fixed) > 0 {
+		return t.fixed
+	}
+	return config.Get().APRSIS.Servers
+}
+
+// Name returns the transport's name.
+func (t *APRSISTransport) Name() string { return t.name }
+
+// Kind reports that APRS-IS is the internet side.
+func (t *APRSISTransport) Kind() TransportKind { return TransportInternet }
+
+// Run starts one feed per filter and shuts them down when stop is closed.
+func (t *APRSISTransport) Run(stop <-chan struct{}, host TransportHost) {
+	t.mu.Lock()
+	t.host = host
+	t.stop = stop
+	for i, filter := range t.filters {
+		t.startFeedLocked(i, filter)
+	}
+	t.mu.Unlock()
+
+	<-stop
+
+	t.mu.Lock()
+	feeds := t.feeds
+	t.feeds = nil
+	t.mu.Unlock()
+	for _, f := range feeds {
+		f.stop()
+	}
+}
+
+func (t *APRSISTransport) startFeedLocked(index int, filter string) {
+	feed := newAPRSISFeed(index, filter, t.servers, t.clock, func() { t.host.StateChanged(t) })
+	t.feeds = append(t.feeds, feed)
+	go feed.run(func(line string) {
+		t.host.Receive(Frame{Line: line, Transport: t.name, Kind: TransportInternet, Heard: t.clock.Now()})
+	})
+}
+
+// SetFilters replaces the server-side filters, one per connection. Live
+// connections get a #filter command; connections are added or removed when
+// the number of filters changes.
+func (t *APRSISTransport) SetFilters(filters []string) {
+	if len(filters) == 0 {
+		filters = []string{""}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.filters = append([]string(nil), filters...)
+	if t.host == nil {
+		return // Not running yet; Run will use these
+	}
+	select {
+	case <-t.stop:
+		return // Stopped; no new connections
+	default:
+	}
+	for i, filter := range filters {
+		if i < len(t.feeds) {
+			t.feeds[i].setFilter(filter)
+			continue
+		}
+		t.startFeedLocked(i, filter)
+	}
+	for len(t.feeds) > len(filters) {
+		last := t.feeds[len(t.feeds)-1]
+		t.feeds = t.feeds[:len(t.feeds)-1]
+		go last.stop()
+	}
+	log.Printf("[APRS] %s: filter refreshed, %d connection(s)", t.name, len(t.feeds))
+}
+
+// Reconnect drops every connection so they log in again with current settings.
+// Call it after the server list or login changes.
+func (t *APRSISTransport) Reconnect(reason string) {
+	t.servers.setServers(t.serverList())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, f := range t.feeds {
+		f.drop(reason)
+	}
+}
+
+// Send writes a TNC2 packet on the primary connection.
+func (t *APRSISTransport) Send(tnc2 string) error {
+	t.mu.Lock()
+	var primary *aprsisFeed
+	if len(t.feeds) > 0 {
+		primary = t.feeds[0]
+	}
+	t.mu.Unlock()
+	if primary == nil {
+		return errConnectionInactive
+	}
+	return primary.send(tnc2)
+}
+
+// State reports the primary connection's state, with every feed and server in Detail.
+func (t *APRSISTransport) State() TransportState {
+	t.mu.Lock()
+	feeds := append([]*aprsisFeed(nil), t.feeds...)
+	t.mu.Unlock()
+
+	detail := APRSISDetail{Feeds: make([]FeedStatus, 0, len(feeds)), Servers: t.servers.snapshot()}
+	for _, f := range feeds {
+		detail.Feeds = append(detail.Feeds, f.snapshot())
+	}
+	st := TransportState{Name: t.name, Kind: TransportInternet, State: StateStopped, Detail: detail}
+	if len(detail.Feeds) > 0 {
+		primary := detail.Feeds[0]
+		st.State, st.Reason, st.Since = primary.State, primary.Reason, primary.Since
+	}
+	return st
+}
+
+// FeedStatus is a snapshot of one APRS-IS connection.
+type FeedStatus struct {
+	Index      int       `json:"index"`
+	State      string    `json:"state"`
+	Reason     string    `json:"reason,omitempty"`
+	Server     string    `json:"server,omitempty"`
+	ServerName string    `json:"server_name,omitempty"` // From the server's # logresp
+	Verified   bool      `json:"verified"`
+	Filter     string    `json:"filter"`
+	Since      time.Time `json:"since"`
+	LastHeard  time.Time `json:"last_heard,omitempty"`
+}
+
+// aprsisFeed is one APRS-IS connection carrying one slice of the server-side filter.
+// Feed 0 is the primary feed: it logs in with the gateway passcode and carries all
+// outgoing traffic. Extra feeds only exist when the filter is too long for one
+// login and connect receive-only.
+type aprsisFeed struct {
+	index    int
+	pool     *serverPool
+	clock    Clock
+	onChange func() // Called after every state change
+	stopCh   chan struct{}
+
+	mu         sync.RWMutex
+	conn       *isConn
+	filter     string
+	status     FeedStatus
+	logresp    bool   // Server answered our login
+	dropReason string // Set by whoever closed the connection on purpose
+}
+
+func newAPRSISFeed(index int, filter string, pool *serverPool, clock Clock, onChange func()) *aprsisFeed {
+	return &aprsisFeed{
+		index:    index,
+		pool:     pool,
+		clock:    clock,
+		onChange: onChange,
+		filter:   filter,
+		stopCh:   make(chan struct{}),
+		status:   FeedStatus{Index: index, State: StateConnecting, Since: clock.Now()},
+	}
+}
+
+// stopped reports whether the feed has been asked to shut down.
+func (f *aprsisFeed) stopped() bool {
+	select {
+	case <-f.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop shuts the feed down and closes its connection.
+func (f *aprsisFeed) stop() {
+	close(f.stopCh)
+	f.drop("feed removed")
+}
+
+// drop closes the current connection, if any, so run() reconnects.
+// reason is reported as the cause of the disconnect.
+func (f *aprsisFeed) drop(reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conn != nil {
+		if f.dropReason == "" {
+			f.dropReason = reason
+		}
+		f.conn.Close()
+	}
+}
+
+// setState records a state transition and notifies the transport.
+func (f *aprsisFeed) setState(state, reason, server string) {
+	f.mu.Lock()
+	f.status.State = state
+	f.status.Reason = reason
+	f.status.Server = server
+	f.status.Since = f.clock.Now()
+	if state != StateConnected {
+		f.status.ServerName = ""
+		f.status.Verified = false
+	}
+	f.mu.Unlock()
+	f.onChange()
+}
+
+// snapshot returns the feed's current status.
+func (f *aprsisFeed) snapshot() FeedStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	st := f.status
+	st.Filter = f.filter
+	return st
+}
+
+// setFilter updates the filter and pushes it to the live connection with #filter.
+func (f *aprsisFeed) setFilter(filter string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.filter == filter {
+		return
+	}
+	f.filter = filter
+	if f.conn != nil {
+		log.Printf("[APRS] Feed %d: updating filter to %q", f.index, filter)
+		if err := f.conn.writeLine("#filter " + filter); err != nil {
+			log.Printf("[APRS] Feed %d: failed to send #filter: %v", f.index, err)
+		}
+	}
+}
+
+// send writes a raw packet on the feed's connection.
+func (f *aprsisFeed) send(packet string) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.conn == nil {
+		return errConnectionInactive
+	}
+	return f.conn.writeLine(packet)
+}
+
+// heard marks the feed as alive; any frame or # line counts.
+func (f *aprsisFeed) heard() {
+	f.mu.Lock()
+	f.status.LastHeard = f.clock.Now()
+	f.mu.Unlock()
+}
+
+// serverComment handles "# logresp CALL verified, server NAME" and keepalive comments.
+// expects says whether we logged in with a passcode and should be verified.
+func (f *aprsisFeed) serverComment(line, server string, expects bool) {
+	fields := strings.Fields(strings.TrimPrefix(line, "#"))
+	if len(fields) < 3 || fields[0] != "logresp" {
+		return
+	}
+	verified := strings.TrimSuffix(fields[2], ",") == "verified"
+	f.mu.Lock()
+	f.logresp = true
+	f.status.Verified = verified
+	if len(fields) >= 5 && fields[3] == "server" {
+		f.status.ServerName = fields[4]
+	}
+	f.mu.Unlock()
+	if expects && !verified {
+		log.Printf("[APRS] Feed %d: %s rejected our passcode: %s", f.index, server, line)
+		f.pool.authFailed(server, "login unverified")
+		f.drop("login unverified")
+		return
+	}
+	f.onChange()
+}
+
+// feedLogin returns the callsign feed index logs in as. APRS-IS drops the
+// older of two logins with the same callsign, so extra feeds log in as the
+// base callsign with an SSID of their own: F1, F2 and so on.
+func feedLogin(callsign string, index int) string {
+	if index == 0 {
+		return callsign
+	}
+	return fmt.Sprintf("%s-F%d", strings.Split(callsign, "-")[0], index)
+}
+
+// run connects, logs in with the feed's filter and hands every line to handle
+// until the feed is stopped. Servers are chosen by health, reconnects back off
+// exponentially, and a stalled or unanswered login triggers failover.
+func (f *aprsisFeed) run(handle func(line string)) {
+	cfg := config.Get()
+	bo := &backoff{min: cfg.APRSIS.BackoffMin.D(), max: cfg.APRSIS.BackoffMax.D()}
+	for !f.stopped() {
+		cfg = config.Get()
+		bo.min, bo.max = cfg.APRSIS.BackoffMin.D(), cfg.APRSIS.BackoffMax.D()
+		login := feedLogin(cfg.Gateway.Callsign, f.index)
+		passcode := loginPasscode(cfg.Gateway)
+		if f.index > 0 {
+			passcode = "-1"
+		}
+		server := f.pool.pick()
+
+		f.setState(StateConnecting, "", server)
+		log.Printf("[APRS] Feed %d: connecting to APRS-IS %s as %s", f.index, server, login)
+
+		f.mu.RLock()
+		filter := f.filter
+		f.mu.RUnlock()
+		conn, err := dialAPRSIS(server, login, passcode, filter)
+		if err != nil {
+			f.pool.connectFailed(server, err)
+			f.wait(bo, fmt.Sprintf("connect to %s failed: %v", server, err), server)
+			continue
+		}
+
+		f.mu.Lock()
+		if f.stopped() {
+			f.mu.Unlock()
+			conn.Close()
+			break
+		}
+		f.conn = conn
+		f.logresp = false
+		f.dropReason = ""
+		f.status.LastHeard = f.clock.Now()
+		// The filter may have changed while we were logging in.
+		if f.filter != filter {
+			_ = conn.writeLine("#filter " + f.filter)
+		}
+		f.mu.Unlock()
+
+		connectedAt := f.clock.Now()
+		f.pool.connected(server)
+		f.setState(StateConnected, "", server)
+		log.Printf("[APRS] Feed %d: connected to %s as %s with filter %q", f.index, server, login, filter)
+
+		done := make(chan struct{})
+		f.watchdog(server, connectedAt, cfg.APRSIS.LoginTimeout.D(), cfg.APRSIS.StallTimeout.D(), done)
+		for {
+			line, err := conn.readLine()
+			if err != nil {
+				log.Printf("[APRS] Feed %d: error from APRS-IS: %v", f.index, err)
+				break
+			}
+			f.heard()
+			if strings.HasPrefix(line, "#") {
+				f.serverComment(line, server, passcode != "-1")
+				continue
+			}
+			if line != "" {
+				handle(line)
+			}
+		}
+		close(done)
+
+		f.mu.Lock()
+		f.conn.Close()
+		f.conn = nil
+		reason := f.dropReason
+		f.mu.Unlock()
+		if reason == "" {
+			reason = fmt.Sprintf("disconnected from %s", server)
+		}
+		if f.clock.Now().Sub(connectedAt) >= stableConnection {
+			bo.reset()
+		}
+		if f.stopped() {
+			break
+		}
+		f.wait(bo, reason, server)
+	}
+	f.setState(StateStopped, "", "")
+	log.Printf("[APRS] Feed %d stopped", f.index)
+}
+
+// watchdog closes the connection if the server never answers the login or the
+// feed goes quiet for longer than stall, counting it against the server. It
+// checks on f.clock, and arms the first check before it returns.
+func (f *aprsisFeed) watchdog(server string, connectedAt time.Time, loginTimeout, stall time.Duration, done <-chan struct{}) {
+	tick := stall / 6
+	if tick > 5*time.Second {
+		tick = 5 * time.Second
+	}
+	wake := f.clock.After(tick)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-wake:
+			}
+			f.mu.RLock()
+			gotLogresp := f.logresp
+			lastHeard := f.status.LastHeard
+			f.mu.RUnlock()
+
+			if !gotLogresp && f.clock.Now().Sub(connectedAt) > loginTimeout {
+				log.Printf("[APRS] Feed %d: no logresp from %s within %s, failing over", f.index, server, loginTimeout)
+				f.pool.authFailed(server, "no login response")
+				f.drop("no login response")
+				return
+			}
+			if f.clock.Now().Sub(lastHeard) > stall {
+				log.Printf("[APRS] Feed %d: nothing heard from %s for %s, failing over", f.index, server, stall)
+				f.pool.idleTimeout(server)
+				f.drop(fmt.Sprintf("feed stalled for %s", stall))
+				return
+			}
+			wake = f.clock.After(tick)
+		}
+	}()
+}
+
+// wait reports the backoff state and sleeps for the next backoff delay or until stopped.
+func (f *aprsisFeed) wait(bo *backoff, reason, server string) {
+	d := bo.next()
+	log.Printf("[APRS] Feed %d: %s. Retrying in %s.", f.index, reason, d.Round(time.Second))
+	f.setState(StateBackoff, reason, server)
+	select {
+	case <-f.clock.After(d):
+	case <-f.stopCh:
+	}
+}
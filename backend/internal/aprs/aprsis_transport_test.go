@@ -0,0 +1,144 @@
+package aprs
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprstest"
+	"aprsmessenger-gateway/internal/config"
+)
+
+// TestAPRSISFeedLogins tests that each filter feed logs in under a callsign of its own
+func TestAPRSISFeedLogins(t *testing.T) {
+	srv := aprstest.NewServer(t)
+	tr := NewAPRSISTransport("aprsis", []string{srv.Addr()}, nil)
+	tr.SetFilters([]string{"b/N0AAA", "b/N0BBB"})
+	stop := make(chan struct{})
+	defer close(stop)
+	go tr.Run(stop, &testHost{frames: make(chan Frame, 16)})
+
+	logins := map[string]aprstest.Login{}
+	for i := 0; i < 2; i++ {
+		l := srv.WaitLogin(t, 2*time.Second)
+		logins[l.Filter] = l
+	}
+	primary, extra := logins["b/N0AAA"], logins["b/N0BBB"]
+	if call := config.Get().Gateway.Callsign; primary.Callsign != call {
+		t.Fatalf("Expected '%s', got '%s'", call, primary.Callsign)
+	}
+	if want := strings.Split(config.Get().Gateway.Callsign, "-")[0] + "-F1"; extra.Callsign != want || extra.Passcode != "-1" {
+		t.Fatalf("Expected '%s', got '%s'", want+" -1", extra.Callsign+" "+extra.Passcode)
+	}
+	if extra.Callsign == primary.Callsign {
+		t.Fatalf("Expected the feeds to log in as different callsigns, both used '%s'", extra.Callsign)
+	}
+}
+
+// TestAPRSISSetFiltersAfterStop tests that a stopped transport opens no new connections
+func TestAPRSISSetFiltersAfterStop(t *testing.T) {
+	srv := aprstest.NewServer(t)
+	tr := NewAPRSISTransport("aprsis", []string{srv.Addr()}, nil)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		tr.Run(stop, &testHost{frames: make(chan Frame, 16)})
+		close(done)
+	}()
+	srv.WaitLogin(t, 2*time.Second)
+	close(stop)
+	<-done
+
+	tr.SetFilters([]string{"b/N0AAA", "b/N0BBB"})
+	srv.ExpectNoLogin(t, 200*time.Millisecond)
+	if st := tr.State(); len(st.Detail.(APRSISDetail).Feeds) != 0 {
+		t.Fatalf("Expected no feeds after stop, got %d", len(st.Detail.(APRSISDetail).Feeds))
+	}
+}
+
+// waitFeedVerified waits until the primary feed has its logresp.
+func waitFeedVerified(t *testing.T, tr *APRSISTransport) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if feeds := tr.State().Detail.(APRSISDetail).Feeds; len(feeds) > 0 && feeds[0].Verified {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Feed never verified")
+}
+
+// serverHealth returns the transport's health record for addr.
+func serverHealth(tr *APRSISTransport, addr string) ServerHealth {
+	for _, h := range tr.State().Detail.(APRSISDetail).Servers {
+		if h.Addr == addr {
+			return h
+		}
+	}
+	return ServerHealth{}
+}
+
+// TestAPRSISStallFailover tests that a server that goes quiet is dropped for the next one
+func TestAPRSISStallFailover(t *testing.T) {
+	quiet, backup := aprstest.NewServer(t), aprstest.NewServer(t)
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	tr := NewAPRSISTransport("aprsis", []string{quiet.Addr(), backup.Addr()}, clock)
+	stop := make(chan struct{})
+	defer close(stop)
+	go tr.Run(stop, &testHost{frames: make(chan Frame, 16)})
+
+	quiet.WaitLogin(t, 2*time.Second)
+	waitFeedVerified(t, tr)
+	cfg := config.Get().APRSIS
+	clock.Advance(cfg.StallTimeout.D() + 5*time.Second)
+	if !clock.BlockUntil(1, 2*time.Second) {
+		t.Fatal("Feed did not back off after the stall")
+	}
+	clock.Advance(cfg.BackoffMin.D())
+
+	backup.WaitLogin(t, 2*time.Second)
+	if h := serverHealth(tr, quiet.Addr()); h.IdleTimeouts != 1 || h.AuthFailures != 0 {
+		t.Fatalf("Expected one idle timeout for the quiet server, got %+v", h)
+	}
+}
+
+// TestAPRSISLoginTimeoutFailover tests that a server that never answers the login is dropped for the next one
+func TestAPRSISLoginTimeoutFailover(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close() // Held open, never answered
+		}
+	}()
+	backup := aprstest.NewServer(t)
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	tr := NewAPRSISTransport("aprsis", []string{ln.Addr().String(), backup.Addr()}, clock)
+	stop := make(chan struct{})
+	defer close(stop)
+	go tr.Run(stop, &testHost{frames: make(chan Frame, 16)})
+
+	// The watchdog's first check is armed once the connection is up.
+	if !clock.BlockUntil(1, 2*time.Second) {
+		t.Fatal("Feed never connected to the silent server")
+	}
+	cfg := config.Get().APRSIS
+	clock.Advance(cfg.LoginTimeout.D() + 5*time.Second)
+	if !clock.BlockUntil(1, 2*time.Second) {
+		t.Fatal("Feed did not back off after the login timeout")
+	}
+	clock.Advance(cfg.BackoffMin.D())
+
+	backup.WaitLogin(t, 2*time.Second)
+	if h := serverHealth(tr, ln.Addr().String()); h.AuthFailures != 1 || h.LastError != "no login response" {
+		t.Fatalf("Expected one login failure for the silent server, got %+v", h)
+	}
+}
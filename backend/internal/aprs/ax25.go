@@ -0,0 +1,226 @@
+package aprs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AX.25 UI frame constants used by APRS.
+const (
+	ax25ControlUI = 0x03
+	ax25PIDNoL3   = 0xF0
+	ax25AddrLen   = 7
+	ax25MaxDigis  = 8
+)
+
+// AX25Address is one callsign-SSID field of an AX.25 header.
+// H is the "has been repeated" bit for digipeaters; for the destination and
+// source it carries the command/response bit.
+type AX25Address struct {
+	Call string
+	SSID int
+	H    bool
+}
+
+// String renders the address in TNC2 form, omitting a zero SSID.
+func (a AX25Address) String() string {
+	if a.SSID == 0 {
+		return a.Call
+	}
+	return fmt.Sprintf("%s-%d", a.Call, a.SSID)
+}
+
+// ParseAX25Address parses "CALL" or "CALL-SSID" (without any trailing '*').
+func ParseAX25Address(s string) (AX25Address, error) {
+	call, ssidStr, hasSSID := strings.Cut(strings.ToUpper(s), "-")
+	if len(call) == 0 || len(call) > 6 {
+		return AX25Address{}, fmt.Errorf("ax25: callsign %q must be 1-6 characters", s)
+	}
+	for _, c := range call {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return AX25Address{}, fmt.Errorf("ax25: callsign %q has invalid character %q", s, c)
+		}
+	}
+	ssid := 0
+	if hasSSID {
+		n, err := strconv.Atoi(ssidStr)
+		if err != nil || n < 0 || n > 15 {
+			return AX25Address{}, fmt.Errorf("ax25: SSID in %q must be 0-15", s)
+		}
+		ssid = n
+	}
+	return AX25Address{Call: call, SSID: ssid}, nil
+}
+
+// AX25Frame is a decoded AX.25 UI frame.
+type AX25Frame struct {
+	Dest    AX25Address
+	Src     AX25Address
+	Path    []AX25Address // Digipeaters, in order
+	Control byte
+	PID     byte
+	Info    []byte
+}
+
+// encodeAX25Address writes the 7-byte shifted address field.
+func encodeAX25Address(a AX25Address, last bool) []byte {
+	out := make([]byte, ax25AddrLen)
+	call := fmt.Sprintf("%-6s", a.Call)
+	for i := 0; i < 6; i++ {
+		out[i] = call[i] << 1
+	}
+	ssid := byte(0x60) | byte(a.SSID&0x0F)<<1 // Reserved bits set, as most TNCs do
+	if a.H {
+		ssid |= 0x80
+	}
+	if last {
+		ssid |= 0x01
+	}
+	out[6] = ssid
+	return out
+}
+
+// decodeAX25Address reads one 7-byte address field and reports whether it ends the header.
+func decodeAX25Address(b []byte) (AX25Address, bool, error) {
+	var call []byte
+	for i := 0; i < 6; i++ {
+		if b[i]&0x01 != 0 {
+			return AX25Address{}, false, fmt.Errorf("ax25: address extension bit set inside callsign")
+		}
+		c := b[i] >> 1
+		if c != ' ' {
+			call = append(call, c)
+		}
+	}
+	ssid := b[6]
+	a := AX25Address{
+		Call: string(call),
+		SSID: int(ssid>>1) & 0x0F,
+		H:    ssid&0x80 != 0,
+	}
+	if a.Call == "" {
+		return AX25Address{}, false, fmt.Errorf("ax25: empty callsign")
+	}
+	return a, ssid&0x01 != 0, nil
+}
+
+// Encode serialises the frame (without FCS, as KISS and AGWPE expect).
+func (f *AX25Frame) Encode() []byte {
+	out := make([]byte, 0, ax25AddrLen*(2+len(f.Path))+2+len(f.Info))
+	out = append(out, encodeAX25Address(f.Dest, false)...)
+	out = append(out, encodeAX25Address(f.Src, len(f.Path) == 0)...)
+	for i, d := range f.Path {
+		out = append(out, encodeAX25Address(d, i == len(f.Path)-1)...)
+	}
+	out = append(out, f.Control, f.PID)
+	return append(out, f.Info...)
+}
+
+// DecodeAX25 parses a raw AX.25 frame (without FCS).
+// Only UI frames are accepted, since that is all APRS uses.
+func DecodeAX25(b []byte) (*AX25Frame, error) {
+	f := &AX25Frame{}
+	var addrs []AX25Address
+	off := 0
+	for {
+		if off+ax25AddrLen > len(b) {
+			return nil, fmt.Errorf("ax25: truncated address field")
+		}
+		a, last, err := decodeAX25Address(b[off : off+ax25AddrLen])
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+		off += ax25AddrLen
+		if last {
+			break
+		}
+		if len(addrs) > 2+ax25MaxDigis {
+			return nil, fmt.Errorf("ax25: more than %d digipeaters", ax25MaxDigis)
+		}
+	}
+	if len(addrs) < 2 {
+		return nil, fmt.Errorf("ax25: missing source address")
+	}
+	if off+2 > len(b) {
+		return nil, fmt.Errorf("ax25: missing control and PID")
+	}
+	f.Dest, f.Src, f.Path = addrs[0], addrs[1], addrs[2:]
+	f.Control, f.PID = b[off], b[off+1]
+	if f.Control&^0x10 != ax25ControlUI { // Ignore the poll/final bit
+		return nil, fmt.Errorf("ax25: not a UI frame (control 0x%02x)", f.Control)
+	}
+	f.Info = append([]byte(nil), b[off+2:]...)
+	return f, nil
+}
+
+// TNC2 renders the frame as SRC>DST,PATH:info. The last digipeater with the
+// H-bit set is marked with '*'.
+func (f *AX25Frame) TNC2() string {
+	var sb strings.Builder
+	sb.WriteString(f.Src.String())
+	sb.WriteByte('>')
+	sb.WriteString(f.Dest.String())
+	lastUsed := -1
+	for i, d := range f.Path {
+		if d.H {
+			lastUsed = i
+		}
+	}
+	for i, d := range f.Path {
+		sb.WriteByte(',')
+		sb.WriteString(d.String())
+		if i == lastUsed {
+			sb.WriteByte('*')
+		}
+	}
+	sb.WriteByte(':')
+	sb.Write(f.Info)
+	return sb.String()
+}
+
+// ParseTNC2 builds a UI frame from SRC>DST,PATH:info. Every digipeater up to
+// and including the one marked '*' gets its H-bit set. Addresses that cannot
+// go on RF (over six characters, bad SSIDs) are rejected.
+func ParseTNC2(line string) (*AX25Frame, error) {
+	header, info, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil, fmt.Errorf("ax25: no info field in %q", line)
+	}
+	src, rest, ok := strings.Cut(header, ">")
+	if !ok {
+		return nil, fmt.Errorf("ax25: no destination in %q", line)
+	}
+	fields := strings.Split(rest, ",")
+	if len(fields)-1 > ax25MaxDigis {
+		return nil, fmt.Errorf("ax25: more than %d digipeaters", ax25MaxDigis)
+	}
+
+	f := &AX25Frame{Control: ax25ControlUI, PID: ax25PIDNoL3, Info: []byte(info)}
+	var err error
+	if f.Src, err = ParseAX25Address(src); err != nil {
+		return nil, err
+	}
+	if f.Dest, err = ParseAX25Address(fields[0]); err != nil {
+		return nil, err
+	}
+	// Command frame: C-bit set in the destination, clear in the source.
+	f.Dest.H = true
+
+	lastUsed := -1
+	for i, d := range fields[1:] {
+		if strings.HasSuffix(d, "*") {
+			lastUsed = i
+		}
+	}
+	for i, d := range fields[1:] {
+		a, err := ParseAX25Address(strings.TrimSuffix(d, "*"))
+		if err != nil {
+			return nil, err
+		}
+		a.H = i <= lastUsed
+		f.Path = append(f.Path, a)
+	}
+	return f, nil
+}
@@ -0,0 +1,60 @@
+package aprs
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestAX25RoundTrip tests that TNC2 survives conversion to AX.25 and back
+func TestAX25RoundTrip(t *testing.T) {
+	lines := []string{
+		"N0CALL-9>APRS,WIDE1-1,WIDE2-2::K8SDR    :Hello there{12}",
+		"N0CALL>APDW16,K8SDR-1*,WIDE2-1:!4237.14N/07120.83W#PHG7140",
+		"W1AW-15>APRS,RELAY,WIDE*,WIDE2-1:>status",
+		"AB1CD>ID:N0CALL",
+	}
+	for _, line := range lines {
+		f, err := ParseTNC2(line)
+		if err != nil {
+			t.Fatalf("ParseTNC2(%q): %v", line, err)
+		}
+		decoded, err := DecodeAX25(f.Encode())
+		if err != nil {
+			t.Fatalf("DecodeAX25 for %q: %v", line, err)
+		}
+		if got := decoded.TNC2(); got != line {
+			t.Fatalf("Expected '%s', got '%s'", line, got)
+		}
+	}
+}
+
+// TestAX25AddressEncoding tests address shifting, SSID and the H-bit against known bytes
+func TestAX25AddressEncoding(t *testing.T) {
+	f, err := ParseTNC2("N0CALL-7>APRS,WIDE1-1*:>x")
+	if err != nil {
+		t.Fatalf("ParseTNC2: %v", err)
+	}
+	expected := []byte{
+		'A' << 1, 'P' << 1, 'R' << 1, 'S' << 1, ' ' << 1, ' ' << 1, 0xE0, // Dest, C-bit set
+		'N' << 1, '0' << 1, 'C' << 1, 'A' << 1, 'L' << 1, 'L' << 1, 0x6E, // Src, SSID 7
+		'W' << 1, 'I' << 1, 'D' << 1, 'E' << 1, '1' << 1, ' ' << 1, 0xE3, // Digi, SSID 1, H-bit, last
+		0x03, 0xF0, '>', 'x',
+	}
+	if got := f.Encode(); !bytes.Equal(got, expected) {
+		t.Fatalf("Expected % x, got % x", expected, got)
+	}
+}
+
+// TestParseTNC2Rejects tests that addresses that cannot go on RF are rejected
+func TestParseTNC2Rejects(t *testing.T) {
+	for _, line := range []string{
+		"TOOLONGCALL>APRS::X:y",
+		"N0CALL-16>APRS::X:y",
+		"N0CALL>APRS,qAC,T2TEST-ABC:x",
+		"N0CALL>APRS",
+	} {
+		if _, err := ParseTNC2(line); err == nil {
+			t.Fatalf("Expected error for %q", line)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package aprs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds of BuildError, for use with errors.Is.
+var (
+	ErrBadCallsign   = errors.New("not a valid callsign")
+	ErrBadAddressee  = errors.New("addressee must be 1-9 letters, digits or dashes")
+	ErrBadPath       = errors.New("not a valid path")
+	ErrTooLong       = errors.New("too long")
+	ErrEmptyPayload  = errors.New("payload is empty")
+	ErrForbiddenChar = errors.New("contains a forbidden character")
+)
+
+// BuildError reports which part of a packet could not be built and why.
+type BuildError struct {
+	Kind  error  // One of the Err* values above
+	Field string // "source", "tocall", "path", "addressee" or "payload"
+	Value string
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("%s %q: %v", e.Field, e.Value, e.Kind)
+}
+
+func (e *BuildError) Unwrap() error { return e.Kind }
+
+// Limits from the APRS 1.01 spec and APRS-IS.
+const (
+	maxMessageText = 67  // Message text, not counting the {msgno}
+	maxInfoLength  = 256 // Information field of a non-message packet
+	maxRFPath      = 8   // AX.25 digipeaters
+	maxISCallsign  = 9   // APRS-IS allows longer, non-AX.25 callsigns
+)
+
+// PacketSpec is an outbound packet before it is rendered to TNC2.
+type PacketSpec struct {
+	Source    string
+	ToCall    string   // Destination field, normally the software ID
+	Path      []string // Empty means TCPIP* on APRS-IS and no digipeaters on RF
+	Addressee string   // Set for messages; Payload is then the message body
+	Payload   string   // Message body (text{msgno}, ackNN, ...), or the whole info field
+}
+
+// BuildPacket validates spec and renders it as TNC2 for the given transport
+// kind. APRS-IS packets must not carry q-constructs, which only servers add.
+func BuildPacket(spec PacketSpec, kind TransportKind) (string, error) {
+	src, err := checkCallsign("source", spec.Source, kind)
+	if err != nil {
+		return "", err
+	}
+	tocall, err := checkCallsign("tocall", spec.ToCall, kind)
+	if err != nil {
+		return "", err
+	}
+	path, err := checkPath(spec.Path, kind)
+	if err != nil {
+		return "", err
+	}
+	info, err := buildInfo(spec.Addressee, spec.Payload)
+	if err != nil {
+		return "", err
+	}
+	return src + ">" + strings.Join(append([]string{tocall}, path...), ",") + ":" + info, nil
+}
+
+// WrapThirdParty wraps a packet originated on behalf of another station as a
+// third-party packet from the gateway: GATEWAY>TOCALL,PATH:}SRC>DST,TCPIP,GATEWAY*:info.
+// Use it when the packet's source is not the callsign we are logged in or
+// transmitting as.
+func WrapThirdParty(gateway, tocall string, path []string, inner string, kind TransportKind) (string, error) {
+	src, dst, _, info, ok := splitTNC2(inner)
+	if !ok {
+		return "", &BuildError{Kind: ErrEmptyPayload, Field: "payload", Value: inner}
+	}
+	gw, err := checkCallsign("source", gateway, kind)
+	if err != nil {
+		return "", err
+	}
+	// The inner header is only ever read by APRS software, so only APRS-IS rules apply.
+	if _, err := checkCallsign("source", src, TransportInternet); err != nil {
+		return "", err
+	}
+	wrapped := "}" + strings.ToUpper(src) + ">" + strings.ToUpper(dst) + ",TCPIP," + gw + "*:" + info
+	return BuildPacket(PacketSpec{Source: gw, ToCall: tocall, Path: path, Payload: wrapped}, kind)
+}
+
+// checkCallsign validates a source or destination callsign: AX.25 rules on RF,
+// up to nine letters, digits and dashes on APRS-IS.
+func checkCallsign(field, cs string, kind TransportKind) (string, error) {
+	cs = strings.ToUpper(strings.TrimSpace(cs))
+	if kind == TransportRF {
+		addr, err := ParseAX25Address(cs)
+		if err != nil {
+			return "", &BuildError{Kind: ErrBadCallsign, Field: field, Value: cs}
+		}
+		return addr.String(), nil
+	}
+	if cs == "" || len(cs) > maxISCallsign || !isCallsignChars(cs) || strings.HasPrefix(cs, "-") || strings.HasSuffix(cs, "-") {
+		return "", &BuildError{Kind: ErrBadCallsign, Field: field, Value: cs}
+	}
+	return cs, nil
+}
+
+func isCallsignChars(s string) bool {
+	for _, c := range s {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPath validates the path and fills in the default for APRS-IS.
+func checkPath(path []string, kind TransportKind) ([]string, error) {
+	if kind == TransportInternet {
+		if len(path) == 0 {
+			return []string{"TCPIP*"}, nil
+		}
+		for _, hop := range path {
+			base := strings.TrimSuffix(hop, "*")
+			if strings.HasPrefix(base, "q") || base == "" || !isCallsignChars(strings.ToUpper(base)) {
+				return nil, &BuildError{Kind: ErrBadPath, Field: "path", Value: strings.Join(path, ",")}
+			}
+		}
+		return path, nil
+	}
+	if len(path) > maxRFPath {
+		return nil, &BuildError{Kind: ErrTooLong, Field: "path", Value: strings.Join(path, ",")}
+	}
+	out := make([]string, len(path))
+	for i, hop := range path {
+		addr, err := ParseAX25Address(strings.TrimSuffix(hop, "*"))
+		if err != nil {
+			return nil, &BuildError{Kind: ErrBadPath, Field: "path", Value: hop}
+		}
+		out[i] = addr.String()
+		if strings.HasSuffix(hop, "*") {
+			out[i] += "*"
+		}
+	}
+	return out, nil
+}
+
+// buildInfo renders the information field: a padded message when addressee is
+// set, otherwise the payload as-is.
+func buildInfo(addressee, payload string) (string, error) {
+	if strings.ContainsAny(payload, "\r\n\x00") {
+		return "", &BuildError{Kind: ErrForbiddenChar, Field: "payload", Value: payload}
+	}
+	if addressee == "" {
+		if payload == "" {
+			return "", &BuildError{Kind: ErrEmptyPayload, Field: "payload"}
+		}
+		if len(payload) > maxInfoLength {
+			return "", &BuildError{Kind: ErrTooLong, Field: "payload", Value: payload}
+		}
+		return payload, nil
+	}
+
+	addressee = strings.ToUpper(strings.TrimSpace(addressee))
+	if addressee == "" || len(addressee) > 9 || !isCallsignChars(addressee) {
+		return "", &BuildError{Kind: ErrBadAddressee, Field: "addressee", Value: addressee}
+	}
+	if payload == "" {
+		return "", &BuildError{Kind: ErrEmptyPayload, Field: "payload"}
+	}
+	text := payload
+	if i := strings.LastIndex(payload, "{"); i >= 0 && isMessageNumber(payload[i+1:]) {
+		text = payload[:i]
+	}
+	if strings.ContainsAny(text, "|~{") {
+		return "", &BuildError{Kind: ErrForbiddenChar, Field: "payload", Value: payload}
+	}
+	if len(text) > maxMessageText {
+		return "", &BuildError{Kind: ErrTooLong, Field: "payload", Value: payload}
+	}
+	return fmt.Sprintf(":%-9s:%s", addressee, payload), nil
+}
+
+// isMessageNumber reports whether s is a message number, "NN" or "MM}AA".
+func isMessageNumber(s string) bool {
+	id, ack, hasAck := strings.Cut(s, "}")
+	if len(id) < 1 || len(id) > 5 || !isAlnum(id) {
+		return false
+	}
+	return !hasAck || (len(ack) <= 2 && isAlnum(ack))
+}
+
+func isAlnum(s string) bool {
+	for _, c := range s {
+		if !(c >= 'A' && c <= 'Z') && !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package aprs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestBuildPacket tests TNC2 rendering for APRS-IS and RF
+func TestBuildPacket(t *testing.T) {
+	cases := []struct {
+		spec     PacketSpec
+		kind     TransportKind
+		expected string
+	}{
+		{PacketSpec{Source: "n0call", ToCall: "APZAMG", Addressee: "w1aw", Payload: "Hello{01}"}, TransportInternet,
+			"N0CALL>APZAMG,TCPIP*::W1AW     :Hello{01}"},
+		{PacketSpec{Source: "N0CALL-9", ToCall: "APZAMG", Addressee: "AD8NT-15", Payload: "ack3"}, TransportInternet,
+			"N0CALL-9>APZAMG,TCPIP*::AD8NT-15 :ack3"},
+		{PacketSpec{Source: "K8SDR-10", ToCall: "APZAMG", Path: []string{"WIDE1-1", "WIDE2-1"}, Payload: ">Gateway up"}, TransportRF,
+			"K8SDR-10>APZAMG,WIDE1-1,WIDE2-1:>Gateway up"},
+		{PacketSpec{Source: "N0CALL", ToCall: "APZAMG", Addressee: "W1AW", Payload: "Text{AB}CD"}, TransportRF,
+			"N0CALL>APZAMG::W1AW     :Text{AB}CD"},
+	}
+	for _, c := range cases {
+		got, err := BuildPacket(c.spec, c.kind)
+		if err != nil {
+			t.Fatalf("BuildPacket(%+v): %v", c.spec, err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected '%s', got '%s'", c.expected, got)
+		}
+	}
+}
+
+// TestBuildPacketErrors tests that bad input is rejected with the right error kind
+func TestBuildPacketErrors(t *testing.T) {
+	ok := PacketSpec{Source: "N0CALL", ToCall: "APZAMG", Addressee: "W1AW", Payload: "hi"}
+	with := func(f func(*PacketSpec)) PacketSpec { s := ok; f(&s); return s }
+	cases := []struct {
+		spec  PacketSpec
+		kind  TransportKind
+		field string
+		err   error
+	}{
+		{with(func(s *PacketSpec) { s.Source = "" }), TransportInternet, "source", ErrBadCallsign},
+		{with(func(s *PacketSpec) { s.Source = "N0CALL-10X" }), TransportInternet, "source", ErrBadCallsign},
+		{with(func(s *PacketSpec) { s.Source = "TOOLONG-1" }), TransportRF, "source", ErrBadCallsign},
+		{with(func(s *PacketSpec) { s.Path = []string{"TCPIP*", "qAC", "K8SDR-10"} }), TransportInternet, "path", ErrBadPath},
+		{with(func(s *PacketSpec) { s.Path = strings.Split("A,B,C,D,E,F,G,H,I", ",") }), TransportRF, "path", ErrTooLong},
+		{with(func(s *PacketSpec) { s.Addressee = "W1AW:X" }), TransportInternet, "addressee", ErrBadAddressee},
+		{with(func(s *PacketSpec) { s.Addressee = "ABCDEFGHIJ" }), TransportInternet, "addressee", ErrBadAddressee},
+		{with(func(s *PacketSpec) { s.Payload = strings.Repeat("x", 68) + "{01" }), TransportInternet, "payload", ErrTooLong},
+		{with(func(s *PacketSpec) { s.Payload = "pipe|here" }), TransportInternet, "payload", ErrForbiddenChar},
+		{with(func(s *PacketSpec) { s.Payload = "two\nlines" }), TransportInternet, "payload", ErrForbiddenChar},
+		{with(func(s *PacketSpec) { s.Payload = "" }), TransportInternet, "payload", ErrEmptyPayload},
+	}
+	for _, c := range cases {
+		_, err := BuildPacket(c.spec, c.kind)
+		var be *BuildError
+		if !errors.As(err, &be) || be.Field != c.field || !errors.Is(err, c.err) {
+			t.Fatalf("BuildPacket(%+v): expected %s error %v, got %v", c.spec, c.field, c.err, err)
+		}
+	}
+
+	// 67 characters of text plus a message number is fine.
+	if _, err := BuildPacket(with(func(s *PacketSpec) { s.Payload = strings.Repeat("x", 67) + "{01}" }), TransportInternet); err != nil {
+		t.Fatalf("Full-length message rejected: %v", err)
+	}
+}
+
+// TestWrapThirdParty tests third-party wrapping for members sent under the gateway login
+func TestWrapThirdParty(t *testing.T) {
+	inner := "AD8NT>APZAMG,TCPIP*::W1AW     :Hi{01}"
+	got, err := WrapThirdParty("K8SDR-10", "APZAMG", nil, inner, TransportInternet)
+	expected := "K8SDR-10>APZAMG,TCPIP*:}AD8NT>APZAMG,TCPIP,K8SDR-10*::W1AW     :Hi{01}"
+	if err != nil || got != expected {
+		t.Fatalf("Expected '%s', got '%s' (%v)", expected, got, err)
+	}
+
+	got, err = WrapThirdParty("K8SDR-10", "APZAMG", []string{"WIDE1-1"}, inner, TransportRF)
+	expected = "K8SDR-10>APZAMG,WIDE1-1:}AD8NT>APZAMG,TCPIP,K8SDR-10*::W1AW     :Hi{01}"
+	if err != nil || got != expected {
+		t.Fatalf("Expected '%s', got '%s' (%v)", expected, got, err)
+	}
+	if _, err := ParseTNC2(got); err != nil {
+		t.Fatalf("Wrapped RF packet is not valid AX.25: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package aprs
+
+import (
+	"strings"
+)
+
+// Message text is printable ASCII. APRS 1.01 reserves | and ~, and { starts
+// the message number; UTF-8 is mangled by many radios and older software.
+
+// reservedReplacements stand in for the characters message text may not carry.
+var reservedReplacements = map[rune]string{
+	'|': "/",
+	'~': "-",
+	'{': "(",
+}
+
+// transliterations map common non-ASCII characters, mostly from phone
+// keyboards, to ASCII.
+var transliterations = map[rune]string{
+	// Punctuation
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'",
+	'“': `"`, '”': `"`, '„': `"`, '‟': `"`, '″': `"`, '«': "<<", '»': ">>",
+	'–': "-", '—': "-", '―': "-", '‐': "-", '−': "-",
+	'…': "...", '•': "*", '·': ".", '\u00a0': " ", '\u2009': " ", '\u202f': " ",
+	'×': "x", '÷': "/", '°': " deg", '±': "+/-", '©': "(c)", '®': "(R)", '™': "(TM)",
+	'€': "EUR", '£': "GBP", '¥': "JPY", '¢': "c", '¿': "?", '¡': "!",
+	'½': "1/2", '¼': "1/4", '¾': "3/4",
+
+	// Latin letters with diacritics
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE", 'Ç': "C",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ð': "D", 'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ý': "Y", 'Þ': "TH", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'þ': "th", 'ÿ': "y",
+	'Ą': "A", 'ą': "a", 'Ć': "C", 'ć': "c", 'Č': "C", 'č': "c", 'Ď': "D", 'ď': "d",
+	'Ę': "E", 'ę': "e", 'Ě': "E", 'ě': "e", 'Ł': "L", 'ł': "l", 'Ń': "N", 'ń': "n",
+	'Ň': "N", 'ň': "n", 'Ő': "O", 'ő': "o", 'Œ': "OE", 'œ': "oe", 'Ř': "R", 'ř': "r",
+	'Ś': "S", 'ś': "s", 'Š': "S", 'š': "s", 'Ť': "T", 'ť': "t", 'Ů': "U", 'ů': "u",
+	'Ű': "U", 'ű': "u", 'Ź': "Z", 'ź': "z", 'Ż': "Z", 'ż': "z", 'Ž': "Z", 'ž': "z",
+	'Ğ': "G", 'ğ': "g", 'İ': "I", 'ı': "i", 'Ş': "S", 'ş': "s",
+
+	// Emoji, as the shortcodes chat users know
+	'😀': ":grinning:", '😃': ":smiley:", '😄': ":smile:", '😁': ":grin:", '😂': ":joy:",
+	'🙂': ":slight_smile:", '😉': ":wink:", '😊': ":blush:", '😍': ":heart_eyes:", '😎': ":sunglasses:",
+	'😢': ":cry:", '😭': ":sob:", '😮': ":open_mouth:", '😡': ":rage:", '🤔': ":thinking:",
+	'👍': ":+1:", '👎': ":-1:", '👋': ":wave:", '👏': ":clap:", '🙏': ":pray:",
+	'❤': ":heart:", '🔥': ":fire:", '🎉': ":tada:", '✅': ":white_check_mark:", '❌': ":x:",
+	'📻': ":radio:", '📡': ":satellite:", '⚡': ":zap:", '☀': ":sunny:", '🌧': ":cloud_rain:",
+}
+
+// EncodeText converts message text to what may be transmitted: printable
+// ASCII, with common Unicode transliterated and reserved characters
+// replaced. Anything else becomes "?". Whitespace runs collapse to one space.
+func EncodeText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\ufe0f' || r == '\u200d' || (r >= 0x1F3FB && r <= 0x1F3FF):
+			// Emoji variation selectors, joiners and skin tones carry no text.
+		case reservedReplacements[r] != "":
+			b.WriteString(reservedReplacements[r])
+		case r >= ' ' && r <= '~':
+			b.WriteRune(r)
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		case transliterations[r] != "":
+			b.WriteString(transliterations[r])
+		case r < ' ' || r == 0x7f:
+			// Other control characters are dropped.
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
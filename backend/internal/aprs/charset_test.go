@@ -0,0 +1,36 @@
+package aprs
+
+import "testing"
+
+// TestEncodeText tests transliteration and reserved-character replacement
+func TestEncodeText(t *testing.T) {
+	cases := []struct {
+		in, expected string
+	}{
+		{"Plain text, 73!", "Plain text, 73!"},
+		{"It’s “fine” — really…", `It's "fine" - really...`},
+		{"Café in München, señor", "Cafe in Munchen, senor"},
+		{"Łódź Straße", "Lodz Strasse"},
+		{"Thanks 👍🏽 see you 😀", "Thanks :+1: see you :grinning:"},
+		{"❤️ it", ":heart: it"},
+		{"a|b~c{d}", "a/b-c(d}"},
+		{"two\nlines\tand  spaces", "two lines and spaces"},
+		{"bell\x07 and 中文", "bell and ??"},
+		{"   ", ""},
+	}
+	for _, c := range cases {
+		if got := EncodeText(c.in); got != c.expected {
+			t.Fatalf("EncodeText(%q): expected '%s', got '%s'", c.in, c.expected, got)
+		}
+	}
+
+	// Whatever comes out must build as a message.
+	for _, c := range cases {
+		if c.expected == "" {
+			continue
+		}
+		if _, err := BuildPacket(PacketSpec{Source: "N0CALL", ToCall: "APZAMG", Addressee: "W1AW", Payload: EncodeText(c.in) + "{01}"}, TransportInternet); err != nil {
+			t.Fatalf("Encoded '%s' does not build: %v", c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package aprs
+
+import "time"
+
+// Clock is the time source for the manager, the IGate and the APRS-IS
+// transport. Tests inject a fake one to drive timeouts and backoff.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the real wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
@@ -0,0 +1,95 @@
+package aprs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"aprsmessenger-gateway/internal/db"
+)
+
+// errNoMessageNumber is returned when every message number is in flight.
+var errNoMessageNumber = errors.New("too many unacknowledged messages to this contact")
+
+// conversationsMu serialises numbering, so two sends cannot take one number.
+var conversationsMu sync.Mutex
+
+// maxMessageNumber is the count of two-character base-36 numbers, "01" to "ZZ".
+const maxMessageNumber = 36*36 - 1
+
+// nextMessageNumber returns the two-character number after last, counting
+// 01-09, 0A-0Z, 10, ... ZZ and wrapping to 01. Two characters suit both
+// classic {NNNNN} and REPLY-ACK {MM}AA receivers.
+func nextMessageNumber(last string) string {
+	n, err := strconv.ParseInt(last, 36, 64)
+	if err != nil || n < 0 {
+		n = 0
+	}
+	n = n%maxMessageNumber + 1
+	s := strings.ToUpper(strconv.FormatInt(n, 36))
+	if len(s) < 2 {
+		s = "0" + s
+	}
+	return s
+}
+
+// ComposeMessage allocates the next message number from user (base
+// callsign) to contact, skipping numbers still waiting for an ack, and
+// returns the message body to send: text{MM}, followed by the last number
+// the contact sent us if it supports REPLY-ACK.
+func ComposeMessage(user, contact, text string) (payload, msgNo string, err error) {
+	conversationsMu.Lock()
+	defer conversationsMu.Unlock()
+
+	conv, err := db.GetConversation(user, contact)
+	if err != nil {
+		return "", "", err
+	}
+	inFlight, err := db.InFlightMessageNumbers(user, contact)
+	if err != nil {
+		return "", "", err
+	}
+	msgNo = conv.LastSent
+	for i := 0; ; i++ {
+		if i == maxMessageNumber {
+			return "", "", errNoMessageNumber
+		}
+		msgNo = nextMessageNumber(msgNo)
+		if !inFlight[msgNo] {
+			break
+		}
+	}
+	conv.LastSent = msgNo
+	if err := db.SaveConversation(conv); err != nil {
+		return "", "", err
+	}
+
+	payload = text + "{" + msgNo + "}"
+	if conv.ReplyAck && len(conv.LastReceived) == 2 {
+		payload += conv.LastReceived
+	}
+	return payload, msgNo, nil
+}
+
+// receiveMessageNumber records a numbered message from contact to user (base
+// callsign) and returns how many times that number has now arrived in a row;
+// more than one means the contact is retransmitting.
+func receiveMessageNumber(user, contact, msgNo string, replyAck bool) (int, error) {
+	conversationsMu.Lock()
+	defer conversationsMu.Unlock()
+
+	conv, err := db.GetConversation(user, contact)
+	if err != nil {
+		return 0, err
+	}
+	if conv.LastReceived == msgNo {
+		conv.ReceivedCopies++
+	} else {
+		conv.LastReceived, conv.ReceivedCopies = msgNo, 1
+	}
+	if replyAck {
+		conv.ReplyAck = true
+	}
+	return conv.ReceivedCopies, db.SaveConversation(conv)
+}
@@ -0,0 +1,58 @@
+package aprs
+
+import (
+	"testing"
+
+	"aprsmessenger-gateway/internal/db"
+)
+
+// TestNextMessageNumber tests the two-character numbering sequence and its wrap
+func TestNextMessageNumber(t *testing.T) {
+	for last, expected := range map[string]string{"": "01", "01": "02", "09": "0A", "0Z": "10", "99": "9A", "ZZ": "01", "bad!": "01"} {
+		if got := nextMessageNumber(last); got != expected {
+			t.Fatalf("After '%s': expected '%s', got '%s'", last, expected, got)
+		}
+	}
+}
+
+// TestConversationNumbering tests persisted numbering, in-flight skipping and REPLY-ACK
+func TestConversationNumbering(t *testing.T) {
+	const user, contact = "N0CNV", "W1CNV-9"
+	// Start each run as if the contact had never used REPLY-ACK.
+	conv, _ := db.GetConversation(user, contact)
+	conv.ReplyAck = false
+	if err := db.SaveConversation(conv); err != nil {
+		t.Fatalf("SaveConversation: %v", err)
+	}
+
+	_, first, err := ComposeMessage(user, contact, "One")
+	if err != nil {
+		t.Fatalf("ComposeMessage: %v", err)
+	}
+	// The next number is still waiting for an ack, so it is skipped.
+	busy := nextMessageNumber(first)
+	if err := db.StoreSentMessage(contact, user+"-7", "Old{"+busy+"}", busy); err != nil {
+		t.Fatalf("StoreSentMessage: %v", err)
+	}
+	payload, second, err := ComposeMessage(user, contact, "Two")
+	if err != nil || second != nextMessageNumber(busy) {
+		t.Fatalf("Expected '%s' after skipping '%s', got '%s' (%v)", nextMessageNumber(busy), busy, second, err)
+	}
+	if expected := "Two{" + second + "}"; payload != expected {
+		t.Fatalf("Expected '%s' without REPLY-ACK before the contact used it, got '%s'", expected, payload)
+	}
+
+	for i, n := range []string{"AA", "AB", "AB"} {
+		copies, err := receiveMessageNumber(user, contact, n, true)
+		if err != nil {
+			t.Fatalf("receiveMessageNumber: %v", err)
+		}
+		if expected := []int{1, 1, 2}[i]; copies != expected {
+			t.Fatalf("Message %d: expected %d copies, got %d", i, expected, copies)
+		}
+	}
+	payload, third, _ := ComposeMessage(user, contact, "Three")
+	if expected := "Three{" + third + "}AB"; payload != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, payload)
+	}
+}
@@ -0,0 +1,81 @@
+package aprs
+
+import (
+	"crypto/sha1"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+)
+
+// dedupKey identifies one received message. The text is hashed so the cache
+// does not keep message bodies around.
+type dedupKey struct {
+	source, addressee, msgNo string
+	text                     [sha1.Size]byte
+}
+
+// dedupCache remembers received messages so copies heard through several
+// IGates, or retried by the sender, are stored once. A copy heard within the
+// window of the previous one refreshes it; numbered messages use the longer
+// retry window.
+type dedupCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries *expiringSet[dedupKey, int64] // Stored message the copies count against
+}
+
+func newDedupCache(now func() time.Time) *dedupCache {
+	return &dedupCache{now: now, entries: newExpiringSet[dedupKey, int64](dedupWindow)}
+}
+
+func newDedupKey(source, addressee, msgNo, text string) dedupKey {
+	return dedupKey{toUpperNoSpace(source), toUpperNoSpace(addressee), msgNo, sha1.Sum([]byte(text))}
+}
+
+// dedupWindow is how long after a copy another one counts as a duplicate.
+func dedupWindow(k dedupKey) time.Duration {
+	cfg := config.Get().Inbound
+	if k.msgNo != "" {
+		return cfg.RetryWindow.D()
+	}
+	return cfg.DedupWindow.D()
+}
+
+// check reports the stored message a copy of k duplicates, if it was heard
+// within its window, and marks it heard again.
+func (c *dedupCache) check(k dedupKey) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.entries.prune(now)
+	id, ok := c.entries.get(k, now)
+	if !ok {
+		return 0, false
+	}
+	c.entries.add(k, id, now)
+	return id, true
+}
+
+// store records k as stored under id.
+func (c *dedupCache) store(k dedupKey, id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries.add(k, id, c.now())
+}
+
+// replace points entries for the stored messages ids at id instead, after
+// the parts of a multipart message were replaced by the whole.
+func (c *dedupCache) replace(ids []int64, id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := make(map[int64]bool, len(ids))
+	for _, i := range ids {
+		old[i] = true
+	}
+	c.entries.update(func(e *int64) {
+		if old[*e] {
+			*e = id
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package aprs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDedupCache tests duplicate windows for numbered and unnumbered messages
+func TestDedupCache(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := newDedupCache(func() time.Time { return now })
+
+	numbered := newDedupKey("w1aw", "N0CALL-7", "01", "Hello")
+	plain := newDedupKey("W1AW", "N0CALL-7", "", "Hello")
+	if _, dup := c.check(numbered); dup {
+		t.Fatal("First copy reported as a duplicate")
+	}
+	c.store(numbered, 10)
+	c.store(plain, 11)
+	if newDedupKey("W1AW", "N0CALL-7", "01", "Hello!") == numbered {
+		t.Fatal("Different text should give a different key")
+	}
+
+	now = now.Add(20 * time.Second)
+	if id, dup := c.check(numbered); !dup || id != 10 {
+		t.Fatalf("Expected duplicate of 10, got %d %v", id, dup)
+	}
+	if id, dup := c.check(plain); !dup || id != 11 {
+		t.Fatalf("Expected duplicate of 11, got %d %v", id, dup)
+	}
+
+	// Each copy restarts the window; unnumbered messages use the shorter one.
+	now = now.Add(40 * time.Second)
+	if _, dup := c.check(plain); dup {
+		t.Fatal("Unnumbered copy past the 30s window reported as a duplicate")
+	}
+	if _, dup := c.check(numbered); !dup {
+		t.Fatal("Numbered retry inside the retry window not reported as a duplicate")
+	}
+
+	c.replace([]int64{10}, 20)
+	if id, _ := c.check(numbered); id != 20 {
+		t.Fatalf("Expected replaced ID 20, got %d", id)
+	}
+
+	now = now.Add(31 * time.Minute)
+	if _, dup := c.check(numbered); dup {
+		t.Fatal("Numbered copy past the retry window reported as a duplicate")
+	}
+	if c.entries.len() != 0 {
+		t.Fatalf("Expected expired entries pruned, got %d", c.entries.len())
+	}
+}
@@ -0,0 +1,525 @@
+package aprs_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprs"
+	"aprsmessenger-gateway/internal/aprstest"
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+	"aprsmessenger-gateway/internal/models"
+)
+
+// startGateway registers users afresh, dropping anything left from an earlier
+// run, then runs a manager against a fresh fake APRS-IS server.
+func startGateway(t *testing.T, users ...string) (*aprs.APRSManager, *aprstest.Server, *aprstest.Clock) {
+	t.Helper()
+	for _, cs := range users {
+		if u, _ := db.GetUserByCallsign(cs); u != nil {
+			if err := db.DeleteUserAndData(u.ID); err != nil {
+				t.Fatalf("DeleteUserAndData %s: %v", cs, err)
+			}
+		}
+		if err := db.CreateUser(&models.User{Callsign: cs, PasswordHash: "x", Passcode: "0"}); err != nil {
+			t.Fatalf("CreateUser %s: %v", cs, err)
+		}
+	}
+
+	srv := aprstest.NewServer(t)
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	am := aprs.NewAPRSManagerWithOptions(aprs.ManagerOptions{Servers: []string{srv.Addr()}, Clock: clock})
+	am.Start()
+	t.Cleanup(am.Stop)
+
+	login := srv.WaitLogin(t, 2*time.Second)
+	for _, cs := range users {
+		if !strings.Contains(login.Filter, cs) {
+			t.Fatalf("Login filter %q does not include %s", login.Filter, cs)
+		}
+	}
+	waitConnected(t, am)
+	return am, srv, clock
+}
+
+// waitConnected waits for the manager to see its logresp.
+func waitConnected(t *testing.T, am *aprs.APRSManager) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		st := am.Status()
+		if st.Connected && len(st.Transports) > 0 {
+			if d, ok := st.Transports[0].Detail.(aprs.APRSISDetail); ok && len(d.Feeds) > 0 && d.Feeds[0].Verified {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Gateway never connected to the fake server")
+}
+
+func ackFor(to, id string) func(string) bool {
+	return func(line string) bool {
+		return strings.HasSuffix(line, "::"+to+strings.Repeat(" ", 9-len(to))+":ack"+id)
+	}
+}
+
+// storedFrom returns the stored messages from one sender to a user.
+func storedFrom(t *testing.T, user, from string) []string {
+	t.Helper()
+	msgs, err := db.ListAllMessagesForUser(user)
+	if err != nil {
+		t.Fatalf("ListAllMessagesForUser: %v", err)
+	}
+	var out []string
+	for _, m := range msgs {
+		if m.FromCallsign == from {
+			out = append(out, m.Message)
+		}
+	}
+	return out
+}
+
+// TestE2EReceiveAndAck tests that a message for a member is stored and acked on APRS-IS
+func TestE2EReceiveAndAck(t *testing.T) {
+	_, srv, _ := startGateway(t, "E2ERX")
+
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2ERX-7  :Hello there{01")
+	ack := srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "01"))
+	if !strings.HasPrefix(ack, "E2ERX-7>") {
+		t.Fatalf("Ack should come from the addressee, got '%s'", ack)
+	}
+	if got := storedFrom(t, "E2ERX", "W1AW"); len(got) != 1 || got[0] != "Hello there" {
+		t.Fatalf("Expected the message stored once, got %q", got)
+	}
+
+	// Traffic for non-members is ignored.
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::N0BODY   :Hi{02")
+	srv.ExpectNoSent(t, 200*time.Millisecond, ackFor("W1AW", "02"))
+}
+
+// TestE2EBlocked tests that messages from a blocked callsign are neither stored nor acked
+func TestE2EBlocked(t *testing.T) {
+	_, srv, _ := startGateway(t, "E2EBL")
+	u, _ := db.GetUserByCallsign("E2EBL")
+	if err := db.BlockCallsign(u.ID, "N0SPAM"); err != nil {
+		t.Fatalf("BlockCallsign: %v", err)
+	}
+
+	srv.Inject("N0SPAM>APRS,TCPIP*,qAC,T2TEST::E2EBL    :Buy now{11")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EBL    :Real message{12")
+	srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "12"))
+	srv.ExpectNoSent(t, 100*time.Millisecond, ackFor("N0SPAM", "11"))
+	if got := storedFrom(t, "E2EBL", "N0SPAM"); len(got) != 0 {
+		t.Fatalf("Blocked message was stored: %q", got)
+	}
+}
+
+// TestE2EReconnect tests that the gateway logs in again after the server drops it
+func TestE2EReconnect(t *testing.T) {
+	am, srv, clock := startGateway(t, "E2ERC")
+
+	// Background timers (such as the station writer's) are already waiting.
+	waiting := clock.Waiters()
+	srv.Disconnect()
+	if !clock.BlockUntil(waiting+1, 2*time.Second) {
+		t.Fatal("Gateway did not start a backoff wait after the disconnect")
+	}
+	if st := am.Status(); st.Connected {
+		t.Fatal("Gateway still reports connected while backing off")
+	}
+	clock.Advance(time.Minute)
+
+	login := srv.WaitLogin(t, 2*time.Second)
+	if !strings.Contains(login.Filter, "E2ERC") {
+		t.Fatalf("Filter lost on reconnect: %q", login.Filter)
+	}
+	waitConnected(t, am)
+
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2ERC    :Still there?{21")
+	srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "21"))
+}
+
+// TestE2EThirdParty tests that a message gated from RF third-party wrapped is stored and acked to its original sender
+func TestE2EThirdParty(t *testing.T) {
+	_, srv, _ := startGateway(t, "E2ETP")
+
+	srv.Inject("IGATE-1>APRS,TCPIP*,qAC,T2TEST:}N0RF-9>APDR16,TCPIP,IGATE-1*::E2ETP    :From the field{31}")
+	ack := srv.WaitSent(t, 2*time.Second, ackFor("N0RF-9", "31"))
+	if !strings.HasPrefix(ack, "E2ETP>") {
+		t.Fatalf("Ack should come from the addressee, got '%s'", ack)
+	}
+	if got := storedFrom(t, "E2ETP", "N0RF-9"); len(got) != 1 || got[0] != "From the field" {
+		t.Fatalf("Expected the unwrapped message stored, got %q", got)
+	}
+}
+
+// statusOf waits for the newest message sent by user with msgNo to leave the "sent" status.
+func statusOf(t *testing.T, user, msgNo string) string {
+	t.Helper()
+	status := ""
+	for i := 0; i < 200; i++ {
+		msgs, err := db.ListAllMessagesForUser(user)
+		if err != nil {
+			t.Fatalf("ListAllMessagesForUser: %v", err)
+		}
+		for _, m := range msgs {
+			if strings.HasPrefix(m.FromCallsign, user) && m.MsgNo == msgNo {
+				status = m.Status
+			}
+		}
+		if status != db.StatusSent {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return status
+}
+
+// TestE2EAckRej tests that acks, rejs and REPLY-ACKs update sent messages and are never stored as chat
+func TestE2EAckRej(t *testing.T) {
+	_, srv, _ := startGateway(t, "E2EAK")
+	for _, id := range []string{"AA", "AB", "AC"} {
+		if err := db.StoreSentMessage("W1AW", "E2EAK-7", "Test{"+id+"}", id); err != nil {
+			t.Fatalf("StoreSentMessage: %v", err)
+		}
+	}
+
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EAK-7  :ackAA")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EAK-7  :rejAB")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EAK-7  :Got it{01}AC")
+	srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "01"))
+
+	for id, expected := range map[string]string{"AA": db.StatusAcked, "AB": db.StatusRejected, "AC": db.StatusAcked} {
+		if got := statusOf(t, "E2EAK", id); got != expected {
+			t.Fatalf("Expected message %s '%s', got '%s'", id, expected, got)
+		}
+	}
+	if got := storedFrom(t, "E2EAK", "W1AW"); len(got) != 1 || got[0] != "Got it" {
+		t.Fatalf("Expected only the REPLY-ACK message stored, got %q", got)
+	}
+}
+
+// TestE2EMultipart tests that a message sent in (i/n) parts is stored as one entry
+func TestE2EMultipart(t *testing.T) {
+	_, srv, _ := startGateway(t, "E2EMP")
+
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EMP    :Meet at the hamfest (1/2){41")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EMP    :by the south gate (2/2){42")
+	srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "42"))
+
+	got := storedFrom(t, "E2EMP", "W1AW")
+	if len(got) != 1 || got[0] != "Meet at the hamfest by the south gate" {
+		t.Fatalf("Expected the parts stored as one message, got %q", got)
+	}
+}
+
+// TestE2EDuplicates tests that copies of a received message are stored once and counted
+func TestE2EDuplicates(t *testing.T) {
+	_, srv, clock := startGateway(t, "E2EDUP")
+
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EDUP   :Dup test{61")
+	srv.Inject("W1AW>APRS,WIDE1*,qAR,IGATE-1::E2EDUP   :Dup test{61")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EDUP   :Second{62")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EDUP   :Dup test{61")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EDUP   :No number")
+	srv.Inject("W1AW>APRS,WIDE1*,qAR,IGATE-1::E2EDUP   :No number")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EDUP   :Marker{63")
+	srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "63"))
+
+	msgs, err := db.ListAllMessagesForUser("E2EDUP")
+	if err != nil {
+		t.Fatalf("ListAllMessagesForUser: %v", err)
+	}
+	expected := []struct {
+		text   string
+		copies int
+	}{{"Dup test", 3}, {"Second", 1}, {"No number", 2}, {"Marker", 1}}
+	if len(msgs) != len(expected) {
+		t.Fatalf("Expected %d messages stored, got %d", len(expected), len(msgs))
+	}
+	for i, e := range expected {
+		if m := msgs[i]; m.Message != e.text || m.Copies != e.copies {
+			t.Fatalf("Expected '%s' with %d copies, got '%s' with %d", e.text, e.copies, m.Message, m.Copies)
+		}
+	}
+
+	// Past the window, the same unnumbered text is a new message.
+	clock.Advance(31 * time.Second)
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EDUP   :No number")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EDUP   :Marker{64")
+	srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "64"))
+	if got := storedFrom(t, "E2EDUP", "W1AW"); len(got) != 6 || got[4] != "No number" {
+		t.Fatalf("Expected the repeat stored after the window, got %q", got)
+	}
+}
+
+// TestE2EAckPolicy tests that the gateway acks as each member's ack policy allows, and never after their own station
+func TestE2EAckPolicy(t *testing.T) {
+	_, srv, _ := startGateway(t, "E2EAPA", "E2EAPS", "E2EAPN")
+	for cs, policy := range map[string]string{"E2EAPA": db.AckAlways, "E2EAPS": db.AckSession, "E2EAPN": db.AckNever} {
+		u, _ := db.GetUserByCallsign(cs)
+		if err := db.SaveUserSettings(&db.UserSettings{UserID: u.ID, AckPolicy: policy}); err != nil {
+			t.Fatalf("SaveUserSettings: %v", err)
+		}
+	}
+
+	srv.Inject("E2EAPA-7>APRS,TCPIP*,qAC,T2TEST::W1AW     :ack71")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EAPA-7 :Already acked{71")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EAPS   :Nobody home{73")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EAPN   :Radio acks{74")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EAPA-7 :Acked by us{72")
+
+	unwanted := func(line string) bool {
+		return ackFor("W1AW", "71")(line) || ackFor("W1AW", "73")(line) || ackFor("W1AW", "74")(line)
+	}
+	line := srv.WaitSent(t, 2*time.Second, func(line string) bool {
+		return unwanted(line) || ackFor("W1AW", "72")(line)
+	})
+	if unwanted(line) {
+		t.Fatalf("Gateway acked against the member's policy: %s", line)
+	}
+	for _, cs := range []string{"E2EAPS", "E2EAPN"} {
+		if got := storedFrom(t, cs, "W1AW"); len(got) == 0 {
+			t.Fatalf("Message for %s was not stored", cs)
+		}
+	}
+}
+
+func rejFor(to, id string) func(string) bool {
+	return func(line string) bool {
+		return strings.HasSuffix(line, "::"+to+strings.Repeat(" ", 9-len(to))+":rej"+id)
+	}
+}
+
+// TestE2ERefusals tests the policy answers for blocked senders, suspended and deleted accounts and full quotas
+func TestE2ERefusals(t *testing.T) {
+	if u, _ := db.GetUserByCallsign("E2ERJD"); u == nil {
+		if err := db.CreateUser(&models.User{Callsign: "E2ERJD", PasswordHash: "x", Passcode: "0"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	gone, _ := db.GetUserByCallsign("E2ERJD")
+	if err := db.DeleteUserAndData(gone.ID); err != nil {
+		t.Fatalf("DeleteUserAndData: %v", err)
+	}
+	_, srv, clock := startGateway(t, "E2ERJB", "E2ERJS", "E2ERJQ")
+
+	blocker, _ := db.GetUserByCallsign("E2ERJB")
+	if err := db.BlockCallsign(blocker.ID, "N0SPAM"); err != nil {
+		t.Fatalf("BlockCallsign: %v", err)
+	}
+	if err := db.SaveUserSettings(&db.UserSettings{UserID: blocker.ID, AckPolicy: db.AckAlways, BlockedAction: db.ActionRej}); err != nil {
+		t.Fatalf("SaveUserSettings: %v", err)
+	}
+	suspended, _ := db.GetUserByCallsign("E2ERJS")
+	if err := db.SetSuspended(suspended.ID, true); err != nil {
+		t.Fatalf("SetSuspended: %v", err)
+	}
+	quota := config.Get().Inbound.DailyQuota
+	for i := 0; i < quota; i++ {
+		if _, err := db.InsertMessage("E2ERJQ", "W1AW", "Filler", clock.Now().Add(-time.Hour)); err != nil {
+			t.Fatalf("InsertMessage: %v", err)
+		}
+	}
+
+	srv.Inject("N0SPAM>APRS,TCPIP*,qAC,T2TEST::E2ERJB   :Buy now{81")
+	srv.Inject("N0SPAM>APRS,TCPIP*,qAC,T2TEST::E2ERJB   :Buy now{81")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2ERJS   :Are you there{82")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2ERJQ   :One too many{83")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2ERJD   :Still around{84")
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2ERJB   :Welcome{85")
+
+	expected := map[string]func(string) bool{
+		"rej 81": rejFor("N0SPAM", "81"),
+		"rej 82": rejFor("W1AW", "82"),
+		"rej 83": rejFor("W1AW", "83"),
+		"ack 85": ackFor("W1AW", "85"),
+	}
+	unwanted := func(line string) bool { return ackFor("W1AW", "84")(line) || rejFor("W1AW", "84")(line) }
+	for len(expected) > 0 {
+		line := srv.WaitSent(t, 2*time.Second, func(line string) bool {
+			for _, match := range expected {
+				if match(line) {
+					return true
+				}
+			}
+			return unwanted(line)
+		})
+		if unwanted(line) {
+			t.Fatalf("Answered a message for a deleted account: %s", line)
+		}
+		for name, match := range expected {
+			if match(line) {
+				delete(expected, name)
+			}
+		}
+	}
+
+	for cs, reason := range map[string]string{"E2ERJB": db.ReasonBlocked, "E2ERJS": db.ReasonSuspended, "E2ERJQ": db.ReasonQuota} {
+		d, err := db.ListPolicyDecisions(cs, 0)
+		if err != nil {
+			t.Fatalf("ListPolicyDecisions: %v", err)
+		}
+		if len(d) != 1 || d[0].Reason != reason {
+			t.Fatalf("Expected one '%s' decision for %s, got %d", reason, cs, len(d))
+		}
+	}
+	if d, _ := db.ListPolicyDecisions("E2ERJD", 0); len(d) != 0 {
+		t.Fatalf("Expected nothing logged for a deleted account, got %d", len(d))
+	}
+	if got := storedFrom(t, "E2ERJS", "W1AW"); len(got) != 0 {
+		t.Fatalf("Message for a suspended account was stored: %q", got)
+	}
+}
+
+// TestE2ELocal tests that a message between members is delivered and acked locally, transmitted once, and its echo ignored
+func TestE2ELocal(t *testing.T) {
+	am, srv, _ := startGateway(t, "E2ELA", "E2ELB")
+
+	payload, msgNo, err := aprs.ComposeMessage("E2ELA", "E2ELB", "Hi neighbour")
+	if err != nil {
+		t.Fatalf("ComposeMessage: %v", err)
+	}
+	if err := am.QueueSegments("E2ELA-7", "E2ELB", []string{payload}, []string{msgNo}); err != nil {
+		t.Fatalf("QueueSegments: %v", err)
+	}
+
+	status := ""
+	for i := 0; i < 200 && status != db.StatusAcked; i++ {
+		time.Sleep(10 * time.Millisecond)
+		status = statusOf(t, "E2ELA", msgNo)
+	}
+	if status != db.StatusAcked {
+		t.Fatalf("Expected the local message acked, got '%s'", status)
+	}
+	sent := srv.WaitSent(t, 2*time.Second, func(line string) bool {
+		return strings.Contains(line, "::E2ELB    :Hi neighbour{"+msgNo)
+	})
+
+	// The transmitted copy comes back from APRS-IS and is ignored.
+	src, rest, _ := strings.Cut(sent, ">")
+	_, info, _ := strings.Cut(rest, ":")
+	srv.Inject(src + ">APZAMG,TCPIP*,qAC,T2TEST:" + info)
+	srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2ELB    :Marker{91")
+	srv.WaitSent(t, 2*time.Second, ackFor("W1AW", "91"))
+
+	msgs, err := db.ListAllMessagesForUser("E2ELB")
+	if err != nil {
+		t.Fatalf("ListAllMessagesForUser: %v", err)
+	}
+	var shared []*db.Message
+	for _, m := range msgs {
+		if m.FromCallsign == "E2ELA-7" && m.MsgNo == msgNo {
+			shared = append(shared, m)
+		}
+	}
+	if len(shared) == 0 || shared[len(shared)-1].Copies != 1 {
+		t.Fatalf("Expected the sent row heard once, got %+v", shared)
+	}
+	if got := storedFrom(t, "E2ELB", "E2ELA-7"); len(got) != 1 {
+		t.Fatalf("Expected one row shared by both members, got %q", got)
+	}
+}
+
+// TestE2EStations tests that stations heard on the feed are recorded in batches and placed on routes
+func TestE2EStations(t *testing.T) {
+	am, srv, clock := startGateway(t, "E2EST")
+
+	srv.Inject("E2EPOS-9>APRS,WIDE1-1*,qAR,E2EIG:!4903.50N/07201.75W>Mobile")
+	srv.Inject("E2EPOS-9>APRS,TCPIP*,qAC,T2TEST:>092345zOn the air")
+	srv.Inject("E2EIG>APRS,TCPIP*,qAC,T2TEST:<IGATE,MSG_CNT=1")
+	srv.Inject("E2EIG>APRS,TCPIP*,qAC,T2TEST:=4000.00N/08300.00W&IGate")
+	srv.Inject("E2EPOS-9>APRS,WIDE1-1*,qAR,E2EIG::E2EST    :Where am I{71")
+	srv.WaitSent(t, 2*time.Second, ackFor("E2EPOS-9", "71"))
+
+	// Heard, but waiting for the next batch.
+	st, err := am.Station("e2epos-9")
+	if err != nil || st == nil {
+		t.Fatalf("Expected the station known, got %v (%v)", st, err)
+	}
+	if !st.HasPosition || st.Symbol != "/>" || st.Status != "On the air" || st.IGate != "E2EIG" || st.Packets != 3 {
+		t.Fatalf("Unexpected station: %+v", st)
+	}
+	if stored, _ := db.GetStation("E2EPOS-9"); stored != nil {
+		t.Fatalf("Expected no write before the flush interval, got %+v", stored)
+	}
+
+	clock.Advance(config.Get().Stations.FlushInterval.D())
+	var stored *db.Station
+	for i := 0; i < 200 && (stored == nil || stored.Packets != 3); i++ {
+		time.Sleep(10 * time.Millisecond)
+		stored, _ = db.GetStation("E2EPOS-9")
+	}
+	if stored == nil || stored.Packets != 3 || stored.Status != "On the air" || stored.Path != "APRS,WIDE1-1*,qAR,E2EIG" {
+		t.Fatalf("Expected the station written, got %+v", stored)
+	}
+	if ig, _ := db.GetStation("E2EIG"); ig == nil || ig.Capabilities != "IGATE,MSG_CNT=1" || !ig.HasPosition {
+		t.Fatalf("Expected the IGate written, got %+v", ig)
+	}
+
+	route := am.LocateRoute(aprs.BuildRoute("E2EPOS-9", "E2EST", aprs.ParsePath([]string{"APRS", "WIDE1-1*", "qAR", "E2EIG"}).Travelled()))
+	if len(route) != 4 || route[0].Lat != st.Lat || route[0].Lon != st.Lon || route[2].Lat != 40 || route[2].Lon != -83 || route[3].Lat != 0 {
+		t.Fatalf("Expected the route located, got %+v", route)
+	}
+
+	if _, err := db.PruneStations(clock.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PruneStations: %v", err)
+	}
+	if st, _ := am.Station("E2EPOS-9"); st != nil {
+		t.Fatalf("Expected the station pruned, got %+v", st)
+	}
+}
+
+// TestE2EObjects tests that objects and items are stored, killed, expired and listed by distance
+func TestE2EObjects(t *testing.T) {
+	am, srv, clock := startGateway(t, "E2EOB")
+	names := func(lat, lon, radius float64) []string {
+		t.Helper()
+		objects, err := am.Objects(lat, lon, radius)
+		if err != nil {
+			t.Fatalf("Objects: %v", err)
+		}
+		var out []string
+		for _, o := range objects {
+			if strings.HasPrefix(o.Originator, "E2EOB") {
+				out = append(out, o.Name)
+			}
+		}
+		return out
+	}
+	marker := func(id string) {
+		t.Helper()
+		srv.Inject("W1AW>APRS,TCPIP*,qAC,T2TEST::E2EOB    :Marker{" + id)
+		srv.WaitSent(t, 2*time.Second, ackFor("W1AW", id))
+	}
+
+	srv.Inject("E2EOB-1>APRS,TCPIP*,qAC,T2TEST:;NET-E2E  *011200z4903.50N/07201.75Wn Net tonight")
+	srv.Inject("E2EOB-1>APRS,TCPIP*,qAC,T2TEST:)RPT!4910.00N/07201.75Wr")
+	srv.Inject("E2EOB-2>APRS,TCPIP*,qAC,T2TEST:;FAR-E2E  *011200z4000.00N/08300.00W/")
+	marker("a1")
+	if got := names(49.05, -72.03, 50); strings.Join(got, ",") != "NET-E2E,RPT" {
+		t.Fatalf("Expected the two nearby objects nearest first, got %q", got)
+	}
+	if got := names(40, -83, 10); strings.Join(got, ",") != "FAR-E2E" {
+		t.Fatalf("Expected the far object on its own, got %q", got)
+	}
+
+	// A kill removes it, and a late live copy does not bring it back.
+	srv.Inject("E2EOB-1>APRS,TCPIP*,qAC,T2TEST:;NET-E2E  _011200z4903.50N/07201.75Wn")
+	srv.Inject("E2EOB-1>APRS,WIDE1*,qAR,IGATE-1:;NET-E2E  *011200z4903.50N/07201.75Wn Net tonight")
+	marker("a2")
+	if got := names(49.05, -72.03, 50); strings.Join(got, ",") != "RPT" {
+		t.Fatalf("Expected the killed object gone, got %q", got)
+	}
+
+	// Objects not heard again expire.
+	clock.Advance(config.Get().Objects.Expire.D() + time.Minute)
+	if got := names(49.05, -72.03, 20000); len(got) != 0 {
+		t.Fatalf("Expected every object expired, got %q", got)
+	}
+	// Expired rows, killed ones included, are deleted on the next prune.
+	if n, err := db.PruneObjects(clock.Now().Add(-config.Get().Objects.Expire.D())); err != nil || n != 3 {
+		t.Fatalf("Expected 3 objects pruned, got %d (%v)", n, err)
+	}
+}
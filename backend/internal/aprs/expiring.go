@@ -0,0 +1,68 @@
+package aprs
+
+import "time"
+
+// expiringSet remembers when each key was last seen, along with a value, and
+// forgets keys once their window has passed. It prunes at most once a minute.
+// It has no lock of its own; its owner's mutex guards it.
+type expiringSet[K comparable, V any] struct {
+	window    func(K) time.Duration // Read on every use, so config reloads apply
+	entries   map[K]*expiringEntry[V]
+	lastPrune time.Time
+}
+
+type expiringEntry[V any] struct {
+	value V
+	seen  time.Time
+}
+
+func newExpiringSet[K comparable, V any](window func(K) time.Duration) *expiringSet[K, V] {
+	return &expiringSet[K, V]{window: window, entries: make(map[K]*expiringEntry[V])}
+}
+
+// get returns k's value if k was seen within its window.
+func (s *expiringSet[K, V]) get(k K, now time.Time) (V, bool) {
+	e := s.entries[k]
+	if e == nil || now.Sub(e.seen) >= s.window(k) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// has reports whether k was seen within its window.
+func (s *expiringSet[K, V]) has(k K, now time.Time) bool {
+	_, ok := s.get(k, now)
+	return ok
+}
+
+// add records k as seen now with value v.
+func (s *expiringSet[K, V]) add(k K, v V, now time.Time) {
+	s.prune(now)
+	s.entries[k] = &expiringEntry[V]{value: v, seen: now}
+}
+
+// update calls fn with a pointer to every value, expired or not.
+func (s *expiringSet[K, V]) update(fn func(v *V)) {
+	for _, e := range s.entries {
+		fn(&e.value)
+	}
+}
+
+// len returns the number of keys not yet pruned.
+func (s *expiringSet[K, V]) len() int {
+	return len(s.entries)
+}
+
+// prune forgets keys past their window, at most once a minute.
+func (s *expiringSet[K, V]) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Minute {
+		return
+	}
+	s.lastPrune = now
+	for k, e := range s.entries {
+		if now.Sub(e.seen) >= s.window(k) {
+			delete(s.entries, k)
+		}
+	}
+}
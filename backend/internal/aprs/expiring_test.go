@@ -0,0 +1,40 @@
+package aprs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestExpiringSet tests per-key windows, refreshing, updating values and minute-spaced pruning
+func TestExpiringSet(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newExpiringSet[string, int](func(k string) time.Duration {
+		if k == "long" {
+			return 10 * time.Minute
+		}
+		return 30 * time.Second
+	})
+	s.add("short", 1, now)
+	s.add("long", 2, now)
+
+	now = now.Add(40 * time.Second)
+	if s.has("short", now) {
+		t.Fatal("Key past its window reported as seen")
+	}
+	if v, ok := s.get("long", now); !ok || v != 2 {
+		t.Fatalf("Expected 2, got %d (%v)", v, ok)
+	}
+	if s.len() != 2 {
+		t.Fatalf("Expected no prune inside a minute, got %d keys", s.len())
+	}
+
+	s.update(func(v *int) { *v *= 10 })
+	now = now.Add(30 * time.Second)
+	s.add("new", 3, now)
+	if s.len() != 2 || s.has("short", now) {
+		t.Fatalf("Expected the expired key pruned, got %d keys", s.len())
+	}
+	if v, _ := s.get("long", now); v != 20 {
+		t.Fatalf("Expected updated value 20, got %d", v)
+	}
+}
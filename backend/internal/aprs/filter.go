@@ -0,0 +1,64 @@
+package aprs
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxFilterLength bounds a single filter string. APRS-IS servers cap the login
+// and #filter lines at roughly 512 bytes, so leave room for the rest of the line.
+const maxFilterLength = 400
+
+// BuildFilters builds APRS-IS server-side filters for the given callsigns.
+// Each filter combines a g/ (messages addressed to) and b/ (packets from) list,
+// using a trailing wildcard so every SSID of a base callsign matches. When the
+// lists do not fit in maxLen the callsigns are spread over several filters, one
+// per connection. gateway, if set, is always included in the first filter's g/ list.
+func BuildFilters(gateway string, callsigns []string, maxLen int) []string {
+	bases := make(map[string]struct{})
+	for _, cs := range callsigns {
+		if b := baseCallsign(toUpperNoSpace(cs)); b != "" {
+			bases[b] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(bases))
+	for b := range bases {
+		sorted = append(sorted, b)
+	}
+	sort.Strings(sorted)
+
+	var filters []string
+	var group, budlist []string
+	if gateway != "" {
+		group = append(group, toUpperNoSpace(gateway))
+	}
+	flush := func() {
+		if len(group) == 0 && len(budlist) == 0 {
+			return
+		}
+		filters = append(filters, formatFilter(group, budlist))
+		group, budlist = nil, nil
+	}
+	for _, b := range sorted {
+		term := b + "*"
+		if len(budlist) > 0 && len(formatFilter(append(group, term), append(budlist, term))) > maxLen {
+			flush()
+		}
+		group = append(group, term)
+		budlist = append(budlist, term)
+	}
+	flush()
+	return filters
+}
+
+// formatFilter renders one "g/A/B b/A/B" filter string.
+func formatFilter(group, budlist []string) string {
+	var parts []string
+	if len(group) > 0 {
+		parts = append(parts, "g/"+strings.Join(group, "/"))
+	}
+	if len(budlist) > 0 {
+		parts = append(parts, "b/"+strings.Join(budlist, "/"))
+	}
+	return strings.Join(parts, " ")
+}
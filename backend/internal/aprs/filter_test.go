@@ -0,0 +1,41 @@
+package aprs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestBuildFiltersSingle tests that a small user set fits in one filter
+func TestBuildFiltersSingle(t *testing.T) {
+	filters := BuildFilters("K8SDR-10", []string{"n0call-9", "N0CALL", "AD8NT"}, maxFilterLength)
+	if len(filters) != 1 {
+		t.Fatalf("Expected 1 filter, got %d: %v", len(filters), filters)
+	}
+	expected := "g/K8SDR-10/AD8NT*/N0CALL* b/AD8NT*/N0CALL*"
+	if filters[0] != expected {
+		t.Fatalf("Expected filter '%s', got '%s'", expected, filters[0])
+	}
+}
+
+// TestBuildFiltersSplit tests that long user lists are split under the length limit
+func TestBuildFiltersSplit(t *testing.T) {
+	var callsigns []string
+	for i := 0; i < 200; i++ {
+		callsigns = append(callsigns, fmt.Sprintf("W%dABC", i))
+	}
+	filters := BuildFilters("K8SDR-10", callsigns, maxFilterLength)
+	if len(filters) < 2 {
+		t.Fatalf("Expected filter to be split, got %d filter(s)", len(filters))
+	}
+	seen := 0
+	for _, f := range filters {
+		if len(f) > maxFilterLength {
+			t.Fatalf("Filter exceeds %d chars: %d", maxFilterLength, len(f))
+		}
+		seen += strings.Count(strings.SplitN(f, " b/", 2)[1], "*")
+	}
+	if seen != len(callsigns) {
+		t.Fatalf("Expected %d callsigns across filters, got %d", len(callsigns), seen)
+	}
+}
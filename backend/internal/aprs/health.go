@@ -0,0 +1,167 @@
+package aprs
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Penalty weights for each kind of server failure. A server's score is the
+// negative of its decayed penalty, so healthier servers score closer to zero.
+const (
+	penaltyConnect   = 1.0
+	penaltyIdle      = 2.0
+	penaltyAuth      = 3.0
+	penaltyHalfLife  = 15 * time.Minute
+	stableConnection = 2 * time.Minute // A connection this old resets the backoff
+)
+
+// ServerHealth tracks how reliable one APRS-IS server has been.
+type ServerHealth struct {
+	Addr            string    `json:"addr"`
+	ConnectFailures int       `json:"connect_failures"`
+	AuthFailures    int       `json:"auth_failures"`
+	IdleTimeouts    int       `json:"idle_timeouts"`
+	Connects        int       `json:"connects"`
+	LastError       string    `json:"last_error,omitempty"`
+	LastAttempt     time.Time `json:"last_attempt,omitempty"`
+	LastConnected   time.Time `json:"last_connected,omitempty"`
+	Score           float64   `json:"score"`
+
+	penalty   float64
+	penaltyAt time.Time
+}
+
+// decayedPenalty returns the penalty after exponential decay up to now.
+func (h *ServerHealth) decayedPenalty(now time.Time) float64 {
+	if h.penalty == 0 {
+		return 0
+	}
+	elapsed := now.Sub(h.penaltyAt)
+	return h.penalty * math.Pow(0.5, float64(elapsed)/float64(penaltyHalfLife))
+}
+
+func (h *ServerHealth) addPenalty(now time.Time, p float64) {
+	h.penalty = h.decayedPenalty(now) + p
+	h.penaltyAt = now
+}
+
+// serverPool picks APRS-IS servers by health, falling back to configured order.
+type serverPool struct {
+	mu      sync.Mutex
+	order   []string
+	servers map[string]*ServerHealth
+	clock   Clock
+}
+
+func newServerPool(clock Clock) *serverPool {
+	return &serverPool{servers: make(map[string]*ServerHealth), clock: clock}
+}
+
+// setServers replaces the preferred server order, keeping history for servers still listed.
+func (p *serverPool) setServers(addrs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.order = append([]string(nil), addrs...)
+	for _, a := range addrs {
+		if _, ok := p.servers[a]; !ok {
+			p.servers[a] = &ServerHealth{Addr: a}
+		}
+	}
+}
+
+// pick returns the healthiest server, preferring earlier servers on ties.
+func (p *serverPool) pick() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	best := ""
+	bestPenalty := math.Inf(1)
+	for _, a := range p.order {
+		// Treat penalties within half a point as equal so order wins.
+		if pen := p.servers[a].decayedPenalty(now); pen < bestPenalty-0.5 {
+			best, bestPenalty = a, pen
+		}
+	}
+	return best
+}
+
+func (p *serverPool) record(addr string, fn func(h *ServerHealth, now time.Time)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.servers[addr]
+	if !ok {
+		h = &ServerHealth{Addr: addr}
+		p.servers[addr] = h
+	}
+	now := p.clock.Now()
+	h.LastAttempt = now
+	fn(h, now)
+}
+
+func (p *serverPool) connectFailed(addr string, err error) {
+	p.record(addr, func(h *ServerHealth, now time.Time) {
+		h.ConnectFailures++
+		h.LastError = err.Error()
+		h.addPenalty(now, penaltyConnect)
+	})
+}
+
+func (p *serverPool) authFailed(addr, reason string) {
+	p.record(addr, func(h *ServerHealth, now time.Time) {
+		h.AuthFailures++
+		h.LastError = reason
+		h.addPenalty(now, penaltyAuth)
+	})
+}
+
+func (p *serverPool) idleTimeout(addr string) {
+	p.record(addr, func(h *ServerHealth, now time.Time) {
+		h.IdleTimeouts++
+		h.LastError = "feed stalled"
+		h.addPenalty(now, penaltyIdle)
+	})
+}
+
+func (p *serverPool) connected(addr string) {
+	p.record(addr, func(h *ServerHealth, now time.Time) {
+		h.Connects++
+		h.LastConnected = now
+	})
+}
+
+// snapshot returns a copy of every listed server's health in configured order.
+func (p *serverPool) snapshot() []ServerHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	out := make([]ServerHealth, 0, len(p.order))
+	for _, a := range p.order {
+		h := *p.servers[a]
+		h.Score = 0 - math.Round(h.decayedPenalty(now)*100)/100 // 0 - x avoids a "-0" score
+		out = append(out, h)
+	}
+	return out
+}
+
+// backoff produces exponentially growing reconnect delays with jitter.
+type backoff struct {
+	min, max time.Duration
+	attempt  int
+}
+
+// next returns the delay before the next attempt: min*2^n capped at max,
+// then jittered to a random point in the upper half.
+func (b *backoff) next() time.Duration {
+	d := b.min << uint(b.attempt)
+	if d <= 0 || d > b.max {
+		d = b.max
+	} else {
+		b.attempt++
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (b *backoff) reset() { b.attempt = 0 }
@@ -0,0 +1,101 @@
+package aprs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprstest"
+)
+
+// TestServerPoolPick tests that the healthiest server wins and near ties go to the earlier one
+func TestServerPoolPick(t *testing.T) {
+	refused := errors.New("connection refused")
+	cases := []struct {
+		name  string
+		setup func(p *serverPool, clock *aprstest.Clock)
+		want  string
+	}{
+		{"fresh", func(p *serverPool, clock *aprstest.Clock) {}, "a"},
+		{"connect failure", func(p *serverPool, clock *aprstest.Clock) {
+			p.connectFailed("a", refused)
+		}, "b"},
+		{"worst failures", func(p *serverPool, clock *aprstest.Clock) {
+			p.authFailed("a", "login unverified")
+			p.idleTimeout("b")
+		}, "c"},
+		{"all failed", func(p *serverPool, clock *aprstest.Clock) {
+			p.authFailed("a", "login unverified")
+			p.idleTimeout("b")
+			p.connectFailed("c", refused)
+		}, "c"},
+		{"tie goes to order", func(p *serverPool, clock *aprstest.Clock) {
+			p.idleTimeout("a")
+			p.connectFailed("b", refused)
+			p.connectFailed("c", refused)
+		}, "b"},
+		{"within tolerance", func(p *serverPool, clock *aprstest.Clock) {
+			p.connectFailed("b", refused)
+			clock.Advance(10 * time.Minute)
+			p.connectFailed("a", refused)
+			p.connectFailed("c", refused)
+			clock.Advance(30 * time.Minute) // a: 0.25, b: 0.16
+		}, "a"},
+		{"decayed", func(p *serverPool, clock *aprstest.Clock) {
+			p.authFailed("a", "login unverified")
+			clock.Advance(time.Hour) // 3 halves four times: 0.19
+			p.connectFailed("b", refused)
+		}, "a"},
+		{"not yet decayed", func(p *serverPool, clock *aprstest.Clock) {
+			p.authFailed("a", "login unverified")
+			clock.Advance(10 * time.Minute) // 1.89
+			p.connectFailed("b", refused)
+			p.connectFailed("c", refused)
+			p.connectFailed("c", refused)
+		}, "b"},
+	}
+	for _, tc := range cases {
+		clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+		p := newServerPool(clock)
+		p.setServers([]string{"a", "b", "c"})
+		tc.setup(p, clock)
+		if got := p.pick(); got != tc.want {
+			t.Fatalf("%s: Expected '%s', got '%s'", tc.name, tc.want, got)
+		}
+	}
+}
+
+// TestBackoff tests that delays double up to the cap and are jittered into the upper half
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		name     string
+		min, max time.Duration
+		want     []time.Duration // Ceiling of each delay in turn
+	}{
+		{"doubling", time.Second, 5 * time.Second, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}},
+		{"capped", 2 * time.Second, 2 * time.Second, []time.Duration{2 * time.Second, 2 * time.Second}},
+		{"long", time.Minute, time.Hour, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}},
+	}
+	for _, tc := range cases {
+		seen := map[time.Duration]bool{}
+		for run := 0; run < 50; run++ {
+			bo := &backoff{min: tc.min, max: tc.max}
+			for i, ceiling := range tc.want {
+				d := bo.next()
+				if d < ceiling/2 || d > ceiling {
+					t.Fatalf("%s: Expected delay %d between %s and %s, got %s", tc.name, i, ceiling/2, ceiling, d)
+				}
+				if i == 0 {
+					seen[d] = true
+				}
+			}
+			bo.reset()
+			if d := bo.next(); d < tc.min/2 || d > tc.min {
+				t.Fatalf("%s: Expected the delay after reset between %s and %s, got %s", tc.name, tc.min/2, tc.min, d)
+			}
+		}
+		if len(seen) < 2 {
+			t.Fatalf("%s: Expected jittered delays, got only %v", tc.name, seen)
+		}
+	}
+}
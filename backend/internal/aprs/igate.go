@@ -0,0 +1,208 @@
+package aprs
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+)
+
+// IGateStats counts what the IGate did, for the gateway status.
+type IGateStats struct {
+	Enabled     bool `json:"enabled"`
+	GatedToIS   int  `json:"gated_to_is"`
+	GatedToRF   int  `json:"gated_to_rf"`
+	Duplicates  int  `json:"duplicates"`
+	OverBudget  int  `json:"over_budget"`
+	Rejected    int  `json:"rejected"` // Failed the gating rules
+	HeardOnRF   int  `json:"heard_on_rf"`
+	BudgetUsed  int  `json:"budget_used"`
+	BudgetLimit int  `json:"budget_limit"`
+}
+
+// IGate gates packets heard on RF to APRS-IS, and gates APRS-IS messages to RF
+// for stations recently heard locally, following the standard IGate rules.
+type IGate struct {
+	mu      sync.Mutex
+	heard   *expiringSet[string, struct{}] // Full callsigns heard on RF
+	gated   *expiringSet[string, struct{}] // Dedup keys of gated packets
+	txTimes []time.Time                    // RF transmissions inside the budget window
+	stats   IGateStats
+	now     func() time.Time
+}
+
+// NewIGate creates an IGate.
+func NewIGate() *IGate {
+	return &IGate{
+		heard: newExpiringSet[string, struct{}](func(string) time.Duration { return config.Get().IGate.HeardWindow.D() }),
+		gated: newExpiringSet[string, struct{}](func(string) time.Duration { return config.Get().IGate.DedupWindow.D() }),
+		now:   time.Now,
+	}
+}
+
+// splitTNC2 splits SRC>DST,PATH:info into its parts.
+func splitTNC2(line string) (src, dst string, path []string, info string, ok bool) {
+	header, info, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", "", nil, "", false
+	}
+	src, rest, ok := strings.Cut(header, ">")
+	if !ok || src == "" {
+		return "", "", nil, "", false
+	}
+	fields := strings.Split(rest, ",")
+	return src, fields[0], fields[1:], info, true
+}
+
+// noGateHops are path entries that forbid gating a packet to APRS-IS.
+var noGateHops = map[string]bool{"TCPIP": true, "TCPXX": true, "NOGATE": true, "RFONLY": true}
+
+// pathForbidsGating reports whether the path marks the packet as internet-sourced or RF-only.
+func pathForbidsGating(path []string) bool {
+	for _, hop := range path {
+		if noGateHops[strings.TrimRight(strings.ToUpper(hop), "*")] {
+			return true
+		}
+	}
+	return false
+}
+
+// RFToIS applies the RF-to-internet rules to a frame heard on RF and hands the
+// line for APRS-IS, with the qAR construct, to queue. It returns that line, or
+// "" if it must not be gated or queue refused it; a refused packet is not
+// remembered, so a later copy may still be gated.
+func (g *IGate) RFToIS(f Frame, gateway string, queue func(line string) error) string {
+	src, dst, path, info, ok := splitTNC2(f.Line)
+	if !ok {
+		return ""
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	g.heard.add(strings.ToUpper(src), struct{}{}, now)
+
+	// Generic queries are answered locally, never gated.
+	if strings.HasPrefix(info, "?") || pathForbidsGating(path) {
+		g.stats.Rejected++
+		return ""
+	}
+	// Third-party packets: gate the inner packet unless it came from the internet.
+	if strings.HasPrefix(info, "}") {
+		var innerOK bool
+		src, dst, path, info, innerOK = splitTNC2(info[1:])
+		if !innerOK || pathForbidsGating(path) {
+			g.stats.Rejected++
+			return ""
+		}
+	}
+	key := "is|" + src + ">" + dst + ":" + info
+	if g.gated.has(key, now) {
+		g.stats.Duplicates++
+		return ""
+	}
+
+	hops := append([]string{dst}, path...)
+	is := src + ">" + strings.Join(hops, ",") + ",qAR," + gateway + ":" + info
+	if err := queue(is); err != nil {
+		log.Printf("[IGATE] APRS-IS send not queued: %v", err)
+		return ""
+	}
+	g.gated.add(key, struct{}{}, now)
+	g.stats.GatedToIS++
+	return is
+}
+
+// HeardOnRF reports whether callsign was heard on RF within the heard window.
+func (g *IGate) HeardOnRF(callsign string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.heard.has(strings.ToUpper(callsign), g.now())
+}
+
+// ISToRF applies the internet-to-RF messaging rules to a TNC2 line from APRS-IS
+// (or sent by the gateway itself) and hands the third-party packet to transmit
+// to queue. It returns that packet, or "" if it must not go to RF or queue
+// refused it. Only messages whose addressee was heard on RF recently, and whose
+// sender was not, are gated. The transmit budget is spent only once queued.
+func (g *IGate) ISToRF(line string, queue func(line string) error) string {
+	msg, err := ParseMessagePacket(line)
+	if err != nil || msg.Format != "message" || msg.Addressee == "" {
+		return ""
+	}
+	cfg := config.Get()
+	src, dst, _, info, ok := splitTNC2(line)
+	if ok && strings.HasPrefix(info, "}") && strings.EqualFold(src, cfg.Gateway.Callsign) {
+		// Our own third-party wrapped packet: gate what it carries.
+		src, dst, _, info, ok = splitTNC2(info[1:])
+	}
+	if !ok || strings.HasPrefix(info, "}") {
+		return ""
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	if !g.heard.has(strings.ToUpper(msg.Addressee), now) {
+		return "" // Addressee not local
+	}
+	if g.heard.has(strings.ToUpper(src), now) {
+		g.stats.Rejected++ // Sender is on RF too; they can hear each other
+		return ""
+	}
+
+	key := "rf|" + src + ":" + info
+	if g.gated.has(key, now) {
+		g.stats.Duplicates++
+		return ""
+	}
+	if !g.budgetLeftLocked(now, cfg.IGate) {
+		g.stats.OverBudget++
+		log.Printf("[IGATE] RF transmit budget exhausted, not gating %s", line)
+		return ""
+	}
+
+	rf, err := WrapThirdParty(cfg.Gateway.Callsign, cfg.Gateway.ToCall, config.SplitList(cfg.IGate.RFPath),
+		src+">"+dst+":"+info, TransportRF)
+	if err != nil {
+		log.Printf("[IGATE] Cannot gate %s to RF: %v", line, err)
+		return ""
+	}
+	if err := queue(rf); err != nil {
+		log.Printf("[IGATE] RF transmit not queued: %v", err)
+		return ""
+	}
+	g.gated.add(key, struct{}{}, now)
+	g.txTimes = append(g.txTimes, now)
+	g.stats.GatedToRF++
+	return rf
+}
+
+// budgetLeftLocked forgets RF transmissions older than the budget window and
+// reports whether another one fits.
+func (g *IGate) budgetLeftLocked(now time.Time, cfg config.IGateConfig) bool {
+	cutoff := now.Add(-cfg.TxWindow.D())
+	kept := g.txTimes[:0]
+	for _, t := range g.txTimes {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	g.txTimes = kept
+	return cfg.TxBudget <= 0 || len(g.txTimes) < cfg.TxBudget
+}
+
+// Stats returns the IGate counters.
+func (g *IGate) Stats() IGateStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cfg := config.Get().IGate
+	st := g.stats
+	st.Enabled = cfg.Enabled
+	st.HeardOnRF = g.heard.len()
+	st.BudgetUsed = len(g.txTimes)
+	st.BudgetLimit = cfg.TxBudget
+	return st
+}
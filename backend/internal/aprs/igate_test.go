@@ -0,0 +1,162 @@
+package aprs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprstest"
+	"aprsmessenger-gateway/internal/config"
+)
+
+// queued accepts every gated packet.
+func queued(line string) error { return nil }
+
+// TestIGateRFToIS tests the qAR construct and the RF-to-internet gating rules
+func TestIGateRFToIS(t *testing.T) {
+	g := NewIGate()
+	rf := func(line string) Frame { return Frame{Line: line, Kind: TransportRF} }
+
+	got := g.RFToIS(rf("N0CALL-9>APRS,WIDE1-1*::AD8NT    :Hi{1"), "K8SDR-10", queued)
+	expected := "N0CALL-9>APRS,WIDE1-1*,qAR,K8SDR-10::AD8NT    :Hi{1"
+	if got != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, got)
+	}
+	if dup := g.RFToIS(rf("N0CALL-9>APRS,WIDE1-1*::AD8NT    :Hi{1"), "K8SDR-10", queued); dup != "" {
+		t.Fatalf("Duplicate was gated: '%s'", dup)
+	}
+
+	for _, line := range []string{
+		"N0CALL-9>APRS,TCPIP*::AD8NT    :x",
+		"N0CALL-9>APRS,NOGATE::AD8NT    :x",
+		"N0CALL-9>APRS:?APRS?",
+		"K8SDR-10>APZAMG,WIDE1-1*:}AD8NT>APRS,TCPIP,K8SDR-10*::N0CALL-9 :x",
+	} {
+		if out := g.RFToIS(rf(line), "K8SDR-10", queued); out != "" {
+			t.Fatalf("Expected %q not to be gated, got '%s'", line, out)
+		}
+	}
+
+	// Third-party from an RF-only network is unwrapped and gated.
+	got = g.RFToIS(rf("W1AW>APRS:}N0CALL-5>APRS,W1AW*::AD8NT    :Yo"), "K8SDR-10", queued)
+	expected = "N0CALL-5>APRS,W1AW*,qAR,K8SDR-10::AD8NT    :Yo"
+	if got != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, got)
+	}
+}
+
+// TestIGateISToRF tests that only messages for stations heard on RF are gated, wrapped as third-party
+func TestIGateISToRF(t *testing.T) {
+	g := NewIGate()
+	now := time.Now()
+	g.now = func() time.Time { return now }
+	msg := "AD8NT>APRS,TCPIP*,qAC,T2TEST::N0CALL-9 :Hello{3"
+
+	if out := g.ISToRF(msg, queued); out != "" {
+		t.Fatalf("Gated to a station never heard on RF: '%s'", out)
+	}
+	g.RFToIS(Frame{Line: "N0CALL-9>APRS,WIDE1-1*:>on the air", Kind: TransportRF}, "K8SDR-10", queued)
+	if !g.HeardOnRF("n0call-9") {
+		t.Fatal("Expected N0CALL-9 to be heard on RF")
+	}
+
+	got := g.ISToRF(msg, queued)
+	expected := "K8SDR-10>APZAMG,WIDE1-1:}AD8NT>APRS,TCPIP,K8SDR-10*::N0CALL-9 :Hello{3"
+	if got != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, got)
+	}
+	if dup := g.ISToRF(msg, queued); dup != "" {
+		t.Fatalf("Duplicate was gated: '%s'", dup)
+	}
+	if pos := g.ISToRF("AD8NT>APRS,TCPIP*,qAC,T2TEST:!4237.14N/07120.83W#", queued); pos != "" {
+		t.Fatalf("Position was gated to RF: '%s'", pos)
+	}
+
+	// The heard window expires.
+	now = now.Add(31 * time.Minute)
+	if out := g.ISToRF("AD8NT>APRS,TCPIP*,qAC,T2TEST::N0CALL-9 :Later{4", queued); out != "" {
+		t.Fatalf("Gated after heard window expired: '%s'", out)
+	}
+}
+
+// TestIGateTxBudget tests that RF transmissions stop once the budget is spent
+func TestIGateTxBudget(t *testing.T) {
+	g := NewIGate()
+	now := time.Now()
+	g.now = func() time.Time { return now }
+	g.RFToIS(Frame{Line: "N0CALL-9>APRS:>here", Kind: TransportRF}, "K8SDR-10", queued)
+
+	sent := 0
+	for i := 0; i < 15; i++ {
+		if g.ISToRF("AD8NT>APRS,TCPIP*::N0CALL-9 :msg{"+string(rune('A'+i)), queued) != "" {
+			sent++
+		}
+	}
+	if sent != 10 {
+		t.Fatalf("Expected the default budget of 10 transmissions, got %d", sent)
+	}
+	if st := g.Stats(); st.OverBudget != 5 {
+		t.Fatalf("Expected 5 over budget, got %d", st.OverBudget)
+	}
+	now = now.Add(2 * time.Minute)
+	if g.ISToRF("AD8NT>APRS,TCPIP*::N0CALL-9 :again{Z", queued) == "" {
+		t.Fatal("Budget did not refill after the window")
+	}
+}
+
+// TestIGateQueueRefused tests that a packet the scheduler refuses spends neither the budget nor the dedup slot
+func TestIGateQueueRefused(t *testing.T) {
+	g := NewIGate()
+	now := time.Now()
+	g.now = func() time.Time { return now }
+	refuse := func(string) error { return errors.New("queue full") }
+	g.RFToIS(Frame{Line: "N0CALL-9>APRS:>here", Kind: TransportRF}, "K8SDR-10", queued)
+
+	for i := 0; i < 15; i++ {
+		if out := g.ISToRF("AD8NT>APRS,TCPIP*::N0CALL-9 :msg{1", refuse); out != "" {
+			t.Fatalf("Refused packet reported as gated: '%s'", out)
+		}
+	}
+	if g.ISToRF("AD8NT>APRS,TCPIP*::N0CALL-9 :msg{1", queued) == "" {
+		t.Fatal("Refused packets spent the budget or the dedup slot")
+	}
+	if st := g.Stats(); st.BudgetUsed != 1 || st.GatedToRF != 1 {
+		t.Fatalf("Expected 1 transmission counted, got %+v", st)
+	}
+
+	line := Frame{Line: "N0CALL-5>APRS,WIDE1-1*::AD8NT    :Hi{2", Kind: TransportRF}
+	if out := g.RFToIS(line, "K8SDR-10", refuse); out != "" {
+		t.Fatalf("Refused packet reported as gated: '%s'", out)
+	}
+	if g.RFToIS(line, "K8SDR-10", queued) == "" {
+		t.Fatal("Refused packet spent the dedup slot")
+	}
+}
+
+// TestGateToISBusyChannel tests that a burst of RF traffic is all gated, paced only by the global rate
+func TestGateToISBusyChannel(t *testing.T) {
+	if err := config.Init("", func(c *config.Config) { c.IGate.Enabled = true }); err != nil {
+		t.Fatalf("config.Init: %v", err)
+	}
+	defer config.Init("", nil)
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	am := NewAPRSManagerWithOptions(ManagerOptions{Clock: clock})
+	tr := &captureTransport{sent: make(chan string, 64)}
+	am.transports = append(am.transports, tr)
+
+	const frames = 30
+	for i := 0; i < frames; i++ {
+		am.gateToIS(Frame{Line: fmt.Sprintf("N0RF-%d>APRS,WIDE1-1*:>status %d", i%3, i), Kind: TransportRF})
+	}
+	for i := 0; i < 60 && len(tr.sent) < frames; i++ {
+		am.outbound.sendReady()
+		clock.Advance(time.Second)
+	}
+	if st := am.outbound.Stats(); len(tr.sent) != frames || st.Dropped != 0 {
+		t.Fatalf("Expected all %d frames gated and none dropped, got %d sent and %+v", frames, len(tr.sent), st)
+	}
+	if st := am.igate.Stats(); st.GatedToIS != frames {
+		t.Fatalf("Expected %d gated to APRS-IS, got %d", frames, st.GatedToIS)
+	}
+}
@@ -0,0 +1,337 @@
+package aprs
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+)
+
+// ISServer speaks the APRS-IS client protocol so members can point APRSdroid,
+// Xastir or YAAC at the gateway and message through their account.
+type ISServer struct {
+	am      *APRSManager
+	mu      sync.Mutex
+	clients map[string]map[*isClient]struct{} // Base callsign -> logged-in clients
+	count   int                               // Open connections, logged in or not
+	ln      net.Listener
+}
+
+// isClient is one logged-in APRS app.
+type isClient struct {
+	*isConn
+	callsign string // Login callsign, with SSID
+}
+
+// NewISServer creates a server that forwards client packets through am.
+func NewISServer(am *APRSManager) *ISServer {
+	return &ISServer{am: am, clients: make(map[string]map[*isClient]struct{})}
+}
+
+// ListenAndServe listens on addr and serves clients until Close is called.
+func (s *ISServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts clients on ln until it is closed.
+func (s *ISServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	log.Printf("[ISSERVER] Listening for APRS clients on %s", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting clients and disconnects the ones logged in.
+func (s *ISServer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	for _, set := range s.clients {
+		for c := range set {
+			c.Close()
+		}
+	}
+}
+
+// serverName is what we call ourselves in logresp and keepalive lines.
+func serverName() string {
+	return config.Get().Gateway.Callsign
+}
+
+// parseLogin parses "user CALL pass NNNNN vers NAME VER filter ...".
+func parseLogin(line string) (callsign, passcode, filter string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "user") {
+		return "", "", "", false
+	}
+	callsign = strings.ToUpper(fields[1])
+	for i := 2; i < len(fields); i++ {
+		switch strings.ToLower(fields[i]) {
+		case "pass":
+			if i+1 < len(fields) {
+				passcode = fields[i+1]
+				i++
+			}
+		case "filter":
+			filter = strings.Join(fields[i+1:], " ")
+			i = len(fields)
+		}
+	}
+	return callsign, passcode, filter, true
+}
+
+// authenticate reports whether callsign belongs to a registered user and passcode is its APRS-IS passcode.
+func authenticate(callsign, passcode string) bool {
+	base := baseCallsign(callsign)
+	user, err := db.GetUserByCallsign(base)
+	if err != nil {
+		log.Printf("[ISSERVER] Could not look up %s: %v", base, err)
+		return false
+	}
+	return user != nil && passcode == fmt.Sprintf("%d", GeneratePasscode(base))
+}
+
+// handle runs one client connection: login, then packets until it disconnects.
+func (s *ISServer) handle(conn net.Conn) {
+	cfg := config.Get().Server
+	c := &isClient{isConn: &isConn{conn: conn, r: bufio.NewReader(conn)}}
+	defer c.Close()
+
+	if !s.reserve(cfg.MaxClients) {
+		_ = c.writeLine("# Server full")
+		return
+	}
+	defer s.release()
+	if err := c.writeLine(fmt.Sprintf("# %s %s", softwareName, softwareVersion)); err != nil {
+		return
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(cfg.LoginTimeout.D()))
+	var passcode, filter string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		var ok bool
+		if c.callsign, passcode, filter, ok = parseLogin(line); !ok {
+			_ = c.writeLine("# Login by user not allowed")
+			return
+		}
+		break
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	if !authenticate(c.callsign, passcode) {
+		log.Printf("[ISSERVER] Rejected login for %s from %s", c.callsign, conn.RemoteAddr())
+		_ = c.writeLine(fmt.Sprintf("# logresp %s unverified, server %s", c.callsign, serverName()))
+		return
+	}
+	if err := c.writeLine(fmt.Sprintf("# logresp %s verified, server %s", c.callsign, serverName())); err != nil {
+		return
+	}
+	log.Printf("[ISSERVER] %s logged in from %s", c.callsign, conn.RemoteAddr())
+	if filter != "" {
+		s.refuseFilter(c, filter)
+	}
+
+	s.add(c)
+	defer s.remove(c)
+	done := make(chan struct{})
+	defer close(done)
+	go s.keepalive(c, done)
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			log.Printf("[ISSERVER] %s disconnected: %v", c.callsign, err)
+			return
+		}
+		if strings.HasPrefix(line, "#") {
+			if f, ok := strings.CutPrefix(line, "#filter"); ok {
+				s.refuseFilter(c, strings.TrimSpace(f))
+			}
+			continue
+		}
+		s.fromClient(c, line)
+	}
+}
+
+// keepalive writes a "# ..." line every keepalive interval, as APRS-IS servers do.
+func (s *ISServer) keepalive(c *isClient, done <-chan struct{}) {
+	ticker := time.NewTicker(config.Get().Server.Keepalive.D())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			line := fmt.Sprintf("# %s %s %s %s", softwareName, softwareVersion,
+				now.UTC().Format("2 Jan 2006 15:04:05 GMT"), serverName())
+			if err := c.writeLine(line); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// refuseFilter tells an app that its filter is ignored. The gateway is not a
+// feed: apps only get the messages for the callsign they logged in with.
+func (s *ISServer) refuseFilter(c *isClient, filter string) {
+	_ = c.writeLine(fmt.Sprintf("# filter %s not supported, only messages for %s are sent", filter, c.callsign))
+}
+
+// reserve takes a connection slot, reporting false when max are already taken.
+// max 0 is unlimited.
+func (s *ISServer) reserve(max int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if max > 0 && s.count >= max {
+		return false
+	}
+	s.count++
+	return true
+}
+
+// release returns a slot taken by reserve.
+func (s *ISServer) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count--
+}
+
+func (s *ISServer) add(c *isClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := baseCallsign(c.callsign)
+	if s.clients[base] == nil {
+		s.clients[base] = make(map[*isClient]struct{})
+	}
+	s.clients[base][c] = struct{}{}
+}
+
+func (s *ISServer) remove(c *isClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := baseCallsign(c.callsign)
+	if _, ok := s.clients[base][c]; !ok {
+		return
+	}
+	delete(s.clients[base], c)
+	if len(s.clients[base]) == 0 {
+		delete(s.clients, base)
+	}
+}
+
+// Connected reports whether any app is logged in with the base callsign.
+func (s *ISServer) Connected(base string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients[base]) > 0
+}
+
+// Deliver writes a packet to every app logged in with the base callsign.
+func (s *ISServer) Deliver(base, line string) {
+	s.mu.Lock()
+	clients := make([]*isClient, 0, len(s.clients[base]))
+	for c := range s.clients[base] {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+	for _, c := range clients {
+		if err := c.writeLine(line); err != nil {
+			log.Printf("[ISSERVER] Write to %s failed: %v", c.callsign, err)
+		}
+	}
+}
+
+// fromClient forwards a packet sent by a logged-in app. Apps may only send as
+// their own base callsign. The packet is rebuilt with a plain TCPIP* path, as
+// we pass it on as an APRS-IS client ourselves.
+func (s *ISServer) fromClient(c *isClient, line string) {
+	src, dst, _, info, ok := splitTNC2(line)
+	if !ok {
+		return
+	}
+	if baseCallsign(strings.ToUpper(src)) != baseCallsign(c.callsign) {
+		log.Printf("[ISSERVER] Dropping packet from %s with source %s", c.callsign, src)
+		return
+	}
+	line, err := BuildPacket(PacketSpec{Source: src, ToCall: dst, Payload: info}, TransportInternet)
+	if err != nil {
+		log.Printf("[ISSERVER] Dropping invalid packet from %s: %v", c.callsign, err)
+		return
+	}
+	if gw := config.Get().Gateway; gw.ThirdParty {
+		if line, err = WrapThirdParty(gw.Callsign, gw.ToCall, nil, line, TransportInternet); err != nil {
+			log.Printf("[ISSERVER] Could not wrap packet from %s: %v", c.callsign, err)
+			return
+		}
+	}
+
+	log.Printf("[ISSERVER] %s: %s", c.callsign, line)
+	msg, err := ParseMessagePacket(src + ">" + dst + ":" + info)
+	isMessage := err == nil && msg.IsUserMessage()
+
+	// Packets for other members are delivered here at once, and transmitted only if configured.
+	local := isMessage && isLocal(msg.Addressee)
+	if !local || config.Get().Outbound.TransmitLocal {
+		if err := s.am.enqueue(line, baseCallsign(c.callsign)); err != nil {
+			log.Printf("[ISSERVER] Could not forward packet from %s: %v", c.callsign, err)
+			return
+		}
+	}
+
+	// Keep the member's message history in step with what their app sent.
+	if !isMessage {
+		return
+	}
+	if msg.Response != "" {
+		if msg.Response == "ack" {
+			s.am.acks.heard(ackKey{toUpperNoSpace(msg.Source), toUpperNoSpace(msg.Addressee), msg.MsgNo})
+		}
+		if local {
+			s.am.deliverLocal(line)
+		}
+		return
+	}
+	_, body, _ := strings.Cut(info[1:], ":")
+	if msg.MsgNo != "" {
+		err = db.StoreSentMessage(msg.Addressee, msg.Source, body, msg.MsgNo)
+	} else {
+		err = db.StoreMessage(msg.Addressee, msg.Source, body)
+	}
+	if err != nil {
+		log.Printf("[DB] Failed to store message from %s: %v", msg.Source, err)
+	}
+	if session := GetSessionsManager().GetSession(baseCallsign(c.callsign)); session != nil {
+		session.BroadcastMessage(msg.Source, msg.Addressee, body, msg.Route(), nil)
+	}
+	// After storing, so the recipient shares the sender's row.
+	if local {
+		s.am.deliverLocal(line)
+	}
+}
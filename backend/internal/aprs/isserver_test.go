@@ -0,0 +1,141 @@
+package aprs
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/db"
+	"aprsmessenger-gateway/internal/models"
+)
+
+// captureTransport is an always-connected internet transport that records what is sent.
+type captureTransport struct {
+	sent chan string
+}
+
+func (c *captureTransport) Name() string                                 { return "capture" }
+func (c *captureTransport) Kind() TransportKind                          { return TransportInternet }
+func (c *captureTransport) Run(stop <-chan struct{}, host TransportHost) {}
+func (c *captureTransport) Send(tnc2 string) error                       { c.sent <- tnc2; return nil }
+func (c *captureTransport) State() TransportState {
+	return TransportState{Name: "capture", State: StateConnected}
+}
+
+// TestISServerLogin tests login, logresp, packet forwarding and delivery to a logged-in app
+func TestISServerLogin(t *testing.T) {
+	if u, _ := db.GetUserByCallsign("N0APP"); u == nil {
+		if err := db.CreateUser(&models.User{Callsign: "N0APP", PasswordHash: "x", Passcode: "0"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	am := NewAPRSManager()
+	tr := &captureTransport{sent: make(chan string, 4)}
+	am.transports = append(am.transports, tr)
+	stop := make(chan struct{})
+	defer close(stop)
+	go am.outbound.Run(stop)
+	srv := NewISServer(am)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	login := func(call string, pass int) (net.Conn, *bufio.Reader, string) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		r := bufio.NewReader(conn)
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		r.ReadString('\n') // Banner
+		fmt.Fprintf(conn, "user %s pass %d vers APRSdroid 1.6 filter m/10\r\n", call, pass)
+		resp, _ := r.ReadString('\n')
+		return conn, r, strings.TrimSpace(resp)
+	}
+
+	conn, _, resp := login("N0APP-7", 1)
+	conn.Close()
+	if !strings.Contains(resp, "N0APP-7 unverified") {
+		t.Fatalf("Expected unverified logresp for wrong passcode, got '%s'", resp)
+	}
+	conn, _, resp = login("N0NONE", int(GeneratePasscode("N0NONE")))
+	conn.Close()
+	if !strings.Contains(resp, "unverified") {
+		t.Fatalf("Expected unverified logresp for unregistered callsign, got '%s'", resp)
+	}
+
+	conn, r, resp := login("N0APP-7", int(GeneratePasscode("N0APP")))
+	defer conn.Close()
+	if !strings.HasPrefix(resp, "# logresp N0APP-7 verified, server ") {
+		t.Fatalf("Expected verified logresp, got '%s'", resp)
+	}
+	notice, _ := r.ReadString('\n')
+	if want := "# filter m/10 not supported, only messages for N0APP-7 are sent"; strings.TrimSpace(notice) != want {
+		t.Fatalf("Expected '%s', got '%s'", want, strings.TrimSpace(notice))
+	}
+
+	fmt.Fprint(conn, "N0APP-7>APDR16,TCPIP*::AD8NT    :Hello{5\r\n")
+	fmt.Fprint(conn, "W1AW>APDR16,TCPIP*::AD8NT    :spoofed\r\n")
+	select {
+	case line := <-tr.sent:
+		if line != "N0APP-7>APDR16,TCPIP*::AD8NT    :Hello{5" {
+			t.Fatalf("Unexpected forwarded packet '%s'", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Packet from app was not forwarded")
+	}
+	select {
+	case line := <-tr.sent:
+		t.Fatalf("Packet with someone else's source was forwarded: '%s'", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	for i := 0; i < 50 && !srv.Connected("N0APP"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	incoming := "AD8NT>APRS,TCPIP*,qAC,T2TEST::N0APP-7  :Hi back{7"
+	srv.Deliver("N0APP", incoming)
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	got, err := r.ReadString('\n')
+	if err != nil || strings.TrimSpace(got) != incoming {
+		t.Fatalf("Expected '%s' delivered to app, got '%s' (%v)", incoming, got, err)
+	}
+}
+
+// TestISServerReserve tests that connection slots are capped and given back
+func TestISServerReserve(t *testing.T) {
+	srv := NewISServer(NewAPRSManager())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if srv.reserve(3) {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 3 {
+		t.Fatalf("Expected 3 slots taken, got %d", taken)
+	}
+	srv.release()
+	if !srv.reserve(3) {
+		t.Fatalf("Expected a released slot to be free again")
+	}
+	if !srv.reserve(0) {
+		t.Fatalf("Expected no cap when max is 0")
+	}
+}
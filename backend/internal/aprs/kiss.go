@@ -0,0 +1,100 @@
+package aprs
+
+import (
+	"bufio"
+	"io"
+)
+
+// KISS special bytes.
+const (
+	kissFEND  = 0xC0
+	kissFESC  = 0xDB
+	kissTFEND = 0xDC
+	kissTFESC = 0xDD
+
+	kissCmdData = 0x00
+)
+
+// kissMaxFrame bounds a single KISS frame so a noisy link cannot grow a buffer forever.
+const kissMaxFrame = 2048
+
+// KISSEncode wraps an AX.25 frame in a KISS data frame for the given TNC port (0-15).
+func KISSEncode(port int, data []byte) []byte {
+	out := make([]byte, 0, len(data)+4)
+	out = append(out, kissFEND, byte(port&0x0F)<<4|kissCmdData)
+	for _, b := range data {
+		switch b {
+		case kissFEND:
+			out = append(out, kissFESC, kissTFEND)
+		case kissFESC:
+			out = append(out, kissFESC, kissTFESC)
+		default:
+			out = append(out, b)
+		}
+	}
+	return append(out, kissFEND)
+}
+
+// KISSFrame is one frame read from a KISS stream.
+type KISSFrame struct {
+	Port    int
+	Command int
+	Data    []byte
+}
+
+// KISSReader splits a byte stream into KISS frames.
+type KISSReader struct {
+	r       *bufio.Reader
+	inFrame bool // The last FEND may also open the next frame
+}
+
+// NewKISSReader returns a reader of KISS frames from r.
+func NewKISSReader(r io.Reader) *KISSReader {
+	return &KISSReader{r: bufio.NewReader(r)}
+}
+
+// ReadFrame returns the next non-empty frame, undoing FESC escaping.
+// Corrupt or oversized frames are skipped.
+func (k *KISSReader) ReadFrame() (*KISSFrame, error) {
+	var buf []byte
+	inFrame, escaped := k.inFrame, false
+	for {
+		b, err := k.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case b == kissFEND:
+			if inFrame && len(buf) > 0 {
+				k.inFrame = true
+				return &KISSFrame{
+					Port:    int(buf[0] >> 4),
+					Command: int(buf[0] & 0x0F),
+					Data:    buf[1:],
+				}, nil
+			}
+			// Back-to-back FENDs delimit an empty frame; keep waiting.
+			inFrame, escaped, buf = true, false, buf[:0]
+		case !inFrame:
+			// Noise before the first FEND.
+		case escaped:
+			escaped = false
+			switch b {
+			case kissTFEND:
+				buf = append(buf, kissFEND)
+			case kissTFESC:
+				buf = append(buf, kissFESC)
+			default:
+				// Corrupt frame: drop it and resync on the next FEND.
+				inFrame, buf = false, buf[:0]
+			}
+		case b == kissFESC:
+			escaped = true
+		default:
+			buf = append(buf, b)
+		}
+		if len(buf) > kissMaxFrame {
+			inFrame, buf = false, buf[:0]
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package aprs
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestKISSEscaping tests FEND/FESC escaping and port numbers
+func TestKISSEscaping(t *testing.T) {
+	data := []byte{0x01, kissFEND, 0x02, kissFESC, 0x03}
+	encoded := KISSEncode(2, data)
+	expected := []byte{kissFEND, 0x20, 0x01, kissFESC, kissTFEND, 0x02, kissFESC, kissTFESC, 0x03, kissFEND}
+	if !bytes.Equal(encoded, expected) {
+		t.Fatalf("Expected % x, got % x", expected, encoded)
+	}
+
+	// Two frames sharing a FEND, with noise before the first.
+	stream := append([]byte{0x55}, encoded...)
+	stream = append(stream, KISSEncode(0, []byte{0x09})[1:]...)
+	r := NewKISSReader(bytes.NewReader(stream))
+	f, err := r.ReadFrame()
+	if err != nil || f.Port != 2 || !bytes.Equal(f.Data, data) {
+		t.Fatalf("First frame decoded wrong: %+v %v", f, err)
+	}
+	f, err = r.ReadFrame()
+	if err != nil || f.Port != 0 || !bytes.Equal(f.Data, []byte{0x09}) {
+		t.Fatalf("Second frame decoded wrong: %+v %v", f, err)
+	}
+}
+
+type testHost struct {
+	frames chan Frame
+}
+
+func (h *testHost) Receive(f Frame)                { h.frames <- f }
+func (h *testHost) StateChanged(t PacketTransport) {}
+
+// TestKISSTransport tests receive and send against a local fake KISS server
+func TestKISSTransport(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	inbound := "N0CALL-9>APRS,WIDE1-1*::K8SDR    :Hello{1"
+	outbound := "K8SDR-10>APRS,WIDE2-1:}N0CALL>APRS,TCPIP,K8SDR-10*::AD8NT    :Hi"
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ax, _ := ParseTNC2(inbound)
+		conn.Write(KISSEncode(1, ax.Encode()))
+		f, err := NewKISSReader(conn).ReadFrame()
+		if err == nil {
+			received <- f.Data
+		}
+	}()
+
+	tr := NewKISSTransport("tnc", ln.Addr().String(), 1)
+	host := &testHost{frames: make(chan Frame, 1)}
+	stop := make(chan struct{})
+	defer close(stop)
+	go tr.Run(stop, host)
+
+	select {
+	case f := <-host.frames:
+		if f.Line != inbound || f.Kind != TransportRF {
+			t.Fatalf("Expected '%s' from RF, got '%s' (%s)", inbound, f.Line, f.Kind)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No frame received from fake KISS server")
+	}
+
+	if err := tr.Send(outbound); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case data := <-received:
+		ax, err := DecodeAX25(data)
+		if err != nil {
+			t.Fatalf("Fake server got undecodable frame: %v", err)
+		}
+		if ax.TNC2() != outbound {
+			t.Fatalf("Expected '%s', got '%s'", outbound, ax.TNC2())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Fake KISS server received nothing")
+	}
+}
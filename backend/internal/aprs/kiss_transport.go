@@ -0,0 +1,59 @@
+package aprs
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+// KISSTransport is a PacketTransport for a software TNC (e.g. Direwolf)
+// speaking KISS over TCP. Frames are converted between AX.25 and TNC2.
+type KISSTransport struct {
+	link *tncLink
+	port int
+}
+
+// NewKISSTransport creates a transport for the KISS TNC at addr, using TNC port port.
+func NewKISSTransport(name, addr string, port int) *KISSTransport {
+	return &KISSTransport{link: newTNCLink(name, addr, "KISS"), port: port}
+}
+
+// Name returns the transport's name.
+func (t *KISSTransport) Name() string { return t.link.name }
+
+// Kind reports that a KISS TNC is a radio link.
+func (t *KISSTransport) Kind() TransportKind { return TransportRF }
+
+// State returns the TCP link state.
+func (t *KISSTransport) State() TransportState { return t.link.snapshot() }
+
+// Run connects to the TNC and decodes received frames until stop is closed.
+func (t *KISSTransport) Run(stop <-chan struct{}, host TransportHost) {
+	t.link.run(stop, host, t, func(conn net.Conn) error {
+		r := NewKISSReader(conn)
+		for {
+			kf, err := r.ReadFrame()
+			if err != nil {
+				return err
+			}
+			if kf.Command != kissCmdData || kf.Port != t.port {
+				continue
+			}
+			ax, err := DecodeAX25(kf.Data)
+			if err != nil {
+				log.Printf("[KISS] %s: dropping undecodable frame: %v", t.Name(), err)
+				continue
+			}
+			host.Receive(Frame{Line: ax.TNC2(), Transport: t.Name(), Kind: TransportRF, Heard: time.Now()})
+		}
+	})
+}
+
+// Send encodes a TNC2 frame as AX.25 and writes it to the TNC.
+func (t *KISSTransport) Send(tnc2 string) error {
+	ax, err := ParseTNC2(tnc2)
+	if err != nil {
+		return err
+	}
+	return t.link.write(KISSEncode(t.port, ax.Encode()))
+}
@@ -0,0 +1,69 @@
+package aprs
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/db"
+)
+
+// isLocal reports whether callsign belongs to a member, so packets to it can
+// be delivered without leaving the gateway.
+func isLocal(callsign string) bool {
+	userSet, err := db.UserCallsignSet()
+	if err != nil {
+		log.Printf("[APRS] Unable to load user callsign set: %v", err)
+		return false
+	}
+	_, ok := userSet[baseCallsign(toUpperNoSpace(callsign))]
+	return ok
+}
+
+// deliverLocal hands a packet from one member to another straight to the
+// inbound stream, as if it had been received, and remembers it so the copy
+// heard back from APRS-IS or RF is ignored.
+func (am *APRSManager) deliverLocal(line string) {
+	msg, err := ParseMessagePacket(line)
+	if err != nil {
+		return
+	}
+	am.echoes.add(msg)
+	log.Printf("[APRS] Delivering locally: %s", line)
+	// Not on this goroutine: the caller may be the inbound loop itself.
+	go am.Receive(Frame{Line: line, Transport: "local", Kind: TransportLocal, Heard: am.clock.Now()})
+}
+
+// echoSet remembers packets delivered locally until their transmitted
+// copies have had time to come back.
+type echoSet struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	sent *expiringSet[string, struct{}]
+}
+
+func newEchoSet(now func() time.Time) *echoSet {
+	return &echoSet{now: now, sent: newExpiringSet[string, struct{}](retryWindow[string])}
+}
+
+// echoKey identifies a message or response regardless of the path it took.
+func echoKey(msg *MessagePacket) string {
+	return strings.Join([]string{
+		toUpperNoSpace(msg.Source), toUpperNoSpace(msg.Addressee),
+		msg.Response, msg.MsgNo, msg.AckMsgNo, msg.MessageText,
+	}, "|")
+}
+
+func (e *echoSet) add(msg *MessagePacket) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sent.add(echoKey(msg), struct{}{}, e.now())
+}
+
+// seen reports whether msg is the echo of a packet delivered locally.
+func (e *echoSet) seen(msg *MessagePacket) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sent.has(echoKey(msg), e.now())
+}
@@ -0,0 +1,27 @@
+package aprs
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aprsmessenger-gateway/internal/db"
+)
+
+// TestMain opens a throwaway database for the tests in this directory and
+// removes it once they have run.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "aprsmsg-test")
+	if err != nil {
+		log.Fatalf("temp dir: %v", err)
+	}
+	if err := db.Init(filepath.Join(dir, "test.db")); err != nil {
+		os.RemoveAll(dir)
+		log.Fatalf("db.Init: %v", err)
+	}
+	code := m.Run()
+	db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -1,25 +1,52 @@
 package aprs
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
 	"time"
 
+	"aprsmessenger-gateway/internal/config"
 	"aprsmessenger-gateway/internal/db"
 )
 
-import aprsis "github.com/dustin/go-aprs/aprsis"
+// errConnectionInactive is returned when there is no live connection to send on.
+var errConnectionInactive = errors.New("APRS connection is not active")
 
-// APRSManager manages APRS-IS connections and message callbacks.
+// APRSManager manages the packet transports and message callbacks.
 type APRSManager struct {
-	conn      *aprsis.APRSIS
-	connMu    sync.RWMutex
-	stopCh    chan struct{}
-	callbacks map[string]func(from, to, msg string, path []string) // Updated callback
-	users     map[string]struct{}
-	setMu     sync.RWMutex
+	transports   []PacketTransport
+	transportsMu sync.RWMutex
+	started      bool       // Start has run; guarded by transportsMu
+	inbound      chan Frame // Merged stream from every transport
+	stopCh       chan struct{}
+	callbacks    map[string]func(from, to, msg string, path []string) // Updated callback
+	users        map[string]struct{}
+	setMu        sync.RWMutex
+	igate        *IGate
+	server       *ISServer // APRS-IS-compatible port for members' apps; nil when disabled
+	servers      []string  // APRS-IS servers from ManagerOptions; nil follows the config
+	clock        Clock
+	outbound     *Scheduler
+	outbox       *Outbox
+	parts        *reassembler // Multipart messages waiting for their other parts
+	dedup        *dedupCache  // Received messages, to store copies once
+	acks         *ackWatch    // Acks members' stations sent, so we do not ack for them
+	echoes       *echoSet     // Packets delivered locally, whose transmitted copies we ignore
+	stations     *stationLog  // Stations heard on the feed, waiting to be written
+	objects      *objectLog   // Objects and items heard on the feed
+	policyMu     sync.Mutex
+	policyPruned time.Time // Last time old refusals were deleted
+	stopOnce     sync.Once
+}
+
+// ManagerOptions replaces settings an APRSManager otherwise takes from the
+// config and the system clock. The zero value uses both.
+type ManagerOptions struct {
+	Servers []string // APRS-IS servers (host:port) to connect to
+	Clock   Clock
 }
 
 var (
@@ -38,252 +65,557 @@ func GetAPRSManager() *APRSManager {
 
 // NewAPRSManager creates a new APRSManager instance.
 func NewAPRSManager() *APRSManager {
-	return &APRSManager{
+	return NewAPRSManagerWithOptions(ManagerOptions{})
+}
+
+// NewAPRSManagerWithOptions creates an APRSManager with injected servers and clock.
+func NewAPRSManagerWithOptions(opts ManagerOptions) *APRSManager {
+	clock := opts.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	igate := NewIGate()
+	igate.now = clock.Now
+	am := &APRSManager{
 		callbacks: make(map[string]func(from, to, msg string, path []string)), // Updated callback
 		users:     make(map[string]struct{}),
+		inbound:   make(chan Frame, 256),
 		stopCh:    make(chan struct{}),
+		igate:     igate,
+		servers:   append([]string(nil), opts.Servers...),
+		clock:     clock,
+	}
+	am.outbound = NewScheduler(clock, am.transmit)
+	am.outbox = NewOutbox(am)
+	am.parts = newReassembler(clock.Now)
+	am.dedup = newDedupCache(clock.Now)
+	am.acks = newAckWatch(clock.Now)
+	am.echoes = newEchoSet(clock.Now)
+	am.stations = newStationLog(clock.Now)
+	am.objects = newObjectLog(clock.Now)
+	return am
+}
+
+// AddTransport attaches a transport. Transports added before Start are started
+// with it; later ones start immediately.
+func (am *APRSManager) AddTransport(t PacketTransport) {
+	am.transportsMu.Lock()
+	am.transports = append(am.transports, t)
+	started := am.started
+	am.transportsMu.Unlock()
+	if ft, ok := t.(filterableTransport); ok {
+		if filters, err := am.currentFilters(); err == nil {
+			ft.SetFilters(filters)
+		}
+	}
+	log.Printf("[APRS] Added %s transport %s", t.Kind(), t.Name())
+	if started {
+		go t.Run(am.stopCh, am)
 	}
 }
 
+// Transports returns the attached transports.
+func (am *APRSManager) Transports() []PacketTransport {
+	am.transportsMu.RLock()
+	defer am.transportsMu.RUnlock()
+	return append([]PacketTransport(nil), am.transports...)
+}
+
 // Start starts the APRSManager's background routines.
+// With no transports attached, it connects to APRS-IS using the configured
+// servers plus every configured TNC.
 func (am *APRSManager) Start() {
+	if len(am.Transports()) == 0 {
+		am.AddTransport(NewAPRSISTransport("aprs-is", am.servers, am.clock))
+		for _, tc := range config.Get().TNCs {
+			t, err := NewTNCTransport(tc)
+			if err != nil {
+				log.Printf("[APRS] Skipping TNC %s: %v", tc.Name, err)
+				continue
+			}
+			am.AddTransport(t)
+		}
+	}
+	if addr := config.Get().Server.Listen; addr != "" {
+		am.server = NewISServer(am)
+		go func() {
+			if err := am.server.ListenAndServe(addr); err != nil {
+				log.Printf("[ISSERVER] Stopped: %v", err)
+			}
+		}()
+	}
+	config.OnReload(am.onConfigReload)
+	am.startTransports()
+	go am.outbound.Run(am.stopCh)
+	go am.outbox.Run(am.stopCh)
+	go am.stations.Run(am.clock, am.stopCh)
 	go am.run()
 }
 
-// SendMessage formats and sends an APRS message using the manager's connection.
-// fromCallsign: the sending user's callsign (e.g. "OURUSER")
-// recipientCallsign: the recipient's callsign (e.g. "RXUSER")
-// message: the message text
-func (am *APRSManager) SendMessage(fromCallsign, recipientCallsign, message string) error {
-	// APRS message payload is limited to 67 characters
-	if len(message) > 67 {
-		message = message[:67]
+// startTransports runs the attached transports and has AddTransport run any
+// attached later.
+func (am *APRSManager) startTransports() {
+	am.transportsMu.Lock()
+	am.started = true
+	transports := append([]PacketTransport(nil), am.transports...)
+	am.transportsMu.Unlock()
+	for _, t := range transports {
+		go t.Run(am.stopCh, am)
 	}
+}
 
-	// Recipient must be 9 chars, space-padded on the right.
-	paddedRecipient := fmt.Sprintf("%-9s", strings.ToUpper(recipientCallsign))
+// Stop shuts down every transport and the embedded server.
+func (am *APRSManager) Stop() {
+	am.stopOnce.Do(func() {
+		close(am.stopCh)
+		if am.server != nil {
+			am.server.Close()
+		}
+	})
+}
 
-	// Construct path: always use our gateway as the last hop
-	// e.g., OURUSER>APRS,K8SDR*,qAC,K8SDR-10::RXUSER   :message
-	const viaPath = "APRS,K8SDR*,qAC,K8SDR-10"
+// Receive implements TransportHost by merging frames into the inbound stream.
+func (am *APRSManager) Receive(f Frame) {
+	select {
+	case am.inbound <- f:
+	case <-am.stopCh:
+	}
+}
 
-	// Format the APRS message packet
-	packet := fmt.Sprintf("%s>%s::%s:%s", fromCallsign, viaPath, paddedRecipient, message)
+// StateChanged implements TransportHost by pushing the new status to clients
+// and letting the outbox flush on reconnect.
+func (am *APRSManager) StateChanged(t PacketTransport) {
+	am.notifyStatus()
+	am.outbox.Wake()
+}
 
-	// Print the raw packet being sent (including for ACKs)
-	log.Printf("[APRS RAW PACKET] %s", packet)
+// onConfigReload reconnects APRS-IS when the login identity or server list
+// changes, so the transports log in again with the new settings.
+func (am *APRSManager) onConfigReload(old, new *config.Config) {
+	if old.Gateway.Callsign == new.Gateway.Callsign &&
+		old.Gateway.Passcode == new.Gateway.Passcode &&
+		strings.Join(old.APRSIS.Servers, ",") == strings.Join(new.APRSIS.Servers, ",") {
+		return
+	}
+	log.Printf("[APRS] APRS-IS settings changed, reconnecting")
+	for _, t := range am.Transports() {
+		if ist, ok := t.(*APRSISTransport); ok {
+			ist.Reconnect("configuration changed")
+		}
+	}
+}
 
-	am.connMu.RLock()
-	defer am.connMu.RUnlock()
+// GatewayStatus describes the gateway's transports and their health.
+type GatewayStatus struct {
+	Callsign   string           `json:"callsign"`
+	Connected  bool             `json:"connected"` // Whether any internet transport can send
+	Transports []TransportState `json:"transports"`
+	IGate      IGateStats       `json:"igate"`
+	Outbound   SchedulerStats   `json:"outbound"`
+}
 
-	if am.conn == nil {
-		return fmt.Errorf("APRS connection is not active")
+// Status returns a snapshot of which transports and servers we are on and why.
+func (am *APRSManager) Status() GatewayStatus {
+	st := GatewayStatus{Callsign: config.Get().Gateway.Callsign, IGate: am.igate.Stats(), Outbound: am.outbound.Stats()}
+	for _, t := range am.Transports() {
+		ts := t.State()
+		st.Transports = append(st.Transports, ts)
+		if ts.Kind == TransportInternet && ts.State == StateConnected {
+			st.Connected = true
+		}
 	}
+	return st
+}
 
-	log.Printf("[APRS SEND] Sending: %s", packet)
-	return am.conn.SendRawPacket("%s", packet)
+// notifyStatus pushes the current gateway status to every attached client.
+func (am *APRSManager) notifyStatus() {
+	GetSessionsManager().BroadcastToAll(map[string]interface{}{
+		"type":   "gateway_status",
+		"status": am.Status(),
+	})
 }
 
-// --- Begin: Message Delivery State & Deduplication ---
+// currentFilters builds the server-side filters for all registered users.
+func (am *APRSManager) currentFilters() ([]string, error) {
+	userSet, err := db.UserCallsignSet()
+	if err != nil {
+		return nil, err
+	}
+	callsigns := make([]string, 0, len(userSet))
+	for cs := range userSet {
+		callsigns = append(callsigns, cs)
+	}
+	return BuildFilters(config.Get().Gateway.Callsign, callsigns, maxFilterLength), nil
+}
 
-// For deduplication and delivery state (shared with ws package)
-type deliveryState struct {
-	mu        sync.Mutex
-	lastMsgId map[string]map[string]string // myCallsign -> contact -> last received messageId
-	retries   map[string]map[string]map[string]int // myCallsign -> contact -> msgId -> retry count
+// RefreshFilter rebuilds the APRS-IS filter from the user table and pushes it to
+// every transport that supports server-side filters. Call it whenever users
+// register or delete their accounts.
+func (am *APRSManager) RefreshFilter() {
+	filters, err := am.currentFilters()
+	if err != nil {
+		log.Printf("[APRS] Unable to build filter from user list: %v", err)
+		return // Keep the current filters rather than losing traffic
+	}
+	for _, t := range am.Transports() {
+		if ft, ok := t.(filterableTransport); ok {
+			ft.SetFilters(filters)
+		}
+	}
 }
 
-var globalDeliveryState = &deliveryState{
-	lastMsgId: make(map[string]map[string]string),
-	retries:   make(map[string]map[string]map[string]int),
+// sendPacket transmits a TNC2 packet on every connected transport of the given kind.
+// It succeeds if at least one transport accepted the packet.
+func (am *APRSManager) sendPacket(packet string, kind TransportKind) error {
+	err := errConnectionInactive
+	sent := false
+	for _, t := range am.Transports() {
+		if t.Kind() != kind {
+			continue
+		}
+		if serr := t.Send(packet); serr != nil {
+			log.Printf("[APRS] %s: send failed: %v", t.Name(), serr)
+			err = serr
+			continue
+		}
+		sent = true
+	}
+	if sent {
+		return nil
+	}
+	return err
 }
 
-func (ds *deliveryState) updateLastReceived(myCall, contact, msgId string) {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	if ds.lastMsgId[myCall] == nil {
-		ds.lastMsgId[myCall] = make(map[string]string)
+// internetUp reports whether any internet transport is connected.
+func (am *APRSManager) internetUp() bool {
+	for _, t := range am.Transports() {
+		if t.Kind() == TransportInternet && t.State().State == StateConnected {
+			return true
+		}
 	}
-	ds.lastMsgId[myCall][contact] = msgId
+	return false
 }
 
-func (ds *deliveryState) getLastReceived(myCall, contact string) string {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	if ds.lastMsgId[myCall] == nil {
-		return ""
+// transmit sends a packet the scheduler released. Packets for APRS-IS are also
+// offered to the IGate so stations only on our RF channel hear them, unless
+// the IGate gated them from RF in the first place.
+func (am *APRSManager) transmit(p OutboundPacket) error {
+	err := am.sendPacket(p.Line, p.Kind)
+	if p.Kind == TransportInternet && !p.Gated {
+		am.gateToRF(p.Line)
 	}
-	return ds.lastMsgId[myCall][contact]
+	return err
 }
 
-func (ds *deliveryState) incRetry(myCall, contact, msgId string) int {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	if ds.retries[myCall] == nil {
-		ds.retries[myCall] = make(map[string]map[string]int)
+// priorityOf puts acks and rejs ahead of messages.
+func priorityOf(line string) Priority {
+	if msg, err := ParseMessagePacket(line); err == nil && msg.Response != "" {
+		return PriorityAck
 	}
-	if ds.retries[myCall][contact] == nil {
-		ds.retries[myCall][contact] = make(map[string]int)
+	return PriorityMessage
+}
+
+// enqueue hands a packet from user to the outbound scheduler, ahead of
+// messages if it is an ack or rej.
+func (am *APRSManager) enqueue(line, user string) error {
+	return am.outbound.Enqueue(OutboundPacket{Line: line, Kind: TransportInternet, User: user, Priority: priorityOf(line)})
+}
+
+// loginPasscode returns the configured passcode, or computes it from the callsign.
+func loginPasscode(gw config.GatewayConfig) string {
+	if gw.Passcode != "" {
+		return gw.Passcode
+	}
+	return fmt.Sprintf("%d", GeneratePasscode(gw.Callsign))
+}
+
+// buildMessage renders a message for APRS-IS, third-party wrapped when
+// configured and the sender is not the gateway itself.
+func buildMessage(fromCallsign, recipientCallsign, message string) (string, error) {
+	gw := config.Get().Gateway
+	packet, err := BuildPacket(PacketSpec{
+		Source:    fromCallsign,
+		ToCall:    gw.ToCall,
+		Addressee: recipientCallsign,
+		Payload:   message,
+	}, TransportInternet)
+	if err != nil {
+		return "", err
 	}
-	ds.retries[myCall][contact][msgId]++
-	return ds.retries[myCall][contact][msgId]
+	// Members are not logged in themselves; optionally say so by wrapping.
+	if gw.ThirdParty && baseCallsign(toUpperNoSpace(fromCallsign)) != baseCallsign(gw.Callsign) {
+		return WrapThirdParty(gw.Callsign, gw.ToCall, nil, packet, TransportInternet)
+	}
+	return packet, nil
 }
 
-// --- End: Message Delivery State & Deduplication ---
+// SendMessage builds an APRS message from fromCallsign to recipientCallsign
+// and queues it for APRS-IS. message is the message body, including any
+// {msgno}; a BuildError is returned if it cannot be sent as-is.
+func (am *APRSManager) SendMessage(fromCallsign, recipientCallsign, message string) error {
+	packet, err := buildMessage(fromCallsign, recipientCallsign, message)
+	if err != nil {
+		return err
+	}
+
+	// Print the raw packet being sent (including for ACKs)
+	log.Printf("[APRS RAW PACKET] %s", packet)
+
+	// Between members the packet is delivered here at once; transmitting it
+	// as well only makes it visible on APRS.
+	if isLocal(recipientCallsign) {
+		am.deliverLocal(packet)
+		if !config.Get().Outbound.TransmitLocal || !am.internetUp() {
+			return nil
+		}
+	}
 
-// run connects to APRS-IS and processes incoming packets.
+	if !am.internetUp() {
+		return errConnectionInactive
+	}
+	log.Printf("[APRS SEND] Queuing: %s", packet)
+	return am.enqueue(packet, baseCallsign(toUpperNoSpace(fromCallsign)))
+}
+
+// gateToRF transmits an internet message on RF if the IGate is enabled and the
+// addressee was recently heard locally.
+func (am *APRSManager) gateToRF(line string) {
+	if !config.Get().IGate.Enabled {
+		return
+	}
+	if rf := am.igate.ISToRF(line, am.queueGated(TransportRF)); rf != "" {
+		log.Printf("[IGATE] IS->RF: %s", rf)
+	}
+}
+
+// gateToIS forwards a frame heard on RF to APRS-IS if the IGate is enabled.
+func (am *APRSManager) gateToIS(f Frame) {
+	if !config.Get().IGate.Enabled {
+		return
+	}
+	if is := am.igate.RFToIS(f, config.Get().Gateway.Callsign, am.queueGated(TransportInternet)); is != "" {
+		log.Printf("[IGATE] RF->IS: %s", is)
+	}
+}
+
+// queueGated returns a function that queues a gated packet for transports of
+// kind. Gated packets belong to no member, so no member's limits apply.
+func (am *APRSManager) queueGated(kind TransportKind) func(line string) error {
+	return func(line string) error {
+		return am.outbound.Enqueue(OutboundPacket{Line: line, Kind: kind, Gated: true, Priority: priorityOf(line)})
+	}
+}
+
+// run processes the merged inbound stream from all transports.
 func (am *APRSManager) run() {
 	for {
-		log.Printf("[APRS] Connecting to APRS-IS as K8SDR-10")
-		conn, err := aprsis.Dial("tcp", "rotate.aprs.net:10152")
-		if err != nil {
-			log.Printf("[APRS] Connect failed for K8SDR-10: %v. Retrying in 10s.", err)
-			time.Sleep(10 * time.Second)
-			continue
+		select {
+		case f := <-am.inbound:
+			am.handleFrame(f)
+		case <-am.stopCh:
+			return
 		}
+	}
+}
 
-		if err := conn.Auth("K8SDR-10", "14750", ""); err != nil {
-			log.Printf("[APRS] Auth failed for K8SDR-10: %v. Retrying in 10s.", err)
-			conn.Close()
-			time.Sleep(10 * time.Second)
-			continue
+// handleFrame processes one frame received on any transport.
+func (am *APRSManager) handleFrame(f Frame) {
+	line := f.Line
+	switch f.Kind {
+	case TransportRF:
+		am.gateToIS(f)
+	case TransportInternet:
+		am.gateToRF(line)
+	}
+	if f.Kind != TransportLocal {
+		am.stations.heard(f)
+		am.objects.heard(f)
+	}
+
+	// Only process user-to-user messages and deliver via session broadcast
+	msg, perr := ParseMessagePacket(line)
+	if perr != nil || !msg.IsUserMessage() {
+		return
+	}
+	// What we delivered locally was handled then; its transmitted copy is not news.
+	if f.Kind != TransportLocal && am.echoes.seen(msg) {
+		log.Printf("[APRS] Ignoring echo of local packet: %s", line)
+		return
+	}
+	// Get base callsign for addressee (strip SSID)
+	baseDest := baseCallsign(toUpperNoSpace(msg.Addressee))
+	baseSrc := baseCallsign(toUpperNoSpace(msg.Source))
+
+	// Get all user callsigns (base and full) from DB
+	userSet, err := db.UserCallsignSet()
+	if err != nil {
+		log.Printf("[APRS] Unable to load user callsign set: %v", err)
+		return
+	}
+
+	// A member's own station acking a message means we need not.
+	if _, ok := userSet[baseSrc]; ok && msg.Response == "ack" {
+		am.acks.heard(ackKey{toUpperNoSpace(msg.Source), toUpperNoSpace(msg.Addressee), msg.MsgNo})
+	}
+
+	// Does the intended recipient match a user (by base or full callsign)?
+	if _, ok := userSet[baseDest]; !ok {
+		if msg.Response == "" {
+			am.refuseDeleted(msg, baseDest)
+		}
+		return
+	}
+
+	// Acks and rejs are delivery receipts, not chat; never store or ack them.
+	if msg.Response != "" {
+		if am.server != nil {
+			am.server.Deliver(baseDest, line)
 		}
+		am.handleResponse(msg)
+		return
+	}
 
-		am.connMu.Lock()
-		am.conn = conn
-		am.connMu.Unlock()
+	user, err := db.GetUserByCallsign(baseDest)
+	if err != nil || user == nil {
+		log.Printf("[APRS] Could not retrieve user %s to check policy: %v", baseDest, err)
+		return
+	}
 
-		log.Printf("[APRS] Connected and authenticated as K8SDR-10, listening for messages to active users")
+	// A copy heard again (another IGate, or the sender retrying) counts
+	// against the stored original instead of being stored again.
+	key := newDedupKey(msg.Source, msg.Addressee, msg.MsgNo, msg.MessageText)
+	storedID, isDuplicate := am.dedup.check(key)
+
+	// Blocked senders, suspended accounts and full quotas get the policy's answer.
+	// A copy of a message already stored does not count against the quota.
+	reason, action, err := am.refusal(user, baseSrc, isDuplicate && storedID != 0)
+	if err != nil {
+		log.Printf("[APRS] Error checking policy for %s: %v", baseDest, err)
+		return
+	}
+	if reason != "" {
+		am.refuse(msg, baseDest, reason, action, !isDuplicate)
+		if !isDuplicate {
+			am.dedup.store(key, 0)
+		}
+		return
+	}
+	if storedID == 0 {
+		isDuplicate = false // Refused before, accepted now
+	}
 
-		for {
-			frame, err := conn.Next()
-			if err != nil {
-				log.Printf("[APRS] Error from APRS-IS: %v. Reconnecting in 10s.", err)
-				break
+	// Members logged in with their own APRS app get the packet as-is.
+	if am.server != nil {
+		am.server.Deliver(baseDest, line)
+	}
+
+	// --- NEW: Message ID (MsgNo) and REPLY-ACK Handling ---
+	retryCount := 0
+	msgId := msg.MsgNo
+	ackId := msg.AckMsgNo
+	myCallsign := baseDest
+	contactCallsign := baseSrc
+
+	if isDuplicate {
+		copies, err := db.CountMessageCopy(storedID)
+		if err != nil {
+			log.Printf("[DB] Failed to count copy of message %d: %v", storedID, err)
+		}
+		retryCount = copies - 1
+		log.Printf("[APRS] Duplicate message %q from %s to %s (%d copies)", msgId, msg.Source, msg.Addressee, copies)
+	} else {
+		if msgId != "" {
+			if _, err := receiveMessageNumber(myCallsign, toUpperNoSpace(msg.Source), msgId, msg.ReplyAck); err != nil {
+				log.Printf("[DB] Failed to record message %s from %s: %v", msgId, msg.Source, err)
 			}
-			line := frame.String()
-
-			// Only process user-to-user messages and deliver via session broadcast
-			msg, perr := ParseMessagePacket(line)
-			if perr == nil && msg.IsUserMessage() {
-				// Get base callsign for addressee (strip SSID)
-				baseDest := baseCallsign(toUpperNoSpace(msg.Addressee))
-				baseSrc := baseCallsign(toUpperNoSpace(msg.Source))
-
-				// Get all user callsigns (base and full) from DB
-				userSet, err := db.UserCallsignSet()
-				if err != nil {
-					log.Printf("[APRS] Unable to load user callsign set: %v", err)
-					continue
-				}
-
-				// Does the intended recipient match a user (by base or full callsign)?
-				if _, ok := userSet[baseDest]; ok {
-					// --- BLOCK LIST CHECK ---
-					user, err := db.GetUserByCallsign(baseDest)
-					if err != nil || user == nil {
-						log.Printf("[APRS] Could not retrieve user %s to check blocks: %v", baseDest, err)
-						continue
-					}
-					isBlocked, err := db.IsBlocked(user.ID, baseSrc)
-					if err != nil {
-						log.Printf("[APRS] Error checking block status for %s: %v", baseDest, err)
-						continue
-					}
-					if isBlocked {
-						log.Printf("[APRS] Message from %s to %s blocked.", baseSrc, baseDest)
-						continue // Silently drop the message
-					}
-					// --- END BLOCK LIST CHECK ---
-
-					// --- NEW: Message ID (MsgNo) and REPLY-ACK Handling ---
-					isDuplicate := false
-					retryCount := 0
-					msgId := msg.MsgNo
-					ackId := msg.AckMsgNo
-					myCallsign := baseDest
-					contactCallsign := baseSrc
-
-					// Check for duplicate (already processed msgId from this contact)
-					if msgId != "" {
-						lastReceived := globalDeliveryState.getLastReceived(myCallsign, contactCallsign)
-						if lastReceived == msgId {
-							// Duplicate!
-							isDuplicate = true
-							retryCount = globalDeliveryState.incRetry(myCallsign, contactCallsign, msgId)
-						} else {
-							globalDeliveryState.updateLastReceived(myCallsign, contactCallsign, msgId)
-						}
-					}
-
-					// Store message to history (even duplicates for audit)
-					if err := db.StoreMessage(msg.Addressee, msg.Source, msg.MessageText); err != nil {
-						log.Printf("[APRS] Failed to store message for %s: %v", msg.Addressee, err)
-					}
-
-					// Always send APRS ack packet for compatibility if we got a message with a msgId
-					if msgId != "" {
-						ackPayload := fmt.Sprintf("ack%s", msgId)
-						// Print the raw ACK packet for visibility
-						log.Printf("[APRS RAW PACKET] %s", fmt.Sprintf("%s>%s::%s:%s",
-							msg.Addressee, "APRS,K8SDR*,qAC,K8SDR-10", fmt.Sprintf("%-9s", strings.ToUpper(msg.Source)), ackPayload))
-						am.SendMessage(msg.Addressee, msg.Source, ackPayload)
-					}
-
-					session := GetSessionsManager().GetSession(baseDest)
-					if session != nil {
-						// Only log if we are actually forwarding to a client (online)
-						log.Printf("[APRS RAW] %s", line)
-
-						if isDuplicate && msgId != "" {
-							// Send special WebSocket notification for retry
-							notif := map[string]interface{}{
-								"type":               "message_retry_received",
-								"contact_groupingId": contactCallsign,
-								"messageId":          msgId,
-							}
-							session.SendAll(notif)
-						} else {
-							// Standard message delivery
-							payload := map[string]interface{}{
-								"aprs_msg":   true,
-								"from":       msg.Source,
-								"to":         msg.Addressee,
-								"message":    msg.MessageText,
-								"messageId":  msgId,
-								"ackId":      ackId,
-								"created_at": time.Now().UTC().Format(time.RFC3339),
-								"retryCount": retryCount,
-								// route and other fields can be added as needed
-							}
-							session.SendAll(payload)
-
-							// Also: send "message_status_update" if this is replying to our sent message (REPLY-ACK)
-							if ackId != "" {
-								statusUpdate := map[string]interface{}{
-									"type":               "message_status_update",
-									"contact_groupingId": contactCallsign,
-									"messageId":          ackId,
-									"status":             "delivered",
-								}
-								session.SendAll(statusUpdate)
-							}
-						}
-					}
-				}
+		}
+		if f.Kind == TransportLocal {
+			// Both members share the row stored when it was sent.
+			storedID, err = db.FindSentMessage(msg.Addressee, msg.Source, msgId, msg.MessageText)
+		}
+		if storedID == 0 && err == nil {
+			storedID, err = db.InsertMessage(msg.Addressee, msg.Source, msg.MessageText, am.clock.Now())
+		}
+		if err != nil {
+			log.Printf("[APRS] Failed to store message for %s: %v", msg.Addressee, err)
+		} else {
+			am.dedup.store(key, storedID)
+		}
+	}
+
+	// The last part of a multipart message replaces the stored parts with the whole text.
+	var whole string
+	if storedID != 0 && !isDuplicate {
+		if text, ids, ok := am.parts.add(baseDest, toUpperNoSpace(msg.Source), msg.MessageText, storedID); ok {
+			if f.Kind == TransportLocal {
+				whole = text // The sender's segments stay stored, grouped
+			} else if id, err := db.ReplaceMessages(ids, msg.Addressee, msg.Source, text); err != nil {
+				log.Printf("[DB] Failed to reassemble message from %s: %v", msg.Source, err)
+			} else {
+				am.dedup.replace(ids, id)
+				whole = text
 			}
-			// Removed legacy callback delivery to avoid double messages
 		}
+	}
 
-		log.Printf("[APRS] Disconnected. Reconnecting in 10s.")
+	// Ack numbered messages as the member's ack policy allows.
+	if msgId != "" {
+		settings, err := db.GetUserSettings(user.ID)
+		if err != nil {
+			log.Printf("[DB] Could not load settings for %s: %v", baseDest, err)
+			settings = &db.UserSettings{AckPolicy: db.AckAlways}
+		}
+		am.ackReceived(msg, settings.AckPolicy)
+	}
 
-		am.connMu.Lock()
-		if am.conn != nil {
-			am.conn.Close()
-			am.conn = nil
+	// REPLY-ACK: the message carries an ack for one we sent.
+	if ackId != "" {
+		am.setDeliveryStatus(msg.Addressee, msg.Source, ackId, db.StatusAcked)
+	}
+
+	session := GetSessionsManager().GetSession(baseDest)
+	if session == nil {
+		return
+	}
+	// Only log if we are actually forwarding to a client (online)
+	log.Printf("[APRS RAW] %s", line)
+
+	if isDuplicate {
+		if msgId != "" {
+			// Send special WebSocket notification for retry
+			notif := map[string]interface{}{
+				"type":               "message_retry_received",
+				"contact_groupingId": contactCallsign,
+				"messageId":          msgId,
+				"retryCount":         retryCount,
+			}
+			session.SendAll(notif)
 		}
-		am.connMu.Unlock()
-		time.Sleep(10 * time.Second)
+		return
+	}
+
+	// Standard message delivery
+	payload := map[string]interface{}{
+		"aprs_msg":   true,
+		"from":       msg.Source,
+		"to":         msg.Addressee,
+		"message":    msg.MessageText,
+		"messageId":  msgId,
+		"ackId":      ackId,
+		"created_at": am.clock.Now().UTC().Format(time.RFC3339),
+		"retryCount": retryCount,
+		"route":      am.LocateRoute(BuildRoute(msg.Source, msg.Addressee, msg.Route())),
+	}
+	session.SendAll(payload)
+
+	if whole != "" {
+		session.SendAll(map[string]interface{}{
+			"type":       "message_reassembled",
+			"from":       msg.Source,
+			"to":         msg.Addressee,
+			"message":    whole,
+			"created_at": am.clock.Now().UTC().Format(time.RFC3339),
+		})
 	}
 }
 
@@ -318,4 +650,4 @@ func baseCallsign(cs string) string {
 // toUpperNoSpace returns uppercased callsign, trimmed.
 func toUpperNoSpace(cs string) string {
 	return strings.ToUpper(strings.TrimSpace(cs))
-}
\ No newline at end of file
+}
@@ -1,7 +1,9 @@
 package aprs
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestMessageParsingWithMsgId tests that messages with msgId are parsed correctly
@@ -48,4 +50,87 @@ func TestACKLogicFlow(t *testing.T) {
 	}
 
 	t.Logf("ACK payload generated correctly: %s", ackPayload)
-}
\ No newline at end of file
+}
+
+// TestMessageBodyFormats tests classic and REPLY-ACK message numbers and ack/rej bodies
+func TestMessageBodyFormats(t *testing.T) {
+	cases := []struct {
+		line, text, msgNo, ackNo, response string
+	}{
+		{"W1AW>APRS::N0CALL   :Classic{7", "Classic", "7", "", ""},
+		{"W1AW>APRS::N0CALL   :Reply{AB}CD", "Reply", "AB", "CD", ""},
+		{"W1AW>APRS::N0CALL   :No number", "No number", "", "", ""},
+		{"W1AW>APRS::N0CALL   :ack7", "", "7", "", "ack"},
+		{"W1AW>APRS::N0CALL   :rej12", "", "12", "", "rej"},
+		{"W1AW>APRS::N0CALL   :ackAB}CD", "", "AB", "CD", "ack"},
+	}
+	for _, c := range cases {
+		msg, err := ParseMessagePacket(c.line)
+		if err != nil {
+			t.Fatalf("ParseMessagePacket(%q): %v", c.line, err)
+		}
+		if msg.MessageText != c.text || msg.MsgNo != c.msgNo || msg.AckMsgNo != c.ackNo || msg.Response != c.response {
+			t.Fatalf("%q parsed as text=%q msgNo=%q ackNo=%q response=%q", c.line, msg.MessageText, msg.MsgNo, msg.AckMsgNo, msg.Response)
+		}
+	}
+}
+
+// TestThirdPartyUnwrap tests that third-party messages are unwrapped, keeping both paths
+func TestThirdPartyUnwrap(t *testing.T) {
+	line := "IGATE-1>APRS,TCPIP*,qAC,T2TEST:}N0CALL-9>APDR16,TCPIP,IGATE-1*::AD8NT    :Hi from RF{12}"
+	msg, err := ParseMessagePacket(line)
+	if err != nil {
+		t.Fatalf("Failed to parse third-party message: %v", err)
+	}
+	if !msg.IsUserMessage() || msg.Source != "N0CALL-9" || msg.Addressee != "AD8NT" || msg.MessageText != "Hi from RF" || msg.MsgNo != "12" {
+		t.Fatalf("Inner message parsed wrong: %+v", msg)
+	}
+	if strings.Join(msg.Path, ",") != "APDR16,TCPIP,IGATE-1*" {
+		t.Fatalf("Expected inner path, got %v", msg.Path)
+	}
+	if len(msg.ThirdParty) != 1 || msg.ThirdParty[0].Source != "IGATE-1" || strings.Join(msg.ThirdParty[0].Path, ",") != "APRS,TCPIP*,qAC,T2TEST" {
+		t.Fatalf("Expected outer gateway header kept, got %+v", msg.ThirdParty)
+	}
+	if route := msg.Route(); len(route) != 2 || route[0] != (PathHop{Call: "IGATE-1", Role: RoleIGate, Used: true}) ||
+		route[1] != (PathHop{Call: "T2TEST", Role: RoleServer, Used: true}) {
+		t.Fatalf("Unexpected route %+v", route)
+	}
+
+	// Nested wrapping unwraps all the way, outermost header first.
+	nested := "GW2>APRS:}GW1>APRS,WIDE1*:}N0CALL>APRS,TCPIP,GW1*::AD8NT    :ack12"
+	msg, err = ParseMessagePacket(nested)
+	if err != nil || msg.Source != "N0CALL" || msg.Response != "ack" || len(msg.ThirdParty) != 2 || msg.ThirdParty[0].Source != "GW2" {
+		t.Fatalf("Nested third-party parsed wrong: %+v %v", msg, err)
+	}
+
+	if _, err := ParseMessagePacket("GW>APRS:}garbage"); err == nil {
+		t.Fatal("Expected an error for a malformed third-party header")
+	}
+}
+
+// runTransport is a transport that reports when it is started.
+type runTransport struct {
+	captureTransport
+	running chan struct{}
+}
+
+func (r *runTransport) Run(stop <-chan struct{}, host TransportHost) { close(r.running) }
+
+// TestAddTransportAfterStart tests that transports attached to a running manager are started
+func TestAddTransportAfterStart(t *testing.T) {
+	am := NewAPRSManager()
+	before := &runTransport{running: make(chan struct{})}
+	after := &runTransport{running: make(chan struct{})}
+	am.AddTransport(before)
+	am.startTransports()
+	defer am.Stop()
+	am.AddTransport(after)
+
+	for name, tr := range map[string]*runTransport{"before": before, "after": after} {
+		select {
+		case <-tr.running:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Transport added %s Start was not started", name)
+		}
+	}
+}
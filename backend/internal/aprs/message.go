@@ -15,12 +15,37 @@ type MessagePacket struct {
 	MessageText  string
 	MsgNo        string // Message number or ID
 	AckMsgNo     string // Optional reply-ack message number
+	ReplyAck     bool   // The sender used the REPLY-ACK {MM}AA format, so it supports it
 	Response     string // "ack" or "rej" if this is an ack/rej response
 	BulletinID   string
 	GroupID      string
 	Announcement string
 	Telemetry    map[string]string // If this is a telemetry config message
 	Raw          string
+
+	// Set when the message arrived third-party wrapped (}SRC>DST,PATH:...).
+	// Source and Path above then describe the innermost, original packet.
+	ThirdParty []ThirdPartyHeader // Outer headers, outermost first
+}
+
+// ThirdPartyHeader is one outer header around a third-party packet: the
+// station that wrapped it and the path the wrapper travelled.
+type ThirdPartyHeader struct {
+	Source string
+	Path   []string // Destination first, as in MessagePacket.Path
+}
+
+// maxThirdPartyDepth bounds how many } layers we unwrap.
+const maxThirdPartyDepth = 4
+
+// Route returns the hops that handled the message, in the order it travelled
+// them: the original path first, then each wrapper's path, innermost first.
+func (m *MessagePacket) Route() []PathHop {
+	route := ParsePath(m.Path).Travelled()
+	for i := len(m.ThirdParty) - 1; i >= 0; i-- {
+		route = append(route, ParsePath(m.ThirdParty[i].Path).Travelled()...)
+	}
+	return route
 }
 
 // ParseMessagePacket parses the body of an APRS message info field (after the header) into a MessagePacket.
@@ -52,22 +77,27 @@ func ParseMessagePacket(line string) (*MessagePacket, error) {
 		packet.Path = strings.Split(pathStr, ",")
 	}
 
-	// 0. User message: :TARGET   :message or :TARGET   :message{NN}
+	// Unwrap third-party headers: info is "}SRC>DST,PATH:inner info".
+	for strings.HasPrefix(info, "}") {
+		if len(packet.ThirdParty) == maxThirdPartyDepth {
+			return nil, ErrNotAMessagePacket
+		}
+		innerHeader, innerInfo, ok := strings.Cut(info[1:], ":")
+		src, pathStr, hasPath := strings.Cut(innerHeader, ">")
+		if !ok || !hasPath || src == "" || pathStr == "" {
+			return nil, ErrNotAMessagePacket
+		}
+		packet.ThirdParty = append(packet.ThirdParty, ThirdPartyHeader{Source: packet.Source, Path: packet.Path})
+		packet.Source = src
+		packet.Path = strings.Split(pathStr, ",")
+		info = innerInfo
+	}
+
+	// 0. User message: :TARGET   :message, :TARGET   :message{NN or an ack/rej
 	userMsgRe := regexp.MustCompile(`^:([A-Za-z0-9 \-]{9}):(.*)$`)
 	if m := userMsgRe.FindStringSubmatch(info); m != nil {
 		packet.Addressee = strings.TrimRight(m[1], " ")
-		body := strings.TrimSpace(m[2])
-		// Try to extract trailing {NN} (classic format)
-		msgWithIdRe := regexp.MustCompile(`^(.*)\{([A-Za-z0-9]{2,5})}$`)
-		if m2 := msgWithIdRe.FindStringSubmatch(body); m2 != nil {
-			packet.Format = "message"
-			packet.MessageText = strings.TrimSpace(m2[1])
-			packet.MsgNo = m2[2]
-			return packet, nil
-		}
-		// Otherwise, regular message
-		packet.Format = "message"
-		packet.MessageText = body
+		parseAddressedBody(packet, m[2])
 		return packet, nil
 	}
 
@@ -99,62 +129,66 @@ func ParseMessagePacket(line string) (*MessagePacket, error) {
 	addrRe := regexp.MustCompile(`^([a-zA-Z0-9_ \-]{9}):(.*)$`)
 	if m := addrRe.FindStringSubmatch(info); m != nil {
 		packet.Addressee = strings.TrimRight(m[1], " ")
-		body := m[2]
-
-		// 3a. Telemetry config messages (PARM, UNIT, EQNS, BITS)
-		if tcfg, telemetryType := parseTelemetryConfig(body); telemetryType != "" {
-			packet.Format = "telemetry"
-			packet.Telemetry = tcfg
-			packet.MessageText = body
-			return packet, nil
-		}
+		parseAddressedBody(packet, m[2])
+		return packet, nil
+	}
 
-		// 3b. NEW replay-ack: ^(ack|rej)([A-Za-z0-9]{2})}([A-Za-z0-9]{2})?$
-		newAckRe := regexp.MustCompile(`^(ack|rej)([A-Za-z0-9]{2})}([A-Za-z0-9]{2})?$`)
-		if m2 := newAckRe.FindStringSubmatch(body); m2 != nil {
-			packet.Format = "message"
-			packet.Response = m2[1]
-			packet.MsgNo = m2[2]
-			packet.AckMsgNo = m2[3] // may be empty
-			return packet, nil
-		}
+	// Not a recognized packet
+	return nil, ErrNotAMessagePacket
+}
 
-		// 3c. Standard ack/rej: ^(ack|rej)([A-Za-z0-9]{1,5})$
-		stdAckRe := regexp.MustCompile(`^(ack|rej)([A-Za-z0-9]{1,5})$`)
-		if m2 := stdAckRe.FindStringSubmatch(body); m2 != nil {
-			packet.Format = "message"
-			packet.Response = m2[1]
-			packet.MsgNo = m2[2]
-			return packet, nil
-		}
+// parseAddressedBody fills in the packet from the text after the addressee:
+// telemetry config, ack/rej (with or without REPLY-ACK), or message text with
+// an optional message number.
+func parseAddressedBody(packet *MessagePacket, body string) {
+	packet.Format = "message"
 
-		// 3d. New message format: text{MM}AA
-		newMsgRe := regexp.MustCompile(`^(.*)\{([A-Za-z0-9]{2})}([A-Za-z0-9]{2})?$`)
-		if m2 := newMsgRe.FindStringSubmatch(body); m2 != nil {
-			packet.Format = "message"
-			packet.MessageText = strings.TrimSpace(m2[1])
-			packet.MsgNo = m2[2]
-			packet.AckMsgNo = m2[3] // may be empty
-			return packet, nil
-		}
+	// a. Telemetry config messages (PARM, UNIT, EQNS, BITS)
+	if tcfg, telemetryType := parseTelemetryConfig(body); telemetryType != "" {
+		packet.Format = "telemetry"
+		packet.Telemetry = tcfg
+		packet.MessageText = body
+		return
+	}
 
-		// 3e. Old message format: text{msgNo}
-		oldMsgRe := regexp.MustCompile(`^(.*)\{([A-Za-z0-9]{1,5})$`)
-		if m2 := oldMsgRe.FindStringSubmatch(body); m2 != nil {
-			packet.Format = "message"
-			packet.MessageText = strings.TrimSpace(m2[1])
-			packet.MsgNo = m2[2]
-			return packet, nil
-		}
+	// b. REPLY-ACK style ack/rej: ^(ack|rej)([A-Za-z0-9]{2})}([A-Za-z0-9]{2})?$
+	newAckRe := regexp.MustCompile(`^(ack|rej)([A-Za-z0-9]{2})}([A-Za-z0-9]{2})?$`)
+	if m := newAckRe.FindStringSubmatch(strings.TrimSpace(body)); m != nil {
+		packet.Response = m[1]
+		packet.MsgNo = m[2]
+		packet.AckMsgNo = m[3] // may be empty
+		packet.ReplyAck = true
+		return
+	}
 
-		// 3f. Regular message (no message number)
-		packet.Format = "message"
-		packet.MessageText = strings.TrimSpace(body)
-		return packet, nil
+	// c. Standard ack/rej: ^(ack|rej)([A-Za-z0-9]{1,5})$
+	stdAckRe := regexp.MustCompile(`^(ack|rej)([A-Za-z0-9]{1,5})$`)
+	if m := stdAckRe.FindStringSubmatch(strings.TrimSpace(body)); m != nil {
+		packet.Response = m[1]
+		packet.MsgNo = m[2]
+		return
 	}
 
-	// Not a recognized packet
-	return nil, ErrNotAMessagePacket
+	// d. REPLY-ACK message format: text{MM}AA
+	newMsgRe := regexp.MustCompile(`^(.*)\{([A-Za-z0-9]{2})}([A-Za-z0-9]{2})?$`)
+	if m := newMsgRe.FindStringSubmatch(strings.TrimSpace(body)); m != nil {
+		packet.MessageText = strings.TrimSpace(m[1])
+		packet.MsgNo = m[2]
+		packet.AckMsgNo = m[3] // may be empty
+		packet.ReplyAck = true
+		return
+	}
+
+	// e. Classic message format: text{msgNo}, also seen with a stray closing brace
+	oldMsgRe := regexp.MustCompile(`^(.*)\{([A-Za-z0-9]{1,5})}?$`)
+	if m := oldMsgRe.FindStringSubmatch(strings.TrimSpace(body)); m != nil {
+		packet.MessageText = strings.TrimSpace(m[1])
+		packet.MsgNo = m[2]
+		return
+	}
+
+	// f. Regular message (no message number)
+	packet.MessageText = strings.TrimSpace(body)
 }
 
 // parseTelemetryConfig parses telemetry config lines (PARM/UNIT/EQNS/BITS) and returns a map if found.
@@ -0,0 +1,181 @@
+package aprs
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+)
+
+// Object is a decoded APRS object (';') or item (')'). Its Position's Source
+// is the originating station.
+type Object struct {
+	Position
+	Name   string `json:"name"`
+	Item   bool   `json:"item"`
+	Killed bool   `json:"killed"`
+}
+
+// ErrNotAnObject is returned for packets that are not objects or items.
+var ErrNotAnObject = &ParseError{"not an APRS object or item"}
+
+// ParseObject decodes the object or item in a TNC2 line. now resolves the
+// object's timestamp, as for ParsePosition.
+func ParseObject(line string, now time.Time) (*Object, error) {
+	src, _, info, ok := innerPacket(line)
+	if !ok {
+		return nil, ErrNotAnObject
+	}
+	o := &Object{}
+	var body string
+	switch info[0] {
+	case ';':
+		// ;NAME_____*DDHHMMz then the position; '*' live, '_' killed.
+		if len(info) < 18 || (info[10] != '*' && info[10] != '_') {
+			return nil, ErrBadPosition
+		}
+		o.Name, o.Killed = strings.TrimRight(info[1:10], " "), info[10] == '_'
+		ts, err := parseTimestamp(info[11:18], now)
+		if err != nil {
+			return nil, err
+		}
+		o.Timestamp = ts
+		body = info[18:]
+	case ')':
+		// )NAME!position: a 3-9 character name ended by '!' live or '_' killed.
+		end := strings.IndexAny(info[1:], "!_")
+		if end < 3 || end > 9 {
+			return nil, ErrBadPosition
+		}
+		o.Name, o.Item, o.Killed = info[1:1+end], true, info[1+end] == '_'
+		body = info[2+end:]
+	default:
+		return nil, ErrNotAnObject
+	}
+	if strings.TrimSpace(o.Name) == "" {
+		return nil, ErrBadPosition
+	}
+	p, err := decodePositionBody(body)
+	if err != nil {
+		return nil, err
+	}
+	p.Timestamp = o.Timestamp
+	p.Source = strings.ToUpper(src)
+	o.Position = *p
+	return o, nil
+}
+
+// objectLog stores the objects and items heard on the feed.
+type objectLog struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	lastPrune time.Time
+}
+
+func newObjectLog(now func() time.Time) *objectLog {
+	return &objectLog{now: now}
+}
+
+// heard stores the object or item in a frame, if it carries one, and deletes
+// expired ones at most once a minute.
+func (l *objectLog) heard(f Frame) {
+	o, err := ParseObject(f.Line, f.Heard)
+	if err != nil {
+		return
+	}
+	cfg := config.Get().Objects
+	err = db.SaveObject(&db.Object{
+		Name:       o.Name,
+		Originator: o.Source,
+		Item:       o.Item,
+		Killed:     o.Killed,
+		Lat:        o.Lat,
+		Lon:        o.Lon,
+		Symbol:     o.Symbol,
+		Comment:    o.Comment,
+		ReportedAt: o.Timestamp,
+		LastHeard:  f.Heard,
+	}, f.Heard.Add(-cfg.KillHold.D()))
+	if err != nil {
+		log.Printf("[DB] Failed to save object %s from %s: %v", o.Name, o.Source, err)
+		return
+	}
+	if o.Killed {
+		log.Printf("[APRS] Object %s from %s killed", o.Name, o.Source)
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	prune := now.Sub(l.lastPrune) >= time.Minute
+	if prune {
+		l.lastPrune = now
+	}
+	l.mu.Unlock()
+	if prune {
+		if _, err := db.PruneObjects(now.Add(-cfg.Expire.D())); err != nil {
+			log.Printf("[DB] Failed to prune objects: %v", err)
+		}
+	}
+}
+
+// NearbyObject is a live object with its distance from the point asked about.
+type NearbyObject struct {
+	*db.Object
+	Distance float64 `json:"distance"` // Kilometres
+}
+
+// earthRadius is the mean radius of the Earth in kilometres.
+const earthRadius = 6371.0
+
+// Distance returns the great-circle distance in kilometres between two points.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// boundingBox returns a box holding every point within radius kilometres of
+// lat/lon. It reaches all longitudes when the circle takes in a pole.
+func boundingBox(lat, lon, radius float64) db.Box {
+	deg := 180 / math.Pi
+	angle := radius / earthRadius
+	box := db.Box{MinLat: lat - angle*deg, MaxLat: lat + angle*deg, MinLon: -180, MaxLon: 180}
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		return box
+	}
+	dLon := math.Asin(math.Min(1, math.Sin(angle)/math.Cos(lat/deg))) * deg
+	box.MinLon, box.MaxLon = lon-dLon, lon+dLon
+	if box.MinLon < -180 {
+		box.MinLon += 360
+	}
+	if box.MaxLon > 180 {
+		box.MaxLon -= 360
+	}
+	return box
+}
+
+// Objects returns the live, unexpired objects and items within radius
+// kilometres of lat/lon, nearest first. The database narrows them to a
+// bounding box; the distance check trims its corners.
+func (am *APRSManager) Objects(lat, lon, radius float64) ([]NearbyObject, error) {
+	since := am.clock.Now().Add(-config.Get().Objects.Expire.D())
+	objects, err := db.ListLiveObjects(since, boundingBox(lat, lon, radius))
+	if err != nil {
+		return nil, err
+	}
+	nearby := []NearbyObject{}
+	for _, o := range objects {
+		if d := Distance(lat, lon, o.Lat, o.Lon); d <= radius {
+			nearby = append(nearby, NearbyObject{Object: o, Distance: d})
+		}
+	}
+	sort.Slice(nearby, func(i, j int) bool { return nearby[i].Distance < nearby[j].Distance })
+	return nearby, nil
+}
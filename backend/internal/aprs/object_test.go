@@ -0,0 +1,93 @@
+package aprs
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestParseObject tests object and item decoding, including killed ones
+func TestParseObject(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		line         string
+		name, symbol string
+		item, killed bool
+		lat, lon     float64
+		timestamp    time.Time
+		comment      string
+	}{
+		{"N0CALL>APRS:;LEADER   *092345z4903.50N/07201.75W>088/036", "LEADER", "/>", false, false, 49.058333, -72.029167,
+			time.Date(2026, 10, 9, 23, 45, 0, 0, time.UTC), ""},
+		{"N0CALL>APRS:;LEADER   _092345z4903.50N/07201.75W>", "LEADER", "/>", false, true, 49.058333, -72.029167,
+			time.Date(2026, 10, 9, 23, 45, 0, 0, time.UTC), ""},
+		{"N0CALL>APRS:;LEADER   *092345z/5L!!<*e7>7P[", "LEADER", "/>", false, false, 49.5, -72.75,
+			time.Date(2026, 10, 9, 23, 45, 0, 0, time.UTC), ""},
+		{"N0CALL>APRS:;146.52-NC*111111z4903.50N/07201.75Wr146.520MHz T100", "146.52-NC", "/r", false, false, 49.058333, -72.029167,
+			time.Date(2026, 10, 11, 11, 11, 0, 0, time.UTC), "146.520MHz T100"},
+		{"N0CALL>APRS:)AID #2!4903.50N/07201.75WA", "AID #2", "/A", true, false, 49.058333, -72.029167, time.Time{}, ""},
+		{"N0CALL>APRS:)G/WB4APR_4903.50N/07201.75WA", "G/WB4APR", "/A", true, true, 49.058333, -72.029167, time.Time{}, ""},
+	}
+	for _, c := range cases {
+		o, err := ParseObject(c.line, now)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.line, err)
+		}
+		if o.Name != c.name || o.Symbol != c.symbol || o.Item != c.item || o.Killed != c.killed || o.Comment != c.comment || o.Source != "N0CALL" {
+			t.Fatalf("Expected '%s' %s item=%v killed=%v %q, got '%s' %s item=%v killed=%v %q",
+				c.name, c.symbol, c.item, c.killed, c.comment, o.Name, o.Symbol, o.Item, o.Killed, o.Comment)
+		}
+		if math.Abs(o.Lat-c.lat) > 1e-5 || math.Abs(o.Lon-c.lon) > 1e-5 || !o.Timestamp.Equal(c.timestamp) {
+			t.Fatalf("%s: expected %f,%f at '%s', got %f,%f at '%s'", c.name, c.lat, c.lon, c.timestamp, o.Lat, o.Lon, o.Timestamp)
+		}
+	}
+
+	for _, line := range []string{
+		"N0CALL>APRS:!4903.50N/07201.75W-",
+		"N0CALL>APRS:;LEADER   X092345z4903.50N/07201.75W>",
+		"N0CALL>APRS:;LEADER   *092345z",
+		"N0CALL>APRS:)AB!4903.50N/07201.75WA",
+		"N0CALL>APRS:)ABCDEFGHIJ!4903.50N/07201.75WA",
+	} {
+		if _, err := ParseObject(line, now); err == nil {
+			t.Fatalf("Expected an error for '%s'", line)
+		}
+	}
+}
+
+// TestDistance tests great-circle distances
+func TestDistance(t *testing.T) {
+	// One degree of latitude is about 111 km.
+	if d := Distance(49, -72, 50, -72); math.Abs(d-111.19) > 0.1 {
+		t.Fatalf("Expected about 111.19 km, got %.2f", d)
+	}
+	if d := Distance(0, 179.5, 0, -179.5); math.Abs(d-111.19) > 0.1 {
+		t.Fatalf("Expected about 111.19 km across the antimeridian, got %.2f", d)
+	}
+}
+
+// TestBoundingBox tests that the box holds the whole circle, wraps at the antimeridian and opens at the poles
+func TestBoundingBox(t *testing.T) {
+	box := boundingBox(49, -72, 50)
+	for _, p := range [][2]float64{{49.44, -72}, {48.56, -72}, {49, -72.68}, {49, -71.32}} {
+		if d := Distance(49, -72, p[0], p[1]); d > 50 {
+			t.Fatalf("Test point %v is %.1f km away", p, d)
+		}
+		if p[0] < box.MinLat || p[0] > box.MaxLat || p[1] < box.MinLon || p[1] > box.MaxLon {
+			t.Fatalf("Point %v within 50 km is outside %+v", p, box)
+		}
+	}
+	if box.MaxLat-box.MinLat > 1 || box.MaxLon-box.MinLon > 1.5 {
+		t.Fatalf("Box %+v is much larger than the circle", box)
+	}
+
+	box = boundingBox(0, 179.9, 50)
+	if box.MinLon <= box.MaxLon || box.MinLon > 179.9 || box.MaxLon < -179.9 {
+		t.Fatalf("Expected a box wrapping the antimeridian, got %+v", box)
+	}
+
+	box = boundingBox(89.9, 10, 50)
+	if box.MinLon != -180 || box.MaxLon != 180 {
+		t.Fatalf("Expected every longitude near the pole, got %+v", box)
+	}
+}
@@ -0,0 +1,161 @@
+package aprs
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+)
+
+// Outbox transmits members' messages from the outbox table: it holds them
+// while APRS-IS is down and retransmits numbered messages on a doubling
+// schedule until they are acked, rejected or expire. State is kept in the
+// database, so a restart picks up where it left off.
+type Outbox struct {
+	am   *APRSManager
+	wake chan struct{}
+}
+
+// NewOutbox creates the outbox worker for am.
+func NewOutbox(am *APRSManager) *Outbox {
+	return &Outbox{am: am, wake: make(chan struct{}, 1)}
+}
+
+// Wake makes the worker look at the outbox now.
+func (o *Outbox) Wake() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// QueueMessage validates a message and adds it to the outbox. msgNo is the
+// message number in payload, or empty when no ack is expected.
+func (am *APRSManager) QueueMessage(from, to, payload, msgNo string) error {
+	return am.QueueSegments(from, to, []string{payload}, []string{msgNo})
+}
+
+// QueueSegments validates the segments of one long message and adds them to
+// the outbox together. payloads and msgNos are parallel; clients see one
+// aggregate status for the lot.
+func (am *APRSManager) QueueSegments(from, to string, payloads, msgNos []string) error {
+	for _, p := range payloads {
+		if _, err := buildMessage(from, to, p); err != nil {
+			return err
+		}
+	}
+	entries, err := db.QueueMessages(toUpperNoSpace(to), from, payloads, msgNos, am.clock.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("[OUTBOX] Queued %d message(s) %v from %s to %s", len(entries), msgNos, from, entries[0].To)
+	am.notifyMessageStatus(entries[0].MessageID, 0)
+	am.outbox.Wake()
+	return nil
+}
+
+// retryDelay returns the wait after the given number of transmissions:
+// RetryFirst, doubling each time up to RetryMax.
+func retryDelay(attempts int, cfg config.OutboundConfig) time.Duration {
+	d := cfg.RetryFirst.D()
+	for i := 1; i < attempts && d < cfg.RetryMax.D(); i++ {
+		d *= 2
+	}
+	if d > cfg.RetryMax.D() {
+		d = cfg.RetryMax.D()
+	}
+	return d
+}
+
+// process handles every due entry and returns how long until the next one is
+// due, or 0 when there is nothing to wait for.
+func (o *Outbox) process() time.Duration {
+	cfg := config.Get().Outbound
+	now := o.am.clock.Now()
+	entries, err := db.DueOutbox(now)
+	if err != nil {
+		log.Printf("[OUTBOX] Failed to load due messages: %v", err)
+		return cfg.RetryFirst.D()
+	}
+	up := o.am.internetUp()
+	for _, e := range entries {
+		expires := e.CreatedAt.Add(cfg.ExpireAfter.D())
+		if !now.Before(expires) {
+			o.transition(e, db.StatusExpired)
+			continue
+		}
+		if !up && !isLocal(e.To) {
+			continue
+		}
+		if err := o.am.SendMessage(e.From, e.To, e.Message); err != nil {
+			var be *BuildError
+			if errors.As(err, &be) {
+				log.Printf("[OUTBOX] Giving up on message %d, it no longer builds: %v", e.MessageID, err)
+				o.transition(e, db.StatusExpired)
+			}
+			continue
+		}
+		e.Attempts++
+		if e.MsgNo == "" {
+			o.transition(e, db.StatusSent)
+			continue
+		}
+		e.NextAt = now.Add(retryDelay(e.Attempts, cfg))
+		if e.NextAt.After(expires) {
+			e.NextAt = expires
+		}
+		if e.Attempts == 1 {
+			o.transition(e, db.StatusSent)
+		} else {
+			o.transition(e, db.StatusRetrying)
+		}
+	}
+
+	next, ok, err := db.NextOutboxAt()
+	if err != nil {
+		log.Printf("[OUTBOX] Failed to read the outbox: %v", err)
+		return cfg.RetryFirst.D()
+	}
+	if !ok {
+		return 0
+	}
+	if wait := next.Sub(now); wait > 0 {
+		return wait
+	}
+	// Due but held while APRS-IS is down: a reconnect wakes us, and we look
+	// again now and then so held messages still expire.
+	return cfg.RetryFirst.D()
+}
+
+// transition saves e in status and tells the sender's clients.
+func (o *Outbox) transition(e *db.OutboxEntry, status string) {
+	e.Status = status
+	if err := db.UpdateOutbox(e); err != nil {
+		log.Printf("[OUTBOX] Failed to update message %d: %v", e.MessageID, err)
+		return
+	}
+	retries := 0
+	if e.Attempts > 1 {
+		retries = e.Attempts - 1
+	}
+	log.Printf("[OUTBOX] Message %s from %s to %s %s (retries %d)", e.MsgNo, e.From, e.To, status, retries)
+	o.am.notifyMessageStatus(e.MessageID, retries)
+}
+
+// Run works the outbox until stop is closed.
+func (o *Outbox) Run(stop <-chan struct{}) {
+	for {
+		var timer <-chan time.Time
+		if wait := o.process(); wait > 0 {
+			timer = o.am.clock.After(wait)
+		}
+		select {
+		case <-o.wake:
+		case <-timer:
+		case <-stop:
+			return
+		}
+	}
+}
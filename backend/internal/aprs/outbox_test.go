@@ -0,0 +1,153 @@
+package aprs
+
+import (
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprstest"
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+)
+
+// switchTransport is an internet transport the test connects and disconnects.
+type switchTransport struct {
+	up   bool
+	sent []string
+}
+
+func (s *switchTransport) Name() string                                 { return "switch" }
+func (s *switchTransport) Kind() TransportKind                          { return TransportInternet }
+func (s *switchTransport) Run(stop <-chan struct{}, host TransportHost) {}
+func (s *switchTransport) Send(tnc2 string) error                       { s.sent = append(s.sent, tnc2); return nil }
+func (s *switchTransport) State() TransportState {
+	if s.up {
+		return TransportState{Name: "switch", State: StateConnected}
+	}
+	return TransportState{Name: "switch", State: StateBackoff}
+}
+
+// statusOf returns the status of the newest message user sent with msgNo.
+func statusOf(t *testing.T, user, msgNo string) string {
+	t.Helper()
+	msgs, err := db.ListAllMessagesForUser(user)
+	if err != nil {
+		t.Fatalf("ListAllMessagesForUser: %v", err)
+	}
+	status := ""
+	for _, m := range msgs {
+		if m.FromCallsign == user && m.MsgNo == msgNo {
+			status = m.Status
+		}
+	}
+	return status
+}
+
+// TestRetryDelay tests the doubling retransmission schedule and its cap
+func TestRetryDelay(t *testing.T) {
+	cfg := config.Get().Outbound
+	for attempts, expected := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 6: 10 * time.Minute, 20: 10 * time.Minute} {
+		if got := retryDelay(attempts, cfg); got != expected {
+			t.Fatalf("Expected %s after %d attempts, got %s", expected, attempts, got)
+		}
+	}
+}
+
+// TestOutbox tests holding messages while down, retransmitting until acked, and expiry
+func TestOutbox(t *testing.T) {
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	am := NewAPRSManagerWithOptions(ManagerOptions{Clock: clock})
+	tr := &switchTransport{}
+	am.transports = append(am.transports, tr)
+	flush := func() []string {
+		am.outbox.process()
+		am.outbound.sendReady()
+		sent := tr.sent
+		tr.sent = nil
+		return sent
+	}
+	const line = "N0OUT>APZAMG,TCPIP*::W1AW     :Hello{01}"
+
+	if err := am.QueueMessage("N0OUT", "W1AW", "Hello{01}", "01"); err != nil {
+		t.Fatalf("QueueMessage: %v", err)
+	}
+	if sent := flush(); len(sent) != 0 || statusOf(t, "N0OUT", "01") != db.StatusQueued {
+		t.Fatalf("Expected the message held while down, sent %q", sent)
+	}
+
+	tr.up = true
+	if sent := flush(); len(sent) != 1 || sent[0] != line || statusOf(t, "N0OUT", "01") != db.StatusSent {
+		t.Fatalf("Expected '%s' sent on reconnect, got %q", line, sent)
+	}
+	clock.Advance(29 * time.Second)
+	if sent := flush(); len(sent) != 0 {
+		t.Fatalf("Retransmitted early: %q", sent)
+	}
+	clock.Advance(time.Second)
+	if sent := flush(); len(sent) != 1 || statusOf(t, "N0OUT", "01") != db.StatusRetrying {
+		t.Fatalf("Expected a retransmission after 30s, got %q", sent)
+	}
+	clock.Advance(time.Minute)
+	if sent := flush(); len(sent) != 1 {
+		t.Fatalf("Expected a retransmission after 60s more, got %q", sent)
+	}
+
+	am.handleResponse(&MessagePacket{Source: "W1AW", Addressee: "N0OUT", Response: "ack", MsgNo: "01"})
+	if got := statusOf(t, "N0OUT", "01"); got != db.StatusAcked {
+		t.Fatalf("Expected '%s', got '%s'", db.StatusAcked, got)
+	}
+	clock.Advance(10 * time.Minute)
+	if sent := flush(); len(sent) != 0 {
+		t.Fatalf("Retransmitted after the ack: %q", sent)
+	}
+
+	if err := am.QueueMessage("N0OUT", "W1AW", "Anyone?{02}", "02"); err != nil {
+		t.Fatalf("QueueMessage: %v", err)
+	}
+	flush()
+	clock.Advance(time.Hour)
+	flush()
+	if got := statusOf(t, "N0OUT", "02"); got != db.StatusExpired {
+		t.Fatalf("Expected '%s', got '%s'", db.StatusExpired, got)
+	}
+
+	if err := am.QueueMessage("N0OUT", "W1AW", "bad|pipe{03}", "03"); err == nil {
+		t.Fatal("Expected a message that cannot be built to be refused")
+	}
+}
+
+// TestOutboxSegments tests that segments of a long message are sent and acked separately
+func TestOutboxSegments(t *testing.T) {
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	am := NewAPRSManagerWithOptions(ManagerOptions{Clock: clock})
+	tr := &switchTransport{up: true}
+	am.transports = append(am.transports, tr)
+
+	if err := am.QueueSegments("N0SEG", "W1AW", []string{"One (1/2){S1}", "Two (2/2){S2}"}, []string{"S1", "S2"}); err != nil {
+		t.Fatalf("QueueSegments: %v", err)
+	}
+	am.outbox.process()
+	am.outbound.sendReady()
+	if len(tr.sent) != 2 {
+		t.Fatalf("Expected both segments sent, got %q", tr.sent)
+	}
+
+	group := func() (string, int) {
+		msgs, err := db.ListAllMessagesForUser("N0SEG")
+		if err != nil || len(msgs) == 0 {
+			t.Fatalf("ListAllMessagesForUser: %v", err)
+		}
+		segments, err := db.ListMessageGroup(msgs[len(msgs)-1].GroupID)
+		if err != nil || len(segments) != 2 {
+			t.Fatalf("Expected 2 segments in the group, got %d (%v)", len(segments), err)
+		}
+		return aggregateStatus(segments)
+	}
+	am.handleResponse(&MessagePacket{Source: "W1AW", Addressee: "N0SEG", Response: "ack", MsgNo: "S1"})
+	if status, acked := group(); status != db.StatusSent || acked != 1 {
+		t.Fatalf("Expected 'sent' with 1 acked, got '%s' with %d", status, acked)
+	}
+	am.handleResponse(&MessagePacket{Source: "W1AW", Addressee: "N0SEG", Response: "ack", MsgNo: "S2"})
+	if status, acked := group(); status != db.StatusAcked || acked != 2 {
+		t.Fatalf("Expected 'acked' with 2 acked, got '%s' with %d", status, acked)
+	}
+}
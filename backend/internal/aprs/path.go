@@ -0,0 +1,127 @@
+package aprs
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HopRole says what a path entry is.
+type HopRole string
+
+const (
+	RoleDigi       HopRole = "digi"     // A digipeater named by callsign
+	RoleAlias      HopRole = "alias"    // A generic alias: WIDEn-N, TRACEn-N, RELAY, ...
+	RoleInternet   HopRole = "internet" // TCPIP or TCPXX: the packet came from the internet
+	RoleQConstruct HopRole = "q"        // qAC, qAR, ...: added by the APRS-IS server
+	RoleIGate      HopRole = "igate"    // The IGate that gated the packet from RF
+	RoleServer     HopRole = "server"   // An APRS-IS server that handled the packet
+)
+
+// PathHop is one entry of a packet's path.
+type PathHop struct {
+	Call      string  `json:"call"` // Without the trailing *
+	Role      HopRole `json:"role"`
+	Used      bool    `json:"used"`                // Marked as digipeated (H-bit), or handled on APRS-IS
+	N         int     `json:"n,omitempty"`         // For WIDEn-N style aliases: n
+	Remaining int     `json:"remaining,omitempty"` // For WIDEn-N style aliases: hops left (N)
+}
+
+// Path is a typed view of a TNC2 destination and path.
+type Path struct {
+	ToCall     string
+	Hops       []PathHop
+	QConstruct string // e.g. "qAR"; empty if the packet never passed an APRS-IS server
+	IGate      string // The receiving IGate, if the packet was gated from RF
+}
+
+// nAliasRe matches new-paradigm aliases such as WIDE2-1, WIDE1, TRACE3-3.
+var nAliasRe = regexp.MustCompile(`^(WIDE|TRACE|TEMP)([1-7])(?:-([0-7]))?$`)
+
+// plainAliases are aliases without an n-N part.
+var plainAliases = map[string]bool{
+	"WIDE": true, "TRACE": true, "RELAY": true, "ECHO": true, "GATE": true,
+	"RFONLY": true, "NOGATE": true,
+}
+
+// isQConstruct reports whether s is a q-construct like qAC or qAR.
+func isQConstruct(s string) bool {
+	return len(s) == 3 && s[0] == 'q' && s[1] >= 'A' && s[1] <= 'Z'
+}
+
+// igateQ are the q-constructs whose callsign is the IGate that heard the packet on RF.
+var igateQ = map[string]bool{"qAR": true, "qAr": true, "qAo": true, "qAO": true}
+
+// ParsePath types a path as kept in MessagePacket.Path: destination first,
+// then digipeaters, then any TCPIP and q-construct entries.
+func ParsePath(fields []string) Path {
+	var p Path
+	if len(fields) == 0 {
+		return p
+	}
+	p.ToCall = fields[0]
+	fields = fields[1:]
+
+	// Every hop up to the last * has been used.
+	lastUsed := -1
+	for i, f := range fields {
+		if strings.HasSuffix(f, "*") {
+			lastUsed = i
+		}
+	}
+
+	afterQ := false
+	afterInternet := false
+	for i, f := range fields {
+		call := strings.TrimSuffix(f, "*")
+		hop := PathHop{Call: call, Used: i <= lastUsed}
+		upper := strings.ToUpper(call)
+		switch {
+		case isQConstruct(call):
+			hop.Role, hop.Used = RoleQConstruct, true
+			p.QConstruct = call
+			afterQ = true
+		case afterQ:
+			// The first callsign after the q-construct names who inserted it;
+			// anything after that is a server trace (qAI).
+			hop.Used = true
+			hop.Role = RoleServer
+			if igateQ[p.QConstruct] && p.IGate == "" {
+				hop.Role = RoleIGate
+				p.IGate = call
+			}
+		case upper == "TCPIP" || upper == "TCPXX":
+			hop.Role = RoleInternet
+			afterInternet = true
+		case afterInternet && hop.Used:
+			// }SRC>DST,TCPIP,GATE*: the station that gated it to RF.
+			hop.Role = RoleIGate
+		case plainAliases[upper]:
+			hop.Role = RoleAlias
+		default:
+			if m := nAliasRe.FindStringSubmatch(upper); m != nil {
+				hop.Role = RoleAlias
+				hop.N, _ = strconv.Atoi(m[2])
+				if m[3] != "" {
+					hop.Remaining, _ = strconv.Atoi(m[3])
+				}
+				break
+			}
+			hop.Role = RoleDigi
+		}
+		p.Hops = append(p.Hops, hop)
+	}
+	return p
+}
+
+// Travelled returns the hops that handled the packet, in order: used
+// digipeaters and aliases, the receiving IGate and APRS-IS servers.
+func (p Path) Travelled() []PathHop {
+	var out []PathHop
+	for _, h := range p.Hops {
+		if h.Used && h.Role != RoleInternet && h.Role != RoleQConstruct {
+			out = append(out, h)
+		}
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package aprs
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParsePath tests hop roles, used hops, q-constructs and the receiving IGate
+func TestParsePath(t *testing.T) {
+	cases := []struct {
+		path      string
+		q, igate  string
+		hops      []PathHop
+		travelled string
+	}{
+		{"APRS,N8DEU-7*,WIDE1*,WIDE2-1,qAR,K8SDR-10", "qAR", "K8SDR-10", []PathHop{
+			{Call: "N8DEU-7", Role: RoleDigi, Used: true},
+			{Call: "WIDE1", Role: RoleAlias, Used: true, N: 1},
+			{Call: "WIDE2-1", Role: RoleAlias, N: 2, Remaining: 1},
+			{Call: "qAR", Role: RoleQConstruct, Used: true},
+			{Call: "K8SDR-10", Role: RoleIGate, Used: true},
+		}, "N8DEU-7,WIDE1,K8SDR-10"},
+		{"APDR16,TCPIP*,qAC,T2TEST", "qAC", "", []PathHop{
+			{Call: "TCPIP", Role: RoleInternet, Used: true},
+			{Call: "qAC", Role: RoleQConstruct, Used: true},
+			{Call: "T2TEST", Role: RoleServer, Used: true},
+		}, "T2TEST"},
+		{"APRS,TCPXX*,qAX,T2SERVER", "qAX", "", nil, "T2SERVER"},
+		{"APRS,qAI,T2ONE,T2TWO", "qAI", "", nil, "T2ONE,T2TWO"},
+		{"APRS,TCPIP,IGATE-1*", "", "", []PathHop{
+			{Call: "TCPIP", Role: RoleInternet, Used: true},
+			{Call: "IGATE-1", Role: RoleIGate, Used: true},
+		}, "IGATE-1"},
+		{"APRS,RELAY,WIDE", "", "", []PathHop{
+			{Call: "RELAY", Role: RoleAlias},
+			{Call: "WIDE", Role: RoleAlias},
+		}, ""},
+		{"APRS", "", "", nil, ""},
+	}
+	for _, c := range cases {
+		p := ParsePath(strings.Split(c.path, ","))
+		if p.ToCall != strings.Split(c.path, ",")[0] || p.QConstruct != c.q || p.IGate != c.igate {
+			t.Fatalf("%s: unexpected %+v", c.path, p)
+		}
+		if c.hops != nil {
+			if len(p.Hops) != len(c.hops) {
+				t.Fatalf("%s: expected %d hops, got %+v", c.path, len(c.hops), p.Hops)
+			}
+			for i := range c.hops {
+				if p.Hops[i] != c.hops[i] {
+					t.Fatalf("%s: expected hop %+v, got %+v", c.path, c.hops[i], p.Hops[i])
+				}
+			}
+		}
+		var calls []string
+		for _, h := range p.Travelled() {
+			calls = append(calls, h.Call)
+		}
+		if got := strings.Join(calls, ","); got != c.travelled {
+			t.Fatalf("%s: expected travelled '%s', got '%s'", c.path, c.travelled, got)
+		}
+	}
+}
+
+// TestBuildRoute tests the route sent to the app: sender, travelled hops with roles, recipient
+func TestBuildRoute(t *testing.T) {
+	hops := ParsePath(strings.Split("APRS,N8DEU-7*,WIDE2-1,qAR,K8SDR-10", ",")).Travelled()
+	route := BuildRoute("N0CALL-9", "AD8NT", hops)
+	expected := []RouteHop{
+		{Callsign: "N0CALL-9"},
+		{Callsign: "N8DEU-7", Role: RoleDigi},
+		{Callsign: "K8SDR-10", Role: RoleIGate},
+		{Callsign: "AD8NT"},
+	}
+	if len(route) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, route)
+	}
+	for i := range expected {
+		if route[i] != expected[i] {
+			t.Fatalf("Expected %+v, got %+v", expected[i], route[i])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package aprs
+
+import (
+	"log"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+	"aprsmessenger-gateway/internal/models"
+)
+
+// refusal reports why a message from source (base callsign) for user is
+// not delivered, and the action the policy sets, or an empty reason if it is
+// delivered. A copy of a message already stored skips the quota check.
+func (am *APRSManager) refusal(user *models.User, source string, stored bool) (reason, action string, err error) {
+	cfg := config.Get()
+	settings, err := db.GetUserSettings(user.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if suspended, err := db.IsSuspended(user.ID); err != nil || suspended {
+		return db.ReasonSuspended, cfg.Policy.Suspended, err
+	}
+	if blocked, err := db.IsBlocked(user.ID, source); err != nil || blocked {
+		return db.ReasonBlocked, userAction(settings.BlockedAction, cfg.Policy.Blocked), err
+	}
+	if quota := cfg.Inbound.DailyQuota; quota > 0 && !stored {
+		count, err := db.CountMessagesReceivedSince(user.Callsign, am.clock.Now().Add(-24*time.Hour))
+		if err != nil || count >= quota {
+			return db.ReasonQuota, userAction(settings.QuotaAction, cfg.Policy.Quota), err
+		}
+	}
+	return "", "", nil
+}
+
+// userAction returns the user's chosen action, or the gateway default if they have none.
+func userAction(chosen, def string) string {
+	if chosen != "" {
+		return chosen
+	}
+	return def
+}
+
+// refuseDeleted applies the deleted-account policy to a message for a
+// callsign that is not a member, if it used to be one.
+func (am *APRSManager) refuseDeleted(msg *MessagePacket, base string) {
+	deleted, err := db.IsDeletedAccount(base)
+	if err != nil {
+		log.Printf("[DB] Could not check for deleted account %s: %v", base, err)
+		return
+	}
+	if !deleted {
+		return
+	}
+	// Answered, but not logged: nothing more is kept for a deleted account.
+	action := config.Get().Policy.Deleted
+	key := newDedupKey(msg.Source, msg.Addressee, msg.MsgNo, msg.MessageText)
+	if _, dup := am.dedup.check(key); !dup {
+		log.Printf("[POLICY] Refused message from %s to deleted account %s: %s", msg.Source, base, action)
+		am.dedup.store(key, 0)
+	}
+	am.refuse(msg, base, db.ReasonDeleted, action, false)
+}
+
+// refuse answers a message the gateway will not deliver to user (base
+// callsign) as action says. The first copy is logged for the user to see;
+// retries are answered again but not logged.
+func (am *APRSManager) refuse(msg *MessagePacket, user, reason, action string, record bool) {
+	if msg.MsgNo != "" {
+		switch action {
+		case db.ActionRej:
+			am.SendMessage(msg.Addressee, msg.Source, "rej"+msg.MsgNo)
+		case db.ActionAck:
+			am.SendMessage(msg.Addressee, msg.Source, "ack"+msg.MsgNo)
+		}
+	}
+	if !record {
+		return
+	}
+	log.Printf("[POLICY] Refused message from %s to %s (%s): %s", msg.Source, msg.Addressee, reason, action)
+
+	d := &db.PolicyDecision{
+		UserCallsign: user,
+		FromCallsign: msg.Source,
+		ToCallsign:   msg.Addressee,
+		MsgNo:        msg.MsgNo,
+		Message:      msg.MessageText,
+		Reason:       reason,
+		Action:       action,
+		CreatedAt:    am.clock.Now().UTC(),
+	}
+	if err := db.LogPolicyDecision(d); err != nil {
+		log.Printf("[DB] Failed to log policy decision for %s: %v", user, err)
+	}
+	am.prunePolicyLog(d.CreatedAt)
+	if session := GetSessionsManager().GetSession(user); session != nil {
+		session.SendAll(map[string]interface{}{"type": "policy_decision", "decision": d})
+	}
+}
+
+// prunePolicyLog deletes decisions older than the retention, at most once an hour.
+func (am *APRSManager) prunePolicyLog(now time.Time) {
+	am.policyMu.Lock()
+	prune := now.Sub(am.policyPruned) >= time.Hour
+	if prune {
+		am.policyPruned = now
+	}
+	am.policyMu.Unlock()
+	if !prune {
+		return
+	}
+	if n, err := db.PrunePolicyDecisions(now.Add(-config.Get().Policy.LogRetain.D())); err != nil {
+		log.Printf("[DB] Failed to prune the policy log: %v", err)
+	} else if n > 0 {
+		log.Printf("[POLICY] Pruned %d old decision(s)", n)
+	}
+}
@@ -0,0 +1,86 @@
+package aprs
+
+import (
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprstest"
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+	"aprsmessenger-gateway/internal/models"
+)
+
+// TestRefusalQuotaWindow tests that the daily quota counts messages stored in the last 24 hours of the manager's clock
+func TestRefusalQuotaWindow(t *testing.T) {
+	if old, _ := db.GetUserByCallsign("N0QTA"); old != nil {
+		if err := db.DeleteUserAndData(old.ID); err != nil {
+			t.Fatalf("DeleteUserAndData: %v", err)
+		}
+	}
+	if err := db.CreateUser(&models.User{Callsign: "N0QTA", PasswordHash: "x", Passcode: "0"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, _ := db.GetUserByCallsign("N0QTA")
+
+	// Far from the wall clock, so only the manager's clock can place these in the window.
+	clock := aprstest.NewClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	am := NewAPRSManagerWithOptions(ManagerOptions{Clock: clock})
+	quota := config.Get().Inbound.DailyQuota
+	for i := 0; i < quota-1; i++ {
+		if _, err := db.InsertMessage("N0QTA", "W1AW", "Filler", clock.Now().Add(-23*time.Hour)); err != nil {
+			t.Fatalf("InsertMessage: %v", err)
+		}
+	}
+	if reason, _, err := am.refusal(user, "W1AW", false); err != nil || reason != "" {
+		t.Fatalf("Expected a message under the quota to be delivered, got '%s' (%v)", reason, err)
+	}
+
+	if _, err := db.InsertMessage("N0QTA", "W1AW", "Last", clock.Now()); err != nil {
+		t.Fatalf("InsertMessage: %v", err)
+	}
+	reason, _, err := am.refusal(user, "W1AW", false)
+	if err != nil || reason != db.ReasonQuota {
+		t.Fatalf("Expected '%s', got '%s' (%v)", db.ReasonQuota, reason, err)
+	}
+	if reason, _, _ = am.refusal(user, "W1AW", true); reason != "" {
+		t.Fatalf("Expected a stored copy to skip the quota, got '%s'", reason)
+	}
+
+	// The fillers leave the window; the last message stays in it.
+	clock.Advance(90 * time.Minute)
+	if reason, _, err = am.refusal(user, "W1AW", false); err != nil || reason != "" {
+		t.Fatalf("Expected the quota to free up once old messages age out, got '%s' (%v)", reason, err)
+	}
+	if n, _ := db.CountMessagesReceivedSince("N0QTA", clock.Now().Add(-24*time.Hour)); n != 1 {
+		t.Fatalf("Expected %d, got %d", 1, n)
+	}
+}
+
+// TestPolicyLogPrune tests that refusals older than the retention are deleted
+func TestPolicyLogPrune(t *testing.T) {
+	if old, _ := db.GetUserByCallsign("N0PLG"); old != nil {
+		if err := db.DeleteUserAndData(old.ID); err != nil {
+			t.Fatalf("DeleteUserAndData: %v", err)
+		}
+	}
+	if err := db.CreateUser(&models.User{Callsign: "N0PLG", PasswordHash: "x", Passcode: "0"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	clock := aprstest.NewClock(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	am := NewAPRSManagerWithOptions(ManagerOptions{Clock: clock})
+	msg := &MessagePacket{Source: "W1AW", Addressee: "N0PLG", MessageText: "First"}
+	am.refuse(msg, "N0PLG", db.ReasonBlocked, db.ActionDrop, true)
+
+	clock.Advance(config.Get().Policy.LogRetain.D() + time.Hour)
+	msg = &MessagePacket{Source: "W1AW", Addressee: "N0PLG", MessageText: "Second"}
+	am.refuse(msg, "N0PLG", db.ReasonBlocked, db.ActionDrop, true)
+
+	d, err := db.ListPolicyDecisions("N0PLG", 0)
+	if err != nil {
+		t.Fatalf("ListPolicyDecisions: %v", err)
+	}
+	if len(d) != 1 || d[0].Message != "Second" {
+		t.Fatalf("Expected '%s', got %d decision(s)", "Second", len(d))
+	}
+}
@@ -0,0 +1,452 @@
+package aprs
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Position formats.
+const (
+	PositionUncompressed = "uncompressed"
+	PositionCompressed   = "compressed"
+	PositionMicE         = "mic-e"
+)
+
+// Position is a decoded APRS position report.
+type Position struct {
+	Source    string    `json:"source"` // Originating station; the inner one for third-party packets
+	Format    string    `json:"format"`
+	Lat       float64   `json:"lat"`                 // Degrees, north positive
+	Lon       float64   `json:"lon"`                 // Degrees, east positive
+	Ambiguity int       `json:"ambiguity,omitempty"` // Trailing digits left blank, 0-4
+	Symbol    string    `json:"symbol"`              // Table (or overlay) then code, e.g. "/>"
+	Timestamp time.Time `json:"timestamp,omitempty"` // Zero unless the report carries one
+	Messaging bool      `json:"messaging"`           // The station can receive messages ('=' and '@' reports)
+
+	HasCourse bool    `json:"has_course"`
+	Course    int     `json:"course,omitempty"` // Degrees; 0 means unknown
+	Speed     float64 `json:"speed,omitempty"`  // Knots
+
+	HasAltitude bool    `json:"has_altitude"`
+	Altitude    float64 `json:"altitude,omitempty"` // Metres
+
+	Range      float64 `json:"range,omitempty"`       // Radio range in miles, from compressed reports
+	MicEStatus string  `json:"mice_status,omitempty"` // Mic-E message, e.g. "En Route"
+	Comment    string  `json:"comment,omitempty"`
+}
+
+// Position errors.
+var (
+	ErrNotAPosition = &ParseError{"not an APRS position report"}
+	ErrBadPosition  = &ParseError{"malformed APRS position"}
+)
+
+// ParsePosition decodes the position report in a TNC2 line. now resolves
+// the day and month a timestamp leaves out; local-time "/" timestamps are
+// read in now's location, as the sender's zone is unknown.
+func ParsePosition(line string, now time.Time) (*Position, error) {
+	src, dst, info, ok := innerPacket(line)
+	if !ok {
+		return nil, ErrNotAPosition
+	}
+	p, err := decodePosition(dst, info, now)
+	if err != nil {
+		return nil, err
+	}
+	p.Source = strings.ToUpper(src)
+	return p, nil
+}
+
+// innerPacket splits a TNC2 line, unwrapping third-party packets to the
+// innermost one. ok is false if there is no information field.
+func innerPacket(line string) (src, dst, info string, ok bool) {
+	for depth := 0; ; depth++ {
+		src, dst, _, info, ok := splitTNC2(line)
+		if !ok || info == "" {
+			return "", "", "", false
+		}
+		if info[0] == '}' && depth < maxThirdPartyDepth {
+			line = info[1:]
+			continue
+		}
+		return src, dst, info, true
+	}
+}
+
+// decodePosition decodes an information field by its data type identifier.
+// The destination matters only for Mic-E.
+func decodePosition(dst, info string, now time.Time) (*Position, error) {
+	switch info[0] {
+	case '!', '=':
+		p, err := decodePositionBody(info[1:])
+		if err != nil {
+			return nil, err
+		}
+		p.Messaging = info[0] == '='
+		return p, nil
+	case '/', '@':
+		if len(info) < 8 {
+			return nil, ErrBadPosition
+		}
+		ts, err := parseTimestamp(info[1:8], now)
+		if err != nil {
+			return nil, err
+		}
+		p, err := decodePositionBody(info[8:])
+		if err != nil {
+			return nil, err
+		}
+		p.Timestamp = ts
+		p.Messaging = info[0] == '@'
+		return p, nil
+	case '`', '\'', 0x1c, 0x1d:
+		return decodeMicE(dst, info)
+	}
+	return nil, ErrNotAPosition
+}
+
+// decodePositionBody decodes a position that is compressed if it does not
+// start with a latitude digit.
+func decodePositionBody(body string) (*Position, error) {
+	if body == "" {
+		return nil, ErrBadPosition
+	}
+	if body[0] >= '0' && body[0] <= '9' || body[0] == ' ' {
+		return decodeUncompressed(body)
+	}
+	return decodeCompressed(body)
+}
+
+// parseTimestamp reads a DHM ("092345z" UTC, "092345/" local) or HMS
+// ("234517h") timestamp as the latest such time not after now (allowing an
+// hour for clock skew).
+func parseTimestamp(ts string, now time.Time) (time.Time, error) {
+	a, err1 := strconv.Atoi(ts[0:2])
+	b, err2 := strconv.Atoi(ts[2:4])
+	c, err3 := strconv.Atoi(ts[4:6])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return time.Time{}, ErrBadPosition
+	}
+	limit := now.Add(time.Hour)
+	switch ts[6] {
+	case 'z', '/':
+		loc := time.UTC
+		if ts[6] == '/' {
+			loc = now.Location()
+		}
+		ref := now.In(loc)
+		t := time.Date(ref.Year(), ref.Month(), a, b, c, 0, 0, loc)
+		if a < 1 || a > 31 || b > 23 || c > 59 {
+			return time.Time{}, ErrBadPosition
+		}
+		for i := 0; t.After(limit) || t.Day() != a; i++ {
+			if i == 12 {
+				return time.Time{}, ErrBadPosition
+			}
+			// Last month, or an earlier one if last month is too short.
+			ref = time.Date(ref.Year(), ref.Month()-1, 1, 0, 0, 0, 0, loc)
+			t = time.Date(ref.Year(), ref.Month(), a, b, c, 0, 0, loc)
+		}
+		return t, nil
+	case 'h':
+		if a > 23 || b > 59 || c > 59 {
+			return time.Time{}, ErrBadPosition
+		}
+		ref := now.UTC()
+		t := time.Date(ref.Year(), ref.Month(), ref.Day(), a, b, c, 0, time.UTC)
+		if t.After(limit) {
+			t = t.AddDate(0, 0, -1)
+		}
+		return t, nil
+	}
+	return time.Time{}, ErrBadPosition
+}
+
+// Uncompressed extensions and comment fields.
+var (
+	courseSpeedRe = regexp.MustCompile(`^(\d{3})/(\d{3})`)
+	altitudeRe    = regexp.MustCompile(`/A=(-?\d{5,6})`)
+)
+
+// decodeUncompressed decodes "4903.50N/07201.75W-" followed by an optional
+// course/speed extension and a comment.
+func decodeUncompressed(body string) (*Position, error) {
+	if len(body) < 19 {
+		return nil, ErrBadPosition
+	}
+	lat, latAmb, ok := parseUncompressedCoord(body[0:7], 2)
+	if !ok || (body[7] != 'N' && body[7] != 'S') || lat > 90 {
+		return nil, ErrBadPosition
+	}
+	lon, lonAmb, ok := parseUncompressedCoord(body[9:17], 3)
+	if !ok || (body[17] != 'E' && body[17] != 'W') || lon > 180 {
+		return nil, ErrBadPosition
+	}
+	if body[7] == 'S' {
+		lat = -lat
+	}
+	if body[17] == 'W' {
+		lon = -lon
+	}
+	p := &Position{
+		Format:    PositionUncompressed,
+		Lat:       lat,
+		Lon:       lon,
+		Ambiguity: max(latAmb, lonAmb),
+		Symbol:    string([]byte{body[8], body[18]}),
+	}
+	comment := body[19:]
+	if m := courseSpeedRe.FindStringSubmatch(comment); m != nil {
+		p.HasCourse = true
+		p.Course, _ = strconv.Atoi(m[1])
+		speed, _ := strconv.Atoi(m[2])
+		p.Speed = float64(speed)
+		comment = comment[7:]
+	}
+	p.Comment, p.HasAltitude, p.Altitude = takeAltitude(comment)
+	return p, nil
+}
+
+// parseUncompressedCoord reads ddmm.hh (degDigits of degrees) with any
+// trailing digits blanked for ambiguity, returning degrees at the middle of
+// the ambiguous area.
+func parseUncompressedCoord(s string, degDigits int) (float64, int, bool) {
+	if len(s) != degDigits+5 || s[degDigits+2] != '.' {
+		return 0, 0, false
+	}
+	digits := []byte(s[:degDigits+2] + s[degDigits+3:])
+	ambiguity := 0
+	for i := len(digits) - 1; i >= 0 && digits[i] == ' '; i-- {
+		ambiguity++
+	}
+	// Only the minutes can be blanked.
+	if ambiguity > 4 {
+		return 0, 0, false
+	}
+	for i := range digits {
+		if digits[i] == ' ' && i >= len(digits)-ambiguity {
+			digits[i] = '0'
+		}
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, 0, false
+		}
+	}
+	deg, _ := strconv.Atoi(string(digits[:degDigits]))
+	hundredths, _ := strconv.Atoi(string(digits[degDigits:]))
+	minutes := float64(hundredths) / 100
+	if minutes >= 60 {
+		return 0, 0, false
+	}
+	if ambiguity > 0 {
+		// Blanked digits are worth 0.01', 0.1', 1' and 10'.
+		minutes += []float64{0.005, 0.05, 0.5, 5}[ambiguity-1]
+	}
+	return float64(deg) + minutes/60, ambiguity, true
+}
+
+// takeAltitude removes a "/A=aaaaaa" altitude in feet from a comment and
+// returns it in metres.
+func takeAltitude(comment string) (string, bool, float64) {
+	loc := altitudeRe.FindStringSubmatchIndex(comment)
+	if loc == nil {
+		return comment, false, 0
+	}
+	feet, _ := strconv.Atoi(comment[loc[2]:loc[3]])
+	return comment[:loc[0]] + comment[loc[1]:], true, feetToMetres(float64(feet))
+}
+
+func feetToMetres(feet float64) float64 { return feet * 0.3048 }
+
+// base91 decodes printable Base91 digits ('!' is zero).
+func base91(s string) (int, bool) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 124 {
+			return 0, false
+		}
+		n = n*91 + int(s[i]-33)
+	}
+	return n, true
+}
+
+// decodeCompressed decodes "/5L!!<*e7>7P[": symbol table, Base91 latitude
+// and longitude, symbol code, then course/speed, range or altitude and the
+// compression type.
+func decodeCompressed(body string) (*Position, error) {
+	if len(body) < 13 {
+		return nil, ErrBadPosition
+	}
+	y, ok1 := base91(body[1:5])
+	x, ok2 := base91(body[5:9])
+	if !ok1 || !ok2 {
+		return nil, ErrBadPosition
+	}
+	table := body[0]
+	if table >= 'a' && table <= 'j' {
+		table = '0' + table - 'a' // Overlay digits are sent as letters
+	}
+	p := &Position{
+		Format:  PositionCompressed,
+		Lat:     90 - float64(y)/380926,
+		Lon:     -180 + float64(x)/190463,
+		Symbol:  string([]byte{table, body[9]}),
+		Comment: body[13:],
+	}
+	if math.Abs(p.Lat) > 90 || math.Abs(p.Lon) > 180 {
+		return nil, ErrBadPosition
+	}
+
+	c, s, t := int(body[10])-33, int(body[11])-33, int(body[12])-33
+	switch {
+	case body[10] == ' ':
+		// No course, speed, range or altitude.
+	case t >= 0 && (t>>3)&3 == 2:
+		// From a GGA sentence: cs is the altitude.
+		p.HasAltitude = true
+		p.Altitude = feetToMetres(math.Pow(1.002, float64(c*91+s)))
+	case c >= 0 && c <= 89:
+		p.HasCourse = true
+		p.Course = c * 4
+		p.Speed = math.Pow(1.08, float64(s)) - 1
+	case c == 90:
+		p.Range = 2 * math.Pow(1.08, float64(s))
+	}
+	if !p.HasAltitude {
+		p.Comment, p.HasAltitude, p.Altitude = takeAltitude(p.Comment)
+	}
+	return p, nil
+}
+
+// micEStatus names the Mic-E messages by their three message bits, for
+// standard and custom encodings.
+var micEStatus = [2][8]string{
+	{"Emergency", "Priority", "Special", "Committed", "Returning", "In Service", "En Route", "Off Duty"},
+	{"Emergency", "Custom-6", "Custom-5", "Custom-4", "Custom-3", "Custom-2", "Custom-1", "Custom-0"},
+}
+
+// decodeMicE decodes a Mic-E report: latitude, message bits and flags from
+// the destination, longitude, course/speed, symbol, altitude and comment from
+// the information field.
+func decodeMicE(dst, info string) (*Position, error) {
+	dst = strings.ToUpper(baseCallsign(dst))
+	if len(dst) != 6 || len(info) < 9 {
+		return nil, ErrBadPosition
+	}
+
+	var digits [6]byte
+	var bits [3]int
+	custom, standard := false, false
+	ambiguity := 0
+	flags := [6]bool{} // Per character: set for P-Z (and A-K in the message positions)
+	for i := 0; i < 6; i++ {
+		ch := dst[i]
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits[i] = ch
+		case ch >= 'A' && ch <= 'J' && i < 3:
+			digits[i], flags[i], custom = ch-'A'+'0', true, true
+		case ch == 'K' && i < 3:
+			digits[i], flags[i], custom = ' ', true, true
+		case ch == 'L':
+			digits[i] = ' '
+		case ch >= 'P' && ch <= 'Y':
+			digits[i], flags[i] = ch-'P'+'0', true
+			if i < 3 {
+				standard = true
+			}
+		case ch == 'Z':
+			digits[i], flags[i] = ' ', true
+			if i < 3 {
+				standard = true
+			}
+		default:
+			return nil, ErrBadPosition
+		}
+		if digits[i] == ' ' {
+			ambiguity++
+		} else if ambiguity > 0 {
+			return nil, ErrBadPosition // Only trailing digits may be blanked
+		}
+		if i < 3 && flags[i] {
+			bits[i] = 1
+		}
+	}
+	lat, _, ok := parseUncompressedCoord(string(digits[:4])+"."+string(digits[4:]), 2)
+	if !ok {
+		return nil, ErrBadPosition
+	}
+	if !flags[3] {
+		lat = -lat
+	}
+
+	d := int(info[1]) - 28
+	if flags[4] {
+		d += 100
+	}
+	if d >= 180 && d <= 189 {
+		d -= 80
+	} else if d >= 190 && d <= 199 {
+		d -= 190
+	}
+	m := int(info[2]) - 28
+	if m >= 60 {
+		m -= 60
+	}
+	h := int(info[3]) - 28
+	if d < 0 || d > 179 || m < 0 || m > 59 || h < 0 || h > 99 {
+		return nil, ErrBadPosition
+	}
+	lon := float64(d) + (float64(m)+float64(h)/100)/60
+	if flags[5] {
+		lon = -lon
+	}
+
+	sp, dc, se := int(info[4])-28, int(info[5])-28, int(info[6])-28
+	speed := sp*10 + dc/10
+	if speed >= 800 {
+		speed -= 800
+	}
+	course := (dc%10)*100 + se
+	if course >= 400 {
+		course -= 400
+	}
+
+	p := &Position{
+		Format:    PositionMicE,
+		Lat:       lat,
+		Lon:       lon,
+		Ambiguity: ambiguity,
+		Symbol:    string([]byte{info[8], info[7]}),
+		HasCourse: true,
+		Course:    course,
+		Speed:     float64(speed),
+		Messaging: true,
+	}
+	switch {
+	case custom && standard:
+		p.MicEStatus = "Unknown"
+	case custom:
+		p.MicEStatus = micEStatus[1][bits[0]<<2|bits[1]<<1|bits[2]]
+	default:
+		p.MicEStatus = micEStatus[0][bits[0]<<2|bits[1]<<1|bits[2]]
+	}
+
+	// An altitude is three Base91 digits and '}', in metres above -10 km,
+	// possibly after a one-character radio type.
+	rest := info[9:]
+	for _, skip := range []int{0, 1} {
+		if len(rest) >= skip+4 && rest[skip+3] == '}' {
+			if alt, ok := base91(rest[skip : skip+3]); ok {
+				p.HasAltitude = true
+				p.Altitude = float64(alt - 10000)
+				rest = rest[:skip] + rest[skip+4:]
+				break
+			}
+		}
+	}
+	p.Comment = rest
+	return p, nil
+}
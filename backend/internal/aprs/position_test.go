@@ -0,0 +1,95 @@
+package aprs
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestParsePosition tests position decoding against the APRS 1.01 examples
+func TestParsePosition(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name, line string
+		expected   Position
+	}{
+		{"uncompressed", "N0CALL>APRS:!4903.50N/07201.75W-Test 001234",
+			Position{Format: PositionUncompressed, Lat: 49.058333, Lon: -72.029167, Symbol: "/-", Comment: "Test 001234"}},
+		{"messaging", "N0CALL>APRS:=4903.50S\\07201.75E-",
+			Position{Format: PositionUncompressed, Lat: -49.058333, Lon: 72.029167, Symbol: "\\-", Messaging: true}},
+		{"altitude", "N0CALL>APRS:!4903.50N/07201.75W-Test /A=001234",
+			Position{Format: PositionUncompressed, Lat: 49.058333, Lon: -72.029167, Symbol: "/-", Comment: "Test ", HasAltitude: true, Altitude: 376.1232}},
+		{"ambiguous", "N0CALL>APRS:!49  .  N/072  .  W-",
+			Position{Format: PositionUncompressed, Lat: 49.083333, Lon: -72.083333, Ambiguity: 4, Symbol: "/-"}},
+		{"ambiguous hundredths", "N0CALL>APRS:!4903.5 N/07201.7 W-",
+			Position{Format: PositionUncompressed, Lat: 49.058417, Lon: -72.028417, Ambiguity: 1, Symbol: "/-"}},
+		{"course speed", "N0CALL>APRS:!4903.50N/07201.75W>088/036",
+			Position{Format: PositionUncompressed, Lat: 49.058333, Lon: -72.029167, Symbol: "/>", HasCourse: true, Course: 88, Speed: 36}},
+		{"zulu timestamp", "N0CALL>APRS:/092345z4903.50N/07201.75W>Test1234",
+			Position{Format: PositionUncompressed, Lat: 49.058333, Lon: -72.029167, Symbol: "/>", Comment: "Test1234",
+				Timestamp: time.Date(2026, 10, 9, 23, 45, 0, 0, time.UTC)}},
+		{"last month", "N0CALL>APRS:@312345/4903.50N/07201.75W>",
+			Position{Format: PositionUncompressed, Lat: 49.058333, Lon: -72.029167, Symbol: "/>", Messaging: true,
+				Timestamp: time.Date(2026, 8, 31, 23, 45, 0, 0, time.UTC)}},
+		{"hms timestamp", "N0CALL>APRS:/234517h4903.50N/07201.75W>",
+			Position{Format: PositionUncompressed, Lat: 49.058333, Lon: -72.029167, Symbol: "/>",
+				Timestamp: time.Date(2026, 10, 15, 23, 45, 17, 0, time.UTC)}},
+		{"compressed course speed", "N0CALL>APRS:=/5L!!<*e7>7P[",
+			Position{Format: PositionCompressed, Lat: 49.5, Lon: -72.75, Symbol: "/>", Messaging: true, HasCourse: true, Course: 88, Speed: 36.2}},
+		{"compressed altitude", "N0CALL>APRS:!/5L!!<*e7OS]S",
+			Position{Format: PositionCompressed, Lat: 49.5, Lon: -72.75, Symbol: "/O", HasAltitude: true, Altitude: 3049.3}},
+		{"compressed range", "N0CALL>APRS:!/5L!!<*e7>{?!",
+			Position{Format: PositionCompressed, Lat: 49.5, Lon: -72.75, Symbol: "/>", Range: 20.1}},
+		{"compressed overlay", "N0CALL>APRS:!d5L!!<*e7#  !Digi",
+			Position{Format: PositionCompressed, Lat: 49.5, Lon: -72.75, Symbol: "3#", Comment: "Digi"}},
+		{"mic-e", "N0CALL>S32UVT,WIDE2-1:`(_fn\"Oj/\"4T}Test",
+			Position{Format: PositionMicE, Lat: 33.427333, Lon: -112.129, Symbol: "/j", Messaging: true, HasCourse: true, Course: 251, Speed: 20,
+				HasAltitude: true, Altitude: 61, MicEStatus: "Returning", Comment: "Test"}},
+		{"mic-e custom", "N0CALL>B2ERWZ:'(_fn\"Oj/",
+			Position{Format: PositionMicE, Lat: 12.71175, Lon: -112.129, Ambiguity: 1, Symbol: "/j", Messaging: true, HasCourse: true, Course: 251, Speed: 20,
+				MicEStatus: "Custom-2"}},
+		{"third party", "N0CALL>APRS,TCPIP*:}W1AW>APRS,TCPIP,N0CALL*:!4903.50N/07201.75W-",
+			Position{Source: "W1AW", Format: PositionUncompressed, Lat: 49.058333, Lon: -72.029167, Symbol: "/-"}},
+	}
+	near := func(a, b, eps float64) bool { return math.Abs(a-b) < eps }
+	for _, c := range cases {
+		p, err := ParsePosition(c.line, now)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		e := c.expected
+		if e.Source == "" {
+			e.Source = "N0CALL"
+		}
+		if p.Source != e.Source || p.Format != e.Format || p.Symbol != e.Symbol || p.Comment != e.Comment || p.MicEStatus != e.MicEStatus {
+			t.Fatalf("%s: expected '%s %s %s %q %s', got '%s %s %s %q %s'", c.name,
+				e.Source, e.Format, e.Symbol, e.Comment, e.MicEStatus, p.Source, p.Format, p.Symbol, p.Comment, p.MicEStatus)
+		}
+		if !near(p.Lat, e.Lat, 1e-5) || !near(p.Lon, e.Lon, 1e-5) || p.Ambiguity != e.Ambiguity {
+			t.Fatalf("%s: expected position %f,%f (ambiguity %d), got %f,%f (ambiguity %d)", c.name, e.Lat, e.Lon, e.Ambiguity, p.Lat, p.Lon, p.Ambiguity)
+		}
+		if p.HasCourse != e.HasCourse || p.Course != e.Course || !near(p.Speed, e.Speed, 0.05) {
+			t.Fatalf("%s: expected course %d speed %.1f, got %d speed %.1f", c.name, e.Course, e.Speed, p.Course, p.Speed)
+		}
+		if p.HasAltitude != e.HasAltitude || !near(p.Altitude, e.Altitude, 0.5) || !near(p.Range, e.Range, 0.05) {
+			t.Fatalf("%s: expected altitude %.1f range %.1f, got %.1f range %.1f", c.name, e.Altitude, e.Range, p.Altitude, p.Range)
+		}
+		if !p.Timestamp.Equal(e.Timestamp) || p.Messaging != e.Messaging {
+			t.Fatalf("%s: expected timestamp '%s', got '%s'", c.name, e.Timestamp, p.Timestamp)
+		}
+	}
+
+	for _, line := range []string{
+		"N0CALL>APRS::W1AW     :hello{01}",
+		"N0CALL>APRS:!4903.50X/07201.75W-",
+		"N0CALL>APRS:!4963.50N/07201.75W-",
+		"N0CALL>APRS:!49 3.50N/07201.75W-",
+		"N0CALL>APRS:/992345z4903.50N/07201.75W>",
+		"N0CALL>APRS:!/5L!",
+		"N0CALL>APRS:`(_fn\"Oj/",
+	} {
+		if _, err := ParsePosition(line, now); err == nil {
+			t.Fatalf("Expected an error for '%s'", line)
+		}
+	}
+}
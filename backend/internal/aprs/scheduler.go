@@ -0,0 +1,281 @@
+package aprs
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+)
+
+// Priority orders queued outbound packets; lower values go first.
+type Priority int
+
+const (
+	PriorityAck     Priority = iota // Acks and rejs: the sender is waiting on them
+	PriorityMessage                 // New messages and everything else
+	numPriorities
+)
+
+// Reasons the scheduler drops a packet instead of queueing it.
+var (
+	ErrQueueFull     = errors.New("outbound queue is full")
+	ErrUserQueueFull = errors.New("too many packets queued for this user")
+)
+
+// OutboundPacket is one packet waiting to be transmitted.
+type OutboundPacket struct {
+	Line     string
+	Kind     TransportKind
+	User     string // Base callsign charged for the packet; empty for the gateway itself
+	Gated    bool   // Passed on by the IGate, and so not offered to it again
+	Priority Priority
+	queued   time.Time
+}
+
+// SchedulerStats reports the queue and what the scheduler decided.
+type SchedulerStats struct {
+	QueueDepth  int            `json:"queue_depth"`
+	QueuedAcks  int            `json:"queued_acks"`
+	Sent        int            `json:"sent"`
+	Failed      int            `json:"failed"` // Released, but no transport took it
+	Coalesced   int            `json:"coalesced"`
+	Dropped     int            `json:"dropped"`
+	DropReasons map[string]int `json:"drop_reasons"`
+	OldestWait  string         `json:"oldest_wait,omitempty"`
+}
+
+// tokenBucket refills at rate tokens per second up to burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	if b.last.IsZero() {
+		b.tokens, b.last = float64(burst), now
+		return
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+}
+
+// wait returns how long until a token is available.
+func (b *tokenBucket) wait(rate float64) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// Scheduler queues outbound packets and paces them with a global token bucket
+// and one per user, sending acks ahead of messages and sending identical
+// packets only once per coalesce window.
+type Scheduler struct {
+	clock Clock
+	send  func(p OutboundPacket) error
+
+	mu     sync.Mutex
+	queues [numPriorities][]*OutboundPacket
+	global tokenBucket
+	users  map[string]*tokenBucket
+	recent map[string]time.Time // Kind and line -> last enqueued
+	stats  SchedulerStats
+	wake   chan struct{}
+}
+
+// NewScheduler creates a scheduler that transmits with send.
+func NewScheduler(clock Clock, send func(p OutboundPacket) error) *Scheduler {
+	return &Scheduler{
+		clock:  clock,
+		send:   send,
+		users:  make(map[string]*tokenBucket),
+		recent: make(map[string]time.Time),
+		stats:  SchedulerStats{DropReasons: make(map[string]int)},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues a packet. It returns nil when the packet was queued or
+// coalesced with an identical one, and an error when it was dropped.
+func (s *Scheduler) Enqueue(p OutboundPacket) error {
+	cfg := config.Get().Outbound
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	s.pruneRecentLocked(now, cfg.CoalesceWindow.D())
+
+	key := string(p.Kind) + "|" + p.Line
+	if t, ok := s.recent[key]; ok && now.Sub(t) < cfg.CoalesceWindow.D() {
+		s.stats.Coalesced++
+		return nil
+	}
+
+	if p.User != "" && p.Priority != PriorityAck && s.queuedForLocked(p.User) >= cfg.MaxPerUser {
+		s.dropLocked("user_queue_full", p)
+		return ErrUserQueueFull
+	}
+	if s.depthLocked() >= cfg.MaxQueue {
+		// An ack may push out the newest queued message; anything else is dropped.
+		msgs := s.queues[PriorityMessage]
+		if p.Priority != PriorityAck || len(msgs) == 0 {
+			s.dropLocked("queue_full", p)
+			return ErrQueueFull
+		}
+		s.dropLocked("evicted_for_ack", *msgs[len(msgs)-1])
+		s.queues[PriorityMessage] = msgs[:len(msgs)-1]
+	}
+
+	p.queued = now
+	s.recent[key] = now
+	s.queues[p.Priority] = append(s.queues[p.Priority], &p)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Scheduler) dropLocked(reason string, p OutboundPacket) {
+	s.stats.Dropped++
+	s.stats.DropReasons[reason]++
+	log.Printf("[SCHED] Dropped packet (%s) for %s: %s", reason, p.User, p.Line)
+}
+
+func (s *Scheduler) depthLocked() int {
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+func (s *Scheduler) queuedForLocked(user string) int {
+	n := 0
+	for _, q := range s.queues {
+		for _, p := range q {
+			if p.User == user {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *Scheduler) pruneRecentLocked(now time.Time, window time.Duration) {
+	for k, t := range s.recent {
+		if now.Sub(t) >= window {
+			delete(s.recent, k)
+		}
+	}
+}
+
+// userBucketLocked returns the user's bucket, refilled to now.
+func (s *Scheduler) userBucketLocked(user string, now time.Time, cfg config.OutboundConfig) *tokenBucket {
+	b := s.users[user]
+	if b == nil {
+		b = &tokenBucket{}
+		s.users[user] = b
+	}
+	b.refill(now, cfg.UserRate, cfg.UserBurst)
+	return b
+}
+
+// take removes and returns the first packet allowed to go now, in priority
+// order. Packets from a user who is out of tokens wait without holding up
+// other users. If nothing can go, it returns how long to wait (0 when the
+// queue is empty).
+func (s *Scheduler) take() (*OutboundPacket, time.Duration) {
+	cfg := config.Get().Outbound
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.depthLocked() == 0 {
+		return nil, 0
+	}
+	now := s.clock.Now()
+	s.global.refill(now, cfg.GlobalRate, cfg.GlobalBurst)
+	if w := s.global.wait(cfg.GlobalRate); w > 0 {
+		return nil, w
+	}
+
+	var soonest time.Duration = -1
+	for pri := range s.queues {
+		for i, p := range s.queues[pri] {
+			if p.User != "" && p.Priority != PriorityAck {
+				b := s.userBucketLocked(p.User, now, cfg)
+				if w := b.wait(cfg.UserRate); w > 0 {
+					if soonest < 0 || w < soonest {
+						soonest = w
+					}
+					continue
+				}
+				b.tokens--
+			}
+			s.global.tokens--
+			s.queues[pri] = append(s.queues[pri][:i], s.queues[pri][i+1:]...)
+			return p, 0
+		}
+	}
+	return nil, soonest
+}
+
+// sendReady transmits every packet allowed to go now and returns how long
+// until the next one may go, or 0 when the queue is empty.
+func (s *Scheduler) sendReady() time.Duration {
+	for {
+		p, wait := s.take()
+		if p == nil {
+			return wait
+		}
+		err := s.send(*p)
+		s.mu.Lock()
+		if err != nil {
+			s.stats.Failed++
+			log.Printf("[SCHED] Send failed for %s: %v: %s", p.User, err, p.Line)
+		} else {
+			s.stats.Sent++
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Run transmits queued packets as the rate limits allow until stop is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for {
+		var timer <-chan time.Time
+		if wait := s.sendReady(); wait > 0 {
+			timer = s.clock.After(wait)
+		}
+		select {
+		case <-s.wake:
+		case <-timer:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Stats returns the queue depth and the scheduler's counters.
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.DropReasons = make(map[string]int, len(s.stats.DropReasons))
+	for k, v := range s.stats.DropReasons {
+		st.DropReasons[k] = v
+	}
+	st.QueueDepth = s.depthLocked()
+	st.QueuedAcks = len(s.queues[PriorityAck])
+	var oldest time.Time
+	for _, q := range s.queues {
+		if len(q) > 0 && (oldest.IsZero() || q[0].queued.Before(oldest)) {
+			oldest = q[0].queued
+		}
+	}
+	if !oldest.IsZero() {
+		st.OldestWait = s.clock.Now().Sub(oldest).Round(time.Second).String()
+	}
+	return st
+}
@@ -0,0 +1,140 @@
+package aprs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprstest"
+)
+
+func newTestScheduler() (*Scheduler, *aprstest.Clock, *[]string) {
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	var sent []string
+	s := NewScheduler(clock, func(p OutboundPacket) error {
+		sent = append(sent, p.Line)
+		return nil
+	})
+	return s, clock, &sent
+}
+
+func msgFrom(user string, n int) OutboundPacket {
+	return OutboundPacket{Line: fmt.Sprintf("%s>APRS::W1AW     :msg{%d", user, n), Kind: TransportInternet, User: user, Priority: PriorityMessage}
+}
+
+// TestSchedulerAcksFirst tests that queued acks go out ahead of queued messages
+func TestSchedulerAcksFirst(t *testing.T) {
+	s, _, sent := newTestScheduler()
+	s.Enqueue(msgFrom("N0AAA", 1))
+	s.Enqueue(msgFrom("N0BBB", 1))
+	s.Enqueue(OutboundPacket{Line: "N0CCC>APRS::W1AW     :ack5", Kind: TransportInternet, User: "N0CCC", Priority: PriorityAck})
+
+	if wait := s.sendReady(); wait != 0 {
+		t.Fatalf("Expected an empty queue, still waiting %s", wait)
+	}
+	if len(*sent) != 3 || (*sent)[0] != "N0CCC>APRS::W1AW     :ack5" {
+		t.Fatalf("Expected the ack first, got %q", *sent)
+	}
+}
+
+// TestSchedulerUserBucket tests that one user's burst waits without holding up others
+func TestSchedulerUserBucket(t *testing.T) {
+	s, clock, sent := newTestScheduler()
+	for i := 1; i <= 4; i++ {
+		s.Enqueue(msgFrom("N0AAA", i))
+	}
+	s.Enqueue(msgFrom("N0BBB", 1))
+
+	wait := s.sendReady()
+	if len(*sent) != 4 {
+		t.Fatalf("Expected the default user burst of 3 plus the other user's packet, got %q", *sent)
+	}
+	if (*sent)[3] != msgFrom("N0BBB", 1).Line {
+		t.Fatalf("Other user's packet should not wait, got %q", *sent)
+	}
+	if wait != 5*time.Second {
+		t.Fatalf("Expected to wait 5s for N0AAA's next token, got %s", wait)
+	}
+	if st := s.Stats(); st.QueueDepth != 1 {
+		t.Fatalf("Expected 1 queued, got %d", st.QueueDepth)
+	}
+
+	clock.Advance(5 * time.Second)
+	s.sendReady()
+	if len(*sent) != 5 || (*sent)[4] != msgFrom("N0AAA", 4).Line {
+		t.Fatalf("Expected N0AAA's 4th packet after the refill, got %q", *sent)
+	}
+}
+
+// TestSchedulerGlobalBucket tests the gateway-wide rate, which acks do not bypass
+func TestSchedulerGlobalBucket(t *testing.T) {
+	s, clock, sent := newTestScheduler()
+	for i := 0; i < 12; i++ {
+		s.Enqueue(OutboundPacket{Line: fmt.Sprintf("K8SDR-10>APRS::W1AW     :ack%d", i), Kind: TransportInternet, Priority: PriorityAck})
+	}
+	if wait := s.sendReady(); len(*sent) != 10 || wait != 500*time.Millisecond {
+		t.Fatalf("Expected a burst of 10 then a 500ms wait, got %d and %s", len(*sent), wait)
+	}
+	clock.Advance(time.Second)
+	s.sendReady()
+	if len(*sent) != 12 {
+		t.Fatalf("Expected the rest after 1s, got %d", len(*sent))
+	}
+}
+
+// TestSchedulerCoalesce tests that identical packets inside the window are sent once
+func TestSchedulerCoalesce(t *testing.T) {
+	s, clock, sent := newTestScheduler()
+	ack := OutboundPacket{Line: "N0AAA>APRS::W1AW     :ack1", Kind: TransportInternet, User: "N0AAA", Priority: PriorityAck}
+	s.Enqueue(ack)
+	s.Enqueue(ack)
+	s.sendReady()
+	s.Enqueue(ack)
+	s.sendReady()
+	if len(*sent) != 1 || s.Stats().Coalesced != 2 {
+		t.Fatalf("Expected one send and two coalesced, got %q and %d", *sent, s.Stats().Coalesced)
+	}
+
+	clock.Advance(11 * time.Second)
+	s.Enqueue(ack)
+	s.sendReady()
+	if len(*sent) != 2 {
+		t.Fatalf("Expected a resend after the window, got %q", *sent)
+	}
+}
+
+// TestSchedulerDrops tests the per-user and global queue limits and the drop counters
+func TestSchedulerDrops(t *testing.T) {
+	s, _, _ := newTestScheduler()
+	for i := 0; i < 20; i++ {
+		if err := s.Enqueue(msgFrom("N0AAA", i)); err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+	}
+	if err := s.Enqueue(msgFrom("N0AAA", 20)); err != ErrUserQueueFull {
+		t.Fatalf("Expected ErrUserQueueFull, got %v", err)
+	}
+	st := s.Stats()
+	if st.QueueDepth != 20 || st.Dropped != 1 || st.DropReasons["user_queue_full"] != 1 {
+		t.Fatalf("Unexpected stats %+v", st)
+	}
+}
+
+// TestSchedulerSendFailed tests that packets no transport took are counted, not dropped
+func TestSchedulerSendFailed(t *testing.T) {
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	s := NewScheduler(clock, func(p OutboundPacket) error {
+		if p.Kind == TransportRF {
+			return errConnectionInactive
+		}
+		return nil
+	})
+	s.Enqueue(OutboundPacket{Line: "K8SDR-10>APZAMG,WIDE1-1:}W1AW>APRS,TCPIP,K8SDR-10*::N0AAA    :hi", Kind: TransportRF, Gated: true})
+	s.Enqueue(msgFrom("N0AAA", 1))
+	s.sendReady()
+
+	st := s.Stats()
+	if st.Sent != 1 || st.Failed != 1 || st.Dropped != 0 {
+		t.Fatalf("Expected 1 sent and 1 failed, got %+v", st)
+	}
+}
@@ -0,0 +1,186 @@
+package aprs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/db"
+)
+
+// maxSegments bounds how many messages one long text is split into.
+const maxSegments = 9
+
+// partsWindow is how long we wait for the rest of a multipart message.
+const partsWindow = 10 * time.Minute
+
+// SplitMessage splits text into messages that fit the 67-character limit,
+// breaking at spaces and suffixing each with " (i/n)". Text that fits is
+// returned as-is. It returns ErrTooLong if more than maxSegments are needed.
+func SplitMessage(text string) ([]string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) <= maxMessageText {
+		return []string{text}, nil
+	}
+	budget := maxMessageText - len(fmt.Sprintf(" (%d/%d)", maxSegments, maxSegments))
+	parts := splitWords(text, budget)
+	if len(parts) > maxSegments {
+		return nil, &BuildError{Kind: ErrTooLong, Field: "payload", Value: text}
+	}
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%s (%d/%d)", parts[i], i+1, len(parts))
+	}
+	return parts, nil
+}
+
+// splitWords packs the words of text into lines of at most width bytes,
+// cutting words that are longer than a line.
+func splitWords(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len(word) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, word[:width])
+			word = word[width:]
+		}
+		switch {
+		case line == "":
+			line = word
+		case len(line)+1+len(word) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Multipart conventions: "text (1/3)", "text [1/3]", "(1/3) text", "1/3 text".
+var (
+	partSuffixRe = regexp.MustCompile(`^(.*?)\s*[(\[](\d{1,2})/(\d{1,2})[)\]]$`)
+	partPrefixRe = regexp.MustCompile(`^[(\[]?(\d{1,2})/(\d{1,2})[)\]]?[\s:]+(.*)$`)
+)
+
+// parsePart reports whether text is part n of a total-part message and
+// returns the text without the marker.
+func parsePart(text string) (body string, n, total int, ok bool) {
+	if m := partSuffixRe.FindStringSubmatch(text); m != nil {
+		body, n, total = m[1], atoi(m[2]), atoi(m[3])
+	} else if m := partPrefixRe.FindStringSubmatch(text); m != nil {
+		body, n, total = m[3], atoi(m[1]), atoi(m[2])
+	} else {
+		return "", 0, 0, false
+	}
+	return body, n, total, total >= 2 && total <= 20 && n >= 1 && n <= total
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// segmentText returns a sent segment's text without its message number and
+// (i/n) marker.
+func segmentText(body string) string {
+	if i := strings.LastIndex(body, "{"); i >= 0 && isMessageNumber(body[i+1:]) {
+		body = body[:i]
+	}
+	if text, _, _, ok := parsePart(body); ok {
+		return text
+	}
+	return body
+}
+
+// aggregateStatus sums up the statuses of a long message's segments, and
+// how many of them were acked.
+func aggregateStatus(segments []*db.Message) (string, int) {
+	counts := make(map[string]int)
+	for _, s := range segments {
+		counts[s.Status]++
+	}
+	switch {
+	case counts[db.StatusRejected] > 0:
+		return db.StatusRejected, counts[db.StatusAcked]
+	case counts[db.StatusExpired] > 0:
+		return db.StatusExpired, counts[db.StatusAcked]
+	case counts[db.StatusAcked] == len(segments):
+		return db.StatusAcked, counts[db.StatusAcked]
+	case counts[db.StatusQueued] == len(segments):
+		return db.StatusQueued, 0
+	case counts[db.StatusRetrying] > 0:
+		return db.StatusRetrying, counts[db.StatusAcked]
+	}
+	return db.StatusSent, counts[db.StatusAcked]
+}
+
+// partKey identifies one multipart message being reassembled.
+type partKey struct {
+	user, from string
+	total      int
+}
+
+type partial struct {
+	texts   map[int]string
+	ids     map[int]int64
+	started time.Time
+}
+
+// reassembler collects the parts of multipart messages from one sender.
+type reassembler struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	pending map[partKey]*partial
+}
+
+func newReassembler(now func() time.Time) *reassembler {
+	return &reassembler{now: now, pending: make(map[partKey]*partial)}
+}
+
+// add records a received message stored as id. Once every part of its
+// multipart message has arrived it returns the whole text and the IDs of
+// the stored parts, in order.
+func (r *reassembler) add(user, from, text string, id int64) (string, []int64, bool) {
+	body, n, total, ok := parsePart(text)
+	if !ok {
+		return "", nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for k, p := range r.pending {
+		if now.Sub(p.started) > partsWindow {
+			delete(r.pending, k)
+		}
+	}
+
+	key := partKey{user, from, total}
+	p := r.pending[key]
+	if p == nil || p.texts[n] != "" {
+		// A repeated part number starts a new message.
+		p = &partial{texts: make(map[int]string), ids: make(map[int]int64), started: now}
+		r.pending[key] = p
+	}
+	p.texts[n], p.ids[n] = strings.TrimSpace(body), id
+	if len(p.texts) < total {
+		return "", nil, false
+	}
+	delete(r.pending, key)
+
+	texts := make([]string, total)
+	ids := make([]int64, total)
+	for i := 1; i <= total; i++ {
+		texts[i-1], ids[i-1] = p.texts[i], p.ids[i]
+	}
+	return strings.Join(texts, " "), ids, true
+}
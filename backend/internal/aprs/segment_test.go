@@ -0,0 +1,118 @@
+package aprs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"aprsmessenger-gateway/internal/aprstest"
+	"aprsmessenger-gateway/internal/db"
+)
+
+// TestSplitMessage tests word-boundary segmentation with (i/n) suffixes
+func TestSplitMessage(t *testing.T) {
+	if parts, err := SplitMessage("Short enough"); err != nil || len(parts) != 1 || parts[0] != "Short enough" {
+		t.Fatalf("Expected a short message unchanged, got %q (%v)", parts, err)
+	}
+
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 4)
+	parts, err := SplitMessage(text)
+	if err != nil || len(parts) != 3 {
+		t.Fatalf("Expected 3 segments, got %q (%v)", parts, err)
+	}
+	var words []string
+	for i, p := range parts {
+		if len(p) > maxMessageText {
+			t.Fatalf("Segment %d is %d characters: '%s'", i+1, len(p), p)
+		}
+		body, n, total, ok := parsePart(p)
+		if !ok || n != i+1 || total != 3 {
+			t.Fatalf("Segment %d has a bad marker: '%s'", i+1, p)
+		}
+		words = append(words, strings.Fields(body)...)
+	}
+	if strings.Join(words, " ") != strings.TrimSpace(text) {
+		t.Fatalf("Segments lost text: %q", parts)
+	}
+
+	if parts, _ := SplitMessage(strings.Repeat("x", 100)); len(parts) != 2 || !strings.HasPrefix(parts[1], "xxx") {
+		t.Fatalf("Expected a long word cut in two, got %q", parts)
+	}
+	if _, err := SplitMessage(strings.Repeat("word ", 200)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Expected ErrTooLong, got %v", err)
+	}
+}
+
+// TestParsePart tests the multipart conventions we recognise
+func TestParsePart(t *testing.T) {
+	cases := []struct {
+		text, body string
+		n, total   int
+		ok         bool
+	}{
+		{"Meet at the hamfest (1/2)", "Meet at the hamfest", 1, 2, true},
+		{"at noon [2/2]", "at noon", 2, 2, true},
+		{"(2/3) second part", "second part", 2, 3, true},
+		{"1/2 first part", "first part", 1, 2, true},
+		{"Ratio is 3/4", "", 0, 0, false},
+		{"Bad (3/2)", "", 3, 2, false},
+		{"Solo (1/1)", "", 1, 1, false},
+	}
+	for _, c := range cases {
+		body, n, total, ok := parsePart(c.text)
+		if ok != c.ok || (ok && (body != c.body || n != c.n || total != c.total)) {
+			t.Fatalf("parsePart('%s'): got '%s' %d/%d %v", c.text, body, n, total, ok)
+		}
+	}
+}
+
+// TestReassembler tests reassembly out of order and the waiting window
+func TestReassembler(t *testing.T) {
+	clock := aprstest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	r := newReassembler(clock.Now)
+	if _, _, ok := r.add("AD8NT", "W1AW", "at noon (2/2)", 2); ok {
+		t.Fatal("Completed with one part")
+	}
+	if _, _, ok := r.add("AD8NT", "N0CALL", "Other sender (1/2)", 3); ok {
+		t.Fatal("Mixed parts from different senders")
+	}
+	text, ids, ok := r.add("AD8NT", "W1AW", "Meet at the hamfest (1/2)", 1)
+	if !ok || text != "Meet at the hamfest at noon" || len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("Unexpected reassembly '%s' %v %v", text, ids, ok)
+	}
+
+	r.add("AD8NT", "W1AW", "Late (1/2)", 4)
+	clock.Advance(partsWindow + time.Second)
+	if _, _, ok := r.add("AD8NT", "W1AW", "arrival (2/2)", 5); ok {
+		t.Fatal("Reassembled parts further apart than the window")
+	}
+}
+
+// TestAggregateStatus tests the status shown for a long message's segments
+func TestAggregateStatus(t *testing.T) {
+	seg := func(statuses ...string) []*db.Message {
+		var out []*db.Message
+		for _, s := range statuses {
+			out = append(out, &db.Message{Status: s})
+		}
+		return out
+	}
+	cases := []struct {
+		segments []*db.Message
+		status   string
+		acked    int
+	}{
+		{seg(db.StatusQueued, db.StatusQueued), db.StatusQueued, 0},
+		{seg(db.StatusAcked, db.StatusSent), db.StatusSent, 1},
+		{seg(db.StatusAcked, db.StatusRetrying), db.StatusRetrying, 1},
+		{seg(db.StatusAcked, db.StatusAcked), db.StatusAcked, 2},
+		{seg(db.StatusAcked, db.StatusRejected), db.StatusRejected, 1},
+		{seg(db.StatusExpired, db.StatusAcked), db.StatusExpired, 1},
+	}
+	for _, c := range cases {
+		if status, acked := aggregateStatus(c.segments); status != c.status || acked != c.acked {
+			t.Fatalf("Expected '%s' with %d acked, got '%s' with %d", c.status, c.acked, status, acked)
+		}
+	}
+}
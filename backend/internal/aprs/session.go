@@ -15,13 +15,34 @@ import (
 )
 
 // RouteHop represents a single hop in a message's path for JSON marshalling.
-// We are only sending the callsign for now. Lat/Lon are placeholders for future use.
+// Lat/Lon are the station's last known position, when we have one.
 type RouteHop struct {
 	Callsign string  `json:"callsign"`
+	Role     HopRole `json:"role,omitempty"` // Empty for the sender and the recipient
 	Lat      float64 `json:"lat,omitempty"`
 	Lon      float64 `json:"lon,omitempty"`
 }
 
+// BuildRoute builds the visual route [from, ...hops, to], keeping the first
+// appearance of each callsign.
+func BuildRoute(from, to string, hops []PathHop) []RouteHop {
+	route := []RouteHop{{Callsign: from}}
+	for _, h := range hops {
+		route = append(route, RouteHop{Callsign: h.Call, Role: h.Role})
+	}
+	route = append(route, RouteHop{Callsign: to})
+
+	seen := make(map[string]bool)
+	unique := route[:0]
+	for _, hop := range route {
+		if !seen[hop.Callsign] {
+			seen[hop.Callsign] = true
+			unique = append(unique, hop)
+		}
+	}
+	return unique
+}
+
 // Session represents an in-memory structure for a user's websocket and message delivery
 type Session struct {
 	Callsign string
@@ -50,7 +71,7 @@ func (s *Session) AttachWebSocket(ws *websocket.Conn) {
 				log.Printf("[APRS] Failed to store message for %s: %v", to, err)
 			}
 			// Broadcast incoming messages to all clients, with no exclusions.
-			s.BroadcastMessage(from, to, msg, path, nil)
+			s.BroadcastMessage(from, to, msg, ParsePath(path).Travelled(), nil)
 		})
 	}
 	s.wsClients[ws] = struct{}{}
@@ -80,6 +101,13 @@ func (s *Session) DetachWebSocket(ws *websocket.Conn) {
 	}
 }
 
+// Attached reports whether any websocket client is attached.
+func (s *Session) Attached() bool {
+	s.wsMu.Lock()
+	defer s.wsMu.Unlock()
+	return len(s.wsClients) > 0
+}
+
 // keepAliveWS sends pings and removes the websocket client on disconnect.
 func (s *Session) keepAliveWS(ws *websocket.Conn) {
 	defer s.DetachWebSocket(ws)
@@ -93,7 +121,7 @@ func (s *Session) keepAliveWS(ws *websocket.Conn) {
 }
 
 // BroadcastMessage sends a message to all attached websockets, optionally excluding one.
-func (s *Session) BroadcastMessage(from, to, msg string, path []string, exclude *websocket.Conn) {
+func (s *Session) BroadcastMessage(from, to, msg string, hops []PathHop, exclude *websocket.Conn) {
 	s.wsMu.Lock()
 	defer s.wsMu.Unlock()
 
@@ -101,29 +129,7 @@ func (s *Session) BroadcastMessage(from, to, msg string, path []string, exclude
 		return
 	}
 
-	var routeHops []RouteHop
-	// Build the full visual route: [from, ...path, to]
-	fullRoute := []string{from}
-	if path != nil {
-		fullRoute = append(fullRoute, path...)
-	}
-	fullRoute = append(fullRoute, to)
-
-	// Remove duplicates and clean up path markers (e.g., WIDE2-2*)
-	seen := make(map[string]bool)
-	uniqueRoute := []string{}
-	for _, hop := range fullRoute {
-		cleanHop := strings.TrimRight(hop, "*")
-		if !seen[cleanHop] {
-			seen[cleanHop] = true
-			uniqueRoute = append(uniqueRoute, cleanHop)
-		}
-	}
-
-	for _, hopCallsign := range uniqueRoute {
-		// In the future, you could look up coordinates for each hopCallsign here.
-		routeHops = append(routeHops, RouteHop{Callsign: hopCallsign})
-	}
+	routeHops := GetAPRSManager().LocateRoute(BuildRoute(from, to, hops))
 
 	resp := map[string]interface{}{
 		"aprs_msg":   true,
@@ -164,6 +170,14 @@ func (s *Session) deliverHistory(ws *websocket.Conn) {
 	}
 
 	log.Printf("[APRS] Delivering %d history messages to %s", len(messages), s.Callsign)
+	// Segments of one long message are shown as one entry.
+	groups := make(map[int64][]*db.Message)
+	for _, m := range messages {
+		if m.GroupID != 0 {
+			groups[m.GroupID] = append(groups[m.GroupID], m)
+		}
+	}
+
 	var undeliveredIDs []int
 	for _, m := range messages {
 		resp := map[string]interface{}{
@@ -174,6 +188,27 @@ func (s *Session) deliverHistory(ws *websocket.Conn) {
 			"history":    true, // Mark as history so client can suppress notifications
 			"created_at": m.CreatedAt.Format(time.RFC3339),
 		}
+		if m.Copies > 1 {
+			resp["copies"] = m.Copies
+		}
+		if m.Status != "" {
+			resp["messageId"] = m.MsgNo
+			resp["status"] = m.Status
+		}
+		if segments := groups[m.GroupID]; m.GroupID != 0 {
+			if int64(m.ID) != m.GroupID {
+				continue
+			}
+			texts := make([]string, len(segments))
+			for i, seg := range segments {
+				texts[i] = segmentText(seg.Message)
+			}
+			status, acked := aggregateStatus(segments)
+			resp["message"] = strings.Join(texts, " ")
+			resp["status"] = status
+			resp["segments"] = len(segments)
+			resp["segments_acked"] = acked
+		}
 		if err := ws.WriteJSON(resp); err != nil {
 			log.Printf("Error sending history to %s: %v", s.Callsign, err)
 			return // Stop trying if connection is bad
@@ -0,0 +1,215 @@
+package aprs
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+	"aprsmessenger-gateway/internal/db"
+)
+
+// stationPruneInterval is how often stations past the retention are deleted.
+const stationPruneInterval = time.Hour
+
+// stationLog collects sightings of the stations heard on the feed and writes
+// them to the stations table in batches, as the feed is too busy for a write
+// per packet.
+type stationLog struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	pending   map[string]*db.Station // Sightings not yet written, by callsign
+	full      chan struct{}
+	lastPrune time.Time
+}
+
+func newStationLog(now func() time.Time) *stationLog {
+	return &stationLog{now: now, pending: make(map[string]*db.Station), full: make(chan struct{}, 1)}
+}
+
+// sighting reads what a packet tells us about the station that sent it: the
+// inner station of a third-party packet. gateway is our own callsign, the
+// IGate for frames heard on our TNCs.
+func sighting(f Frame, gateway string) *db.Station {
+	line := f.Line
+	if strings.HasPrefix(line, "#") {
+		return nil
+	}
+	igate := ""
+	if f.Kind == TransportRF {
+		igate = gateway
+	}
+	for depth := 0; ; depth++ {
+		src, dst, path, info, ok := splitTNC2(line)
+		if !ok || src == "" {
+			return nil
+		}
+		if igate == "" {
+			igate = ParsePath(append([]string{dst}, path...)).IGate
+		}
+		if strings.HasPrefix(info, "}") && depth < maxThirdPartyDepth {
+			line = info[1:]
+			continue
+		}
+
+		s := &db.Station{
+			Callsign:  strings.ToUpper(src),
+			LastHeard: f.Heard,
+			Path:      strings.Join(append([]string{dst}, path...), ","),
+			IGate:     igate,
+			Packets:   1,
+		}
+		if info == "" {
+			return s
+		}
+		switch info[0] {
+		case '>':
+			s.Status = statusText(info[1:])
+		case '<':
+			s.Capabilities = strings.TrimSpace(info[1:])
+		default:
+			if p, err := decodePosition(dst, info, f.Heard); err == nil {
+				s.HasPosition = true
+				s.Lat, s.Lon, s.Symbol, s.PositionAt = p.Lat, p.Lon, p.Symbol, f.Heard
+			}
+		}
+		return s
+	}
+}
+
+// statusText drops the optional DHM zulu timestamp from a status report.
+func statusText(s string) string {
+	if len(s) >= 7 && s[6] == 'z' && strings.Trim(s[:6], "0123456789") == "" {
+		s = s[7:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// mergeSighting applies a later sighting s to what is known in st. Like
+// db.SaveStations, it keeps the position, status and capabilities that s
+// does not carry.
+func mergeSighting(st, s *db.Station) {
+	st.LastHeard, st.Path, st.IGate = s.LastHeard, s.Path, s.IGate
+	st.Packets += s.Packets
+	if s.HasPosition {
+		st.HasPosition = true
+		st.Lat, st.Lon, st.Symbol, st.PositionAt = s.Lat, s.Lon, s.Symbol, s.PositionAt
+	}
+	if s.Status != "" {
+		st.Status = s.Status
+	}
+	if s.Capabilities != "" {
+		st.Capabilities = s.Capabilities
+	}
+}
+
+// heard records the sender of a frame.
+func (l *stationLog) heard(f Frame) {
+	s := sighting(f, config.Get().Gateway.Callsign)
+	if s == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if st := l.pending[s.Callsign]; st != nil {
+		mergeSighting(st, s)
+		return
+	}
+	l.pending[s.Callsign] = s
+	if len(l.pending) >= config.Get().Stations.BatchSize {
+		select {
+		case l.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// get returns what we know about a station, including sightings not yet
+// written, or nil if it has not been heard.
+func (l *stationLog) get(callsign string) (*db.Station, error) {
+	callsign = toUpperNoSpace(callsign)
+	st, err := db.GetStation(callsign)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.pending[callsign]
+	switch {
+	case s == nil:
+		return st, nil
+	case st == nil:
+		c := *s
+		return &c, nil
+	}
+	mergeSighting(st, s)
+	return st, nil
+}
+
+// flush writes the waiting sightings and, once an hour, deletes stations not
+// heard within the retention.
+func (l *stationLog) flush() {
+	l.mu.Lock()
+	batch := make([]*db.Station, 0, len(l.pending))
+	for _, s := range l.pending {
+		batch = append(batch, s)
+	}
+	l.pending = make(map[string]*db.Station)
+	now := l.now()
+	prune := now.Sub(l.lastPrune) >= stationPruneInterval
+	if prune {
+		l.lastPrune = now
+	}
+	l.mu.Unlock()
+
+	if len(batch) > 0 {
+		if err := db.SaveStations(batch); err != nil {
+			log.Printf("[DB] Failed to save %d station(s): %v", len(batch), err)
+		}
+	}
+	if prune {
+		n, err := db.PruneStations(now.Add(-config.Get().Stations.Retain.D()))
+		if err != nil {
+			log.Printf("[DB] Failed to prune stations: %v", err)
+		} else if n > 0 {
+			log.Printf("[APRS] Pruned %d station(s) not heard for %v", n, config.Get().Stations.Retain.D())
+		}
+	}
+}
+
+// Run writes sightings every flush interval, or sooner when a batch fills,
+// until stop is closed; then it writes what is left.
+func (l *stationLog) Run(clock Clock, stop <-chan struct{}) {
+	for {
+		select {
+		case <-clock.After(config.Get().Stations.FlushInterval.D()):
+		case <-l.full:
+		case <-stop:
+			l.flush()
+			return
+		}
+		l.flush()
+	}
+}
+
+// Station returns what we know about a station heard on the feed, or nil if
+// it has not been heard.
+func (am *APRSManager) Station(callsign string) (*db.Station, error) {
+	return am.stations.get(callsign)
+}
+
+// LocateRoute fills in the coordinates of the hops whose last position we know.
+func (am *APRSManager) LocateRoute(route []RouteHop) []RouteHop {
+	for i := range route {
+		st, err := am.stations.get(route[i].Callsign)
+		if err != nil {
+			log.Printf("[DB] Failed to look up station %s: %v", route[i].Callsign, err)
+			continue
+		}
+		if st != nil && st.HasPosition {
+			route[i].Lat, route[i].Lon = st.Lat, st.Lon
+		}
+	}
+	return route
+}
@@ -0,0 +1,84 @@
+package aprs
+
+import (
+	"log"
+	"time"
+
+	"aprsmessenger-gateway/internal/db"
+)
+
+// handleResponse applies an inbound ack or rej to the message it answers.
+// A REPLY-ACK ack (ackMM}AA) also acks our message AA.
+func (am *APRSManager) handleResponse(msg *MessagePacket) {
+	status := db.StatusAcked
+	if msg.Response == "rej" {
+		status = db.StatusRejected
+	}
+	am.setDeliveryStatus(msg.Addressee, msg.Source, msg.MsgNo, status)
+	if msg.AckMsgNo != "" {
+		am.setDeliveryStatus(msg.Addressee, msg.Source, msg.AckMsgNo, db.StatusAcked)
+	}
+}
+
+// setDeliveryStatus records the status of the message user sent to contact
+// with msgNo and tells the user's clients. Responses that match nothing
+// outstanding (repeated acks, acks for another app's messages) are ignored.
+func (am *APRSManager) setDeliveryStatus(user, contact, msgNo, status string) {
+	user, contact = toUpperNoSpace(user), toUpperNoSpace(contact)
+	id, err := db.SetSentMessageStatus(user, contact, msgNo, status)
+	if err != nil {
+		log.Printf("[DB] Failed to set status of message %s from %s to %s: %v", msgNo, user, contact, err)
+		return
+	}
+	if id == 0 {
+		return
+	}
+	log.Printf("[APRS] Message %s from %s to %s %s", msgNo, user, contact, status)
+	am.notifyMessageStatus(id, 0)
+}
+
+// notifyMessageStatus tells the sender's clients the status of a stored
+// message. For a segment of a long message they get the aggregate status
+// of all its segments, under the first segment's number.
+func (am *APRSManager) notifyMessageStatus(id int64, retryCount int) {
+	m, err := db.GetMessage(id)
+	if err != nil || m == nil {
+		log.Printf("[DB] Failed to load message %d: %v", id, err)
+		return
+	}
+	if m.GroupID == 0 {
+		am.pushStatus(m.FromCallsign, m.ToCallsign, m.MsgNo, m.Status, retryCount, nil)
+		return
+	}
+	segments, err := db.ListMessageGroup(m.GroupID)
+	if err != nil || len(segments) == 0 {
+		log.Printf("[DB] Failed to load segments of message %d: %v", m.GroupID, err)
+		return
+	}
+	status, acked := aggregateStatus(segments)
+	am.pushStatus(m.FromCallsign, m.ToCallsign, segments[0].MsgNo, status, retryCount, map[string]interface{}{
+		"segments":       len(segments),
+		"segments_acked": acked,
+	})
+}
+
+// pushStatus sends a message_status_update for the message user sent to
+// contact to every client the user has attached, with any extra fields.
+func (am *APRSManager) pushStatus(user, contact, msgNo, status string, retryCount int, extra map[string]interface{}) {
+	session := GetSessionsManager().GetSession(baseCallsign(toUpperNoSpace(user)))
+	if session == nil {
+		return
+	}
+	update := map[string]interface{}{
+		"type":               "message_status_update",
+		"contact_groupingId": contact,
+		"messageId":          msgNo,
+		"status":             status,
+		"retryCount":         retryCount,
+		"time":               am.clock.Now().Format(time.RFC3339),
+	}
+	for k, v := range extra {
+		update[k] = v
+	}
+	session.SendAll(update)
+}
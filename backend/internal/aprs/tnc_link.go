@@ -0,0 +1,124 @@
+package aprs
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+)
+
+// tncLink is the TCP connection handling shared by the TNC transports:
+// dialing with backoff, state reporting and serialised writes.
+type tncLink struct {
+	name string
+	addr string
+	kind string // Protocol name used in log lines, e.g. "KISS"
+
+	mu    sync.Mutex
+	conn  net.Conn
+	state TransportState
+	host  TransportHost
+	self  PacketTransport
+}
+
+func newTNCLink(name, addr, kind string) *tncLink {
+	return &tncLink{
+		name:  name,
+		addr:  addr,
+		kind:  kind,
+		state: TransportState{Name: name, Kind: TransportRF, State: StateConnecting, Since: time.Now()},
+	}
+}
+
+// setState records a state transition and notifies the host.
+func (l *tncLink) setState(state, reason string) {
+	l.mu.Lock()
+	l.state.State = state
+	l.state.Reason = reason
+	l.state.Since = time.Now()
+	host, self := l.host, l.self
+	l.mu.Unlock()
+	if host != nil {
+		host.StateChanged(self)
+	}
+}
+
+func (l *tncLink) snapshot() TransportState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// write sends raw bytes on the current connection.
+func (l *tncLink) write(b []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return errConnectionInactive
+	}
+	_ = l.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := l.conn.Write(b)
+	return err
+}
+
+// run dials the TNC, calls session with each new connection until it returns,
+// and reconnects with backoff until stop is closed. session should read until
+// the connection fails; its error is reported as the disconnect reason.
+func (l *tncLink) run(stop <-chan struct{}, host TransportHost, self PacketTransport, session func(conn net.Conn) error) {
+	l.mu.Lock()
+	l.host, l.self = host, self
+	l.mu.Unlock()
+
+	cfg := config.Get()
+	bo := &backoff{min: cfg.APRSIS.BackoffMin.D(), max: cfg.APRSIS.BackoffMax.D()}
+	go func() {
+		<-stop
+		l.mu.Lock()
+		if l.conn != nil {
+			l.conn.Close()
+		}
+		l.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stop:
+			l.setState(StateStopped, "")
+			return
+		default:
+		}
+
+		l.setState(StateConnecting, "")
+		conn, err := net.DialTimeout("tcp", l.addr, 10*time.Second)
+		if err == nil {
+			l.mu.Lock()
+			l.conn = conn
+			l.mu.Unlock()
+			connectedAt := time.Now()
+			log.Printf("[%s] %s: connected to %s", l.kind, l.name, l.addr)
+			l.setState(StateConnected, "")
+
+			err = session(conn)
+
+			l.mu.Lock()
+			l.conn.Close()
+			l.conn = nil
+			l.mu.Unlock()
+			if time.Since(connectedAt) >= stableConnection {
+				bo.reset()
+			}
+		}
+
+		d := bo.next()
+		reason := fmt.Sprintf("%s: %v", l.addr, err)
+		log.Printf("[%s] %s: %s. Retrying in %s.", l.kind, l.name, reason, d.Round(time.Second))
+		l.setState(StateBackoff, reason)
+		select {
+		case <-time.After(d):
+		case <-stop:
+		}
+	}
+}
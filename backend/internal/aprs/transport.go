@@ -0,0 +1,82 @@
+package aprs
+
+import (
+	"fmt"
+	"time"
+
+	"aprsmessenger-gateway/internal/config"
+)
+
+// TransportKind says which network a transport reaches.
+type TransportKind string
+
+const (
+	TransportInternet TransportKind = "internet" // APRS-IS
+	TransportRF       TransportKind = "rf"       // A local radio via a TNC
+	TransportLocal    TransportKind = "local"    // Between members, without leaving the gateway
+)
+
+// Transport connection states reported in TransportState.
+const (
+	StateConnecting = "connecting"
+	StateConnected  = "connected"
+	StateBackoff    = "backoff"
+	StateStopped    = "stopped"
+)
+
+// Frame is one packet received on a transport, in TNC2 text form
+// (SRC>DST,PATH:info), the same form ParseMessagePacket consumes.
+type Frame struct {
+	Line      string
+	Transport string // Name of the transport that heard it
+	Kind      TransportKind
+	Heard     time.Time
+}
+
+// TransportState is a snapshot of a transport for clients and admins.
+type TransportState struct {
+	Name   string        `json:"name"`
+	Kind   TransportKind `json:"kind"`
+	State  string        `json:"state"`
+	Reason string        `json:"reason,omitempty"` // Why we are in this state (e.g. the last failure)
+	Since  time.Time     `json:"since"`
+	Detail interface{}   `json:"detail,omitempty"` // Transport-specific extras
+}
+
+// TransportHost receives what a running transport hears and reports.
+// APRSManager is the host for all of its transports.
+type TransportHost interface {
+	// Receive is called for every frame the transport hears.
+	Receive(f Frame)
+	// StateChanged is called whenever the transport's State() changes.
+	StateChanged(t PacketTransport)
+}
+
+// PacketTransport carries TNC2 frames to and from an APRS network.
+type PacketTransport interface {
+	Name() string
+	Kind() TransportKind
+	// Run connects and delivers frames to host until stop is closed,
+	// reconnecting on its own whenever the link drops.
+	Run(stop <-chan struct{}, host TransportHost)
+	// Send transmits one TNC2 frame.
+	Send(tnc2 string) error
+	State() TransportState
+}
+
+// filterableTransport is implemented by transports that support server-side filters.
+type filterableTransport interface {
+	SetFilters(filters []string)
+}
+
+// NewTNCTransport builds the transport for one configured TNC.
+func NewTNCTransport(tc config.TNCConfig) (PacketTransport, error) {
+	switch tc.Type {
+	case "kiss":
+		return NewKISSTransport(tc.Name, tc.Addr, tc.Port), nil
+	case "agwpe":
+		return NewAGWPETransport(tc.Name, tc.Addr, tc.Port, tc.Monitor), nil
+	default:
+		return nil, fmt.Errorf("unknown TNC type %q", tc.Type)
+	}
+}
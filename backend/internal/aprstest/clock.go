@@ -0,0 +1,87 @@
+package aprstest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock. Time only moves when the test calls Advance, which
+// fires every timer that has come due.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []clockTimer
+	added  chan struct{}
+}
+
+type clockTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewClock returns a fake clock set to start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start, added: make(chan struct{}, 64)}
+}
+
+// Now returns the fake current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives once the clock is advanced past d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, clockTimer{at: c.now.Add(d), ch: ch})
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+// Advance moves the clock forward by d and fires due timers.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.at.After(c.now) {
+			t.ch <- c.now
+			continue
+		}
+		kept = append(kept, t)
+	}
+	c.timers = kept
+}
+
+// Waiters returns the number of pending timers.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil waits until at least n timers are pending, or timeout passes.
+// It reports whether the timers appeared.
+func (c *Clock) BlockUntil(n int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for c.Waiters() < n {
+		select {
+		case <-c.added:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			return false
+		}
+	}
+	return true
+}
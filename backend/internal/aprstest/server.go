@@ -0,0 +1,246 @@
+// Package aprstest provides a scriptable in-process APRS-IS server and a fake
+// clock for deterministic gateway tests.
+package aprstest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Login is one "user ... pass ... filter ..." line received by the server.
+type Login struct {
+	Callsign string
+	Passcode string
+	Filter   string
+	Raw      string
+}
+
+// Server is a fake APRS-IS server. It answers logins with # logresp, records
+// every packet clients send, and lets the test inject frames and drop clients.
+type Server struct {
+	Name string // Server name sent in # logresp
+
+	ln      net.Listener
+	mu      sync.Mutex
+	conns   map[net.Conn]*bufio.Writer
+	verify  func(Login) bool
+	logins  chan Login
+	sent    chan string
+	filters chan string
+	closed  bool
+}
+
+// NewServer starts a fake server on a loopback port. It verifies every login
+// until SetVerify says otherwise, and shuts down when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("aprstest: listen: %v", err)
+	}
+	s := &Server{
+		Name:    "T2TEST",
+		ln:      ln,
+		conns:   make(map[net.Conn]*bufio.Writer),
+		verify:  func(Login) bool { return true },
+		logins:  make(chan Login, 16),
+		sent:    make(chan string, 256),
+		filters: make(chan string, 16),
+	}
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the host:port clients should connect to.
+func (s *Server) Addr() string { return s.ln.Addr().String() }
+
+// SetVerify replaces the passcode check used for logresp.
+func (s *Server) SetVerify(fn func(Login) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.verify = fn
+}
+
+// Close disconnects every client and stops listening.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.ln.Close()
+	s.Disconnect()
+}
+
+// Disconnect drops every connected client, as a server restart would.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+		delete(s.conns, c)
+	}
+}
+
+// Clients returns the number of logged-in clients.
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Inject sends a line to every logged-in client, as if it arrived from the network.
+func (s *Server) Inject(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c, w := range s.conns {
+		_ = c.SetWriteDeadline(time.Now().Add(2 * time.Second))
+		w.WriteString(line + "\r\n")
+		w.Flush()
+	}
+}
+
+// WaitLogin returns the next login, failing the test after timeout.
+func (s *Server) WaitLogin(t testing.TB, timeout time.Duration) Login {
+	t.Helper()
+	select {
+	case l := <-s.logins:
+		return l
+	case <-time.After(timeout):
+		t.Fatalf("aprstest: no login within %s", timeout)
+	}
+	return Login{}
+}
+
+// ExpectNoLogin fails the test if a client logs in within d.
+func (s *Server) ExpectNoLogin(t testing.TB, d time.Duration) {
+	t.Helper()
+	select {
+	case l := <-s.logins:
+		t.Fatalf("aprstest: unexpected login: %s", l.Raw)
+	case <-time.After(d):
+	}
+}
+
+// WaitSent returns the next packet a client sent that satisfies match (nil
+// matches anything), skipping others. It fails the test after timeout.
+func (s *Server) WaitSent(t testing.TB, timeout time.Duration, match func(string) bool) string {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case line := <-s.sent:
+			if match == nil || match(line) {
+				return line
+			}
+		case <-deadline:
+			t.Fatalf("aprstest: expected packet not sent within %s", timeout)
+			return ""
+		}
+	}
+}
+
+// ExpectNoSent fails the test if a client sends a packet satisfying match within d.
+func (s *Server) ExpectNoSent(t testing.TB, d time.Duration, match func(string) bool) {
+	t.Helper()
+	deadline := time.After(d)
+	for {
+		select {
+		case line := <-s.sent:
+			if match == nil || match(line) {
+				t.Fatalf("aprstest: unexpected packet sent: %s", line)
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// Filters returns the #filter commands clients send after login.
+func (s *Server) Filters() <-chan string { return s.filters }
+
+func (s *Server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	fmt.Fprintf(w, "# aprstest 1.0\r\n")
+	w.Flush()
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	login := parseLogin(strings.TrimRight(line, "\r\n"))
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	status := "unverified"
+	if s.verify(login) {
+		status = "verified"
+	}
+	fmt.Fprintf(w, "# logresp %s %s, server %s\r\n", login.Callsign, status, s.Name)
+	w.Flush()
+	s.conns[c] = w
+	s.mu.Unlock()
+	s.logins <- login
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "#filter"):
+			s.filters <- strings.TrimSpace(strings.TrimPrefix(line, "#filter"))
+		case strings.HasPrefix(line, "#"), line == "":
+		default:
+			s.sent <- line
+		}
+	}
+}
+
+// parseLogin splits "user CALL pass N vers NAME VER filter ...".
+func parseLogin(line string) Login {
+	l := Login{Raw: line}
+	fields := strings.Fields(line)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "user":
+			if i+1 < len(fields) {
+				l.Callsign = fields[i+1]
+				i++
+			}
+		case "pass":
+			if i+1 < len(fields) {
+				l.Passcode = fields[i+1]
+				i++
+			}
+		case "filter":
+			l.Filter = strings.Join(fields[i+1:], " ")
+			i = len(fields)
+		}
+	}
+	return l
+}
@@ -0,0 +1,470 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds all runtime settings for the gateway.
+// Values are resolved in order: defaults, config file, environment, command-line flags.
+type Config struct {
+	ListenAddr string         `json:"listen_addr"`
+	DBPath     string         `json:"db_path"`
+	APRSIS     APRSISConfig   `json:"aprsis"`
+	Gateway    GatewayConfig  `json:"gateway"`
+	TNCs       []TNCConfig    `json:"tncs"` // Local radio transports, in addition to APRS-IS
+	IGate      IGateConfig    `json:"igate"`
+	Server     ServerConfig   `json:"server"`     // APRS-IS-compatible port for members' own APRS apps
+	Outbound   OutboundConfig `json:"outbound"`   // Pacing of everything sent under the gateway login
+	Inbound    InboundConfig  `json:"inbound"`    // Handling of messages received for members
+	Policy     PolicyConfig   `json:"policy"`     // Gateway-wide answers to messages the gateway refuses
+	Stations   StationsConfig `json:"stations"`   // The table of stations heard on the feed
+	Objects    ObjectsConfig  `json:"objects"`    // APRS objects and items heard on the feed
+	Admins     []string       `json:"admins"`     // Base callsigns allowed to use admin actions
+	EchoRoute  []string       `json:"echo_route"` // Path, destination first, shown to a user's other clients for messages they sent; empty derives it from the gateway
+}
+
+// APRSISConfig holds the APRS-IS connection settings.
+type APRSISConfig struct {
+	Servers      []string `json:"servers"`       // host:port, in order of preference
+	BackoffMin   Duration `json:"backoff_min"`   // First reconnect delay
+	BackoffMax   Duration `json:"backoff_max"`   // Reconnect delay cap
+	StallTimeout Duration `json:"stall_timeout"` // Fail over when nothing (not even a # keepalive) arrives for this long
+	LoginTimeout Duration `json:"login_timeout"` // Fail over when no # logresp arrives for this long
+}
+
+// TNCConfig describes one local TNC the gateway sends and receives through.
+type TNCConfig struct {
+	Name    string `json:"name"`    // Shown in status; defaults to the type and address
+	Type    string `json:"type"`    // "kiss" (KISS over TCP) or "agwpe"
+	Addr    string `json:"addr"`    // host:port of the TNC, e.g. Direwolf's 127.0.0.1:8001
+	Port    int    `json:"port"`    // TNC radio port (KISS port number, or 0-based AGWPE port)
+	Monitor string `json:"monitor"` // AGWPE only: "raw" ('K' frames, default) or "text" ('U' frames)
+}
+
+// IGateConfig controls gating between the TNCs and APRS-IS.
+type IGateConfig struct {
+	Enabled     bool     `json:"enabled"`
+	RFPath      string   `json:"rf_path"`      // Path for packets gated to RF, e.g. "WIDE1-1"
+	HeardWindow Duration `json:"heard_window"` // How recently a station must be heard on RF to gate messages to it
+	DedupWindow Duration `json:"dedup_window"` // Identical packets inside this window are gated once
+	TxBudget    int      `json:"tx_budget"`    // Maximum packets gated to RF per TxWindow
+	TxWindow    Duration `json:"tx_window"`
+}
+
+// ServerConfig controls the APRS-IS-compatible port that APRSdroid, Xastir,
+// YAAC and similar apps can log in to with a member's callsign and passcode.
+type ServerConfig struct {
+	Listen       string   `json:"listen"`        // e.g. ":14580"; empty disables the port
+	Keepalive    Duration `json:"keepalive"`     // Interval between "# ..." keepalive lines
+	LoginTimeout Duration `json:"login_timeout"` // Drop clients that do not log in within this long
+	MaxClients   int      `json:"max_clients"`
+}
+
+// OutboundConfig paces what the gateway transmits under its login.
+// Rates are packets per second; bursts are bucket sizes.
+type OutboundConfig struct {
+	GlobalRate     float64  `json:"global_rate"`
+	GlobalBurst    int      `json:"global_burst"`
+	UserRate       float64  `json:"user_rate"` // Per member; acks are exempt
+	UserBurst      int      `json:"user_burst"`
+	CoalesceWindow Duration `json:"coalesce_window"` // Identical packets inside this window are sent once
+	MaxQueue       int      `json:"max_queue"`
+	MaxPerUser     int      `json:"max_per_user"`   // Queued packets one member may have waiting
+	RetryFirst     Duration `json:"retry_first"`    // Wait before the first retransmission of an unacked message
+	RetryMax       Duration `json:"retry_max"`      // Cap on the doubling wait between retransmissions
+	ExpireAfter    Duration `json:"expire_after"`   // Give up on a message not acked within this long
+	TransmitLocal  bool     `json:"transmit_local"` // Also transmit messages between members, which are delivered locally
+}
+
+// InboundConfig controls duplicate suppression and acking for messages received for members.
+// A copy heard again within the window of the last copy counts as the same message.
+type InboundConfig struct {
+	DedupWindow Duration `json:"dedup_window"` // Unnumbered messages; APRS-IS drops duplicates within 30s
+	RetryWindow Duration `json:"retry_window"` // Numbered messages, which senders retry for longer
+	AckDelay    Duration `json:"ack_delay"`    // Wait before acking, giving a member's own station the chance to ack first
+	DailyQuota  int      `json:"daily_quota"`  // Messages a member may receive per 24 hours; 0 is unlimited
+}
+
+// PolicyConfig sets what the gateway does with a message it will not deliver,
+// by reason: "drop" it silently, "rej" it, or "ack" it and discard it.
+// Members may choose their own action for blocked senders and their quota.
+type PolicyConfig struct {
+	Blocked   string `json:"blocked"`
+	Suspended string `json:"suspended"`
+	Quota     string `json:"quota"`
+	Deleted   string `json:"deleted"`
+
+	LogRetain Duration `json:"log_retain"` // Forget refusals logged for members after this long
+}
+
+// StationsConfig controls the heard-station table. Sightings are written in
+// batches so the database keeps up with the feed.
+type StationsConfig struct {
+	FlushInterval Duration `json:"flush_interval"` // Longest a sighting waits to be written
+	BatchSize     int      `json:"batch_size"`     // Write early once this many stations are waiting
+	Retain        Duration `json:"retain"`         // Forget stations not heard for this long
+}
+
+// ObjectsConfig controls how long APRS objects and items are kept. Their
+// owners retransmit them, so one not heard for Expire is taken as gone.
+type ObjectsConfig struct {
+	Expire   Duration `json:"expire"`
+	KillHold Duration `json:"kill_hold"` // Older live copies of a killed object heard within this long do not revive it
+}
+
+// Duration is a time.Duration that reads from JSON as a string like "90s" or "5m".
+type Duration time.Duration
+
+// UnmarshalJSON accepts a Go duration string or a number of seconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case float64:
+		*d = Duration(time.Duration(val * float64(time.Second)))
+	case string:
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", string(b))
+	}
+	return nil
+}
+
+// MarshalJSON writes the duration as a Go duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// D returns the value as a time.Duration.
+func (d Duration) D() time.Duration { return time.Duration(d) }
+
+// GatewayConfig holds the identity the gateway logs in and transmits with.
+type GatewayConfig struct {
+	Callsign   string `json:"callsign"`
+	Passcode   string `json:"passcode"`    // Empty means compute it from the callsign
+	ToCall     string `json:"tocall"`      // Destination (software ID) for packets the gateway originates
+	ThirdParty bool   `json:"third_party"` // Send members' packets third-party wrapped under the gateway callsign
+}
+
+// Default returns the built-in configuration used when nothing else is set.
+func Default() *Config {
+	return &Config{
+		ListenAddr: ":8585",
+		DBPath:     "data/users.db",
+		APRSIS: APRSISConfig{
+			Servers:      []string{"rotate.aprs.net:14580"}, // 14580 is the user-defined filter port
+			BackoffMin:   Duration(2 * time.Second),
+			BackoffMax:   Duration(5 * time.Minute),
+			StallTimeout: Duration(90 * time.Second),
+			LoginTimeout: Duration(15 * time.Second),
+		},
+		Gateway: GatewayConfig{
+			Callsign: "K8SDR-10",
+			ToCall:   "APZAMG",
+		},
+		IGate: IGateConfig{
+			RFPath:      "WIDE1-1",
+			HeardWindow: Duration(30 * time.Minute),
+			DedupWindow: Duration(30 * time.Second),
+			TxBudget:    10,
+			TxWindow:    Duration(time.Minute),
+		},
+		Server: ServerConfig{
+			Keepalive:    Duration(20 * time.Second),
+			LoginTimeout: Duration(30 * time.Second),
+			MaxClients:   100,
+		},
+		Outbound: OutboundConfig{
+			GlobalRate:     2,
+			GlobalBurst:    10,
+			UserRate:       0.2,
+			UserBurst:      3,
+			CoalesceWindow: Duration(10 * time.Second),
+			MaxQueue:       500,
+			MaxPerUser:     20,
+			RetryFirst:     Duration(30 * time.Second),
+			RetryMax:       Duration(10 * time.Minute),
+			ExpireAfter:    Duration(time.Hour),
+			TransmitLocal:  true,
+		},
+		Inbound: InboundConfig{
+			DedupWindow: Duration(30 * time.Second),
+			RetryWindow: Duration(30 * time.Minute),
+			DailyQuota:  500,
+		},
+		Policy: PolicyConfig{
+			Blocked:   "drop",
+			Suspended: "rej",
+			Quota:     "rej",
+			Deleted:   "drop",
+			LogRetain: Duration(30 * 24 * time.Hour),
+		},
+		Stations: StationsConfig{
+			FlushInterval: Duration(5 * time.Second),
+			BatchSize:     500,
+			Retain:        Duration(30 * 24 * time.Hour),
+		},
+		Objects: ObjectsConfig{
+			Expire:   Duration(2 * time.Hour),
+			KillHold: Duration(time.Minute),
+		},
+		Admins: []string{"K8SDR", "AD8NT"},
+	}
+}
+
+// Environment variables recognised by ApplyEnv.
+const (
+	EnvConfigFile = "APRSMSG_CONFIG"
+	EnvListenAddr = "APRSMSG_LISTEN"
+	EnvDBPath     = "APRSMSG_DB"
+	EnvServers    = "APRSMSG_APRSIS_SERVERS"
+	EnvCallsign   = "APRSMSG_CALLSIGN"
+	EnvPasscode   = "APRSMSG_PASSCODE"
+	EnvAdmins     = "APRSMSG_ADMINS"
+	EnvEchoRoute  = "APRSMSG_ECHO_ROUTE"
+	EnvServer     = "APRSMSG_SERVER_LISTEN"
+)
+
+// LoadFile overlays the JSON config file at path onto cfg.
+// Fields missing from the file keep their current values.
+func LoadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// ApplyEnv overlays any APRSMSG_* environment variables onto cfg.
+func ApplyEnv(cfg *Config) {
+	if v := os.Getenv(EnvListenAddr); v != "" {
+		cfg.ListenAddr = v
+	}
+	if v := os.Getenv(EnvDBPath); v != "" {
+		cfg.DBPath = v
+	}
+	if v := os.Getenv(EnvServers); v != "" {
+		cfg.APRSIS.Servers = SplitList(v)
+	}
+	if v := os.Getenv(EnvCallsign); v != "" {
+		cfg.Gateway.Callsign = v
+	}
+	if v, ok := os.LookupEnv(EnvPasscode); ok {
+		cfg.Gateway.Passcode = v
+	}
+	if v, ok := os.LookupEnv(EnvAdmins); ok {
+		cfg.Admins = SplitList(v)
+	}
+	if v := os.Getenv(EnvEchoRoute); v != "" {
+		cfg.EchoRoute = SplitList(v)
+	}
+	if v, ok := os.LookupEnv(EnvServer); ok {
+		cfg.Server.Listen = v
+	}
+}
+
+// SplitList splits a comma-separated value, dropping empty entries.
+func SplitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// normalize uppercases and trims callsigns and fills in TNC and echo route defaults.
+func (c *Config) normalize() {
+	c.Gateway.Callsign = strings.ToUpper(strings.TrimSpace(c.Gateway.Callsign))
+	if len(c.EchoRoute) == 0 {
+		// What a member's message looks like once the gateway has sent it on.
+		c.EchoRoute = []string{c.Gateway.ToCall, "TCPIP*", "qAC", c.Gateway.Callsign}
+	}
+	for i, a := range c.Admins {
+		c.Admins[i] = strings.ToUpper(strings.TrimSpace(a))
+	}
+	for i := range c.TNCs {
+		t := &c.TNCs[i]
+		t.Type = strings.ToLower(strings.TrimSpace(t.Type))
+		if t.Type == "" {
+			t.Type = "kiss"
+		}
+		if t.Name == "" {
+			t.Name = t.Type + ":" + t.Addr
+		}
+	}
+}
+
+// Validate reports the first setting that would stop the gateway from working.
+func (c *Config) Validate() error {
+	if c.ListenAddr == "" {
+		return fmt.Errorf("listen address is empty")
+	}
+	if c.DBPath == "" {
+		return fmt.Errorf("database path is empty")
+	}
+	if len(c.APRSIS.Servers) == 0 {
+		return fmt.Errorf("no APRS-IS servers configured")
+	}
+	if c.APRSIS.BackoffMin <= 0 || c.APRSIS.BackoffMax < c.APRSIS.BackoffMin {
+		return fmt.Errorf("APRS-IS backoff range is invalid")
+	}
+	if c.APRSIS.StallTimeout <= 0 || c.APRSIS.LoginTimeout <= 0 {
+		return fmt.Errorf("APRS-IS stall and login timeouts must be positive")
+	}
+	for _, t := range c.TNCs {
+		if t.Addr == "" {
+			return fmt.Errorf("TNC %q has no address", t.Name)
+		}
+		if t.Port < 0 || t.Port > 15 {
+			return fmt.Errorf("TNC %q port must be 0-15", t.Name)
+		}
+	}
+	if c.IGate.Enabled && (c.IGate.HeardWindow <= 0 || c.IGate.DedupWindow <= 0 || c.IGate.TxWindow <= 0) {
+		return fmt.Errorf("IGate windows must be positive")
+	}
+	if c.Server.Listen != "" && (c.Server.Keepalive <= 0 || c.Server.LoginTimeout <= 0) {
+		return fmt.Errorf("server keepalive and login timeout must be positive")
+	}
+	if c.Outbound.GlobalRate <= 0 || c.Outbound.UserRate <= 0 || c.Outbound.GlobalBurst < 1 || c.Outbound.UserBurst < 1 {
+		return fmt.Errorf("outbound rates and bursts must be positive")
+	}
+	if c.Outbound.MaxQueue < 1 || c.Outbound.MaxPerUser < 1 {
+		return fmt.Errorf("outbound queue limits must be positive")
+	}
+	if c.Outbound.RetryFirst <= 0 || c.Outbound.RetryMax < c.Outbound.RetryFirst || c.Outbound.ExpireAfter <= 0 {
+		return fmt.Errorf("outbound retry_first and expire_after must be positive, and retry_max at least retry_first")
+	}
+	if c.Inbound.DedupWindow <= 0 || c.Inbound.RetryWindow <= 0 {
+		return fmt.Errorf("inbound dedup and retry windows must be positive")
+	}
+	if c.Inbound.AckDelay < 0 || c.Inbound.DailyQuota < 0 {
+		return fmt.Errorf("inbound ack delay and daily quota must not be negative")
+	}
+	for reason, action := range map[string]string{
+		"blocked": c.Policy.Blocked, "suspended": c.Policy.Suspended, "quota": c.Policy.Quota, "deleted": c.Policy.Deleted,
+	} {
+		if action != "drop" && action != "rej" && action != "ack" {
+			return fmt.Errorf("policy for %s must be drop, rej or ack", reason)
+		}
+	}
+	if c.Policy.LogRetain <= 0 {
+		return fmt.Errorf("policy log retention must be positive")
+	}
+	if c.Stations.FlushInterval <= 0 || c.Stations.BatchSize < 1 || c.Stations.Retain <= 0 {
+		return fmt.Errorf("stations flush interval, batch size and retention must be positive")
+	}
+	if c.Objects.Expire <= 0 || c.Objects.KillHold < 0 {
+		return fmt.Errorf("objects expiry must be positive and kill hold not negative")
+	}
+	if c.Gateway.Callsign == "" {
+		return fmt.Errorf("gateway callsign is empty")
+	}
+	if c.Gateway.ToCall == "" {
+		return fmt.Errorf("gateway tocall is empty")
+	}
+	return nil
+}
+
+// IsAdmin reports whether the base callsign is in the admin list.
+func (c *Config) IsAdmin(baseCallsign string) bool {
+	baseCallsign = strings.ToUpper(baseCallsign)
+	for _, a := range c.Admins {
+		if a == baseCallsign {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	mu        sync.RWMutex
+	current   = initial()
+	filePath  string
+	overrides func(*Config)
+	listeners []func(old, new *Config)
+)
+
+// initial is the configuration in effect before Init: the defaults, normalized
+// as Reload would.
+func initial() *Config {
+	cfg := Default()
+	cfg.normalize()
+	return cfg
+}
+
+// Init loads the configuration for the first time. path may be empty, in which
+// case only defaults, environment and overrides apply. overrides is re-applied
+// on every reload so command-line flags always win.
+func Init(path string, override func(*Config)) error {
+	mu.Lock()
+	filePath = path
+	overrides = override
+	mu.Unlock()
+	return Reload()
+}
+
+// Reload re-reads the config file and environment and notifies listeners.
+// On error the previous configuration stays in effect.
+func Reload() error {
+	mu.RLock()
+	path, override := filePath, overrides
+	mu.RUnlock()
+
+	cfg := Default()
+	if path != "" {
+		if err := LoadFile(path, cfg); err != nil {
+			return err
+		}
+	}
+	ApplyEnv(cfg)
+	if override != nil {
+		override(cfg)
+	}
+	cfg.normalize()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	old := current
+	current = cfg
+	fns := append([]func(old, new *Config){}, listeners...)
+	mu.Unlock()
+
+	log.Printf("[CONFIG] Loaded configuration (gateway %s, %d APRS-IS server(s))", cfg.Gateway.Callsign, len(cfg.APRSIS.Servers))
+	for _, fn := range fns {
+		fn(old, cfg)
+	}
+	return nil
+}
+
+// Get returns the active configuration. Callers must treat it as read-only.
+func Get() *Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// OnReload registers fn to be called after each successful load.
+func OnReload(fn func(old, new *Config)) {
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, fn)
+}
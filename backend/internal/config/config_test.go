@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDefault tests that the defaults are valid and leave derived settings empty
+func TestDefault(t *testing.T) {
+	cfg := Default()
+	if cfg.Gateway.Passcode != "" {
+		t.Fatalf("Expected empty default passcode, got '%s'", cfg.Gateway.Passcode)
+	}
+	if cfg.EchoRoute != nil {
+		t.Fatalf("Expected no default echo route, got '%v'", cfg.EchoRoute)
+	}
+	if cfg.Server.Listen != "" {
+		t.Fatalf("Expected the server port disabled by default, got '%s'", cfg.Server.Listen)
+	}
+	cfg.normalize()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected defaults to validate, got '%v'", err)
+	}
+	if got := strings.Join(cfg.EchoRoute, ","); got != "APZAMG,TCPIP*,qAC,K8SDR-10" {
+		t.Fatalf("Expected '%s', got '%s'", "APZAMG,TCPIP*,qAC,K8SDR-10", got)
+	}
+}
+
+// TestNormalize tests callsign case, the derived echo route and TNC defaults
+func TestNormalize(t *testing.T) {
+	cfg := Default()
+	cfg.Gateway.Callsign = " n0gw-5 "
+	cfg.Gateway.ToCall = "APXXXX"
+	cfg.Admins = []string{"n0adm "}
+	cfg.TNCs = []TNCConfig{{Addr: "127.0.0.1:8001"}, {Type: " AGWPE", Addr: "127.0.0.1:8000", Name: "vhf"}}
+	cfg.normalize()
+
+	if cfg.Gateway.Callsign != "N0GW-5" {
+		t.Fatalf("Expected '%s', got '%s'", "N0GW-5", cfg.Gateway.Callsign)
+	}
+	if got := strings.Join(cfg.EchoRoute, ","); got != "APXXXX,TCPIP*,qAC,N0GW-5" {
+		t.Fatalf("Expected '%s', got '%s'", "APXXXX,TCPIP*,qAC,N0GW-5", got)
+	}
+	if !cfg.IsAdmin("n0adm") {
+		t.Fatalf("Expected N0ADM to be an admin")
+	}
+	if cfg.TNCs[0].Type != "kiss" || cfg.TNCs[0].Name != "kiss:127.0.0.1:8001" {
+		t.Fatalf("Expected '%s', got '%s'", "kiss:127.0.0.1:8001", cfg.TNCs[0].Name)
+	}
+	if cfg.TNCs[1].Type != "agwpe" || cfg.TNCs[1].Name != "vhf" {
+		t.Fatalf("Expected '%s', got '%s'", "agwpe vhf", cfg.TNCs[1].Type+" "+cfg.TNCs[1].Name)
+	}
+
+	// A configured route is kept.
+	cfg = Default()
+	cfg.EchoRoute = []string{"APRS", "TCPIP*"}
+	cfg.normalize()
+	if got := strings.Join(cfg.EchoRoute, ","); got != "APRS,TCPIP*" {
+		t.Fatalf("Expected '%s', got '%s'", "APRS,TCPIP*", got)
+	}
+}
+
+// TestApplyEnv tests that environment variables override the defaults
+func TestApplyEnv(t *testing.T) {
+	t.Setenv(EnvListenAddr, ":9000")
+	t.Setenv(EnvDBPath, "/tmp/x.db")
+	t.Setenv(EnvServers, "a.example:14580, ,b.example:14580")
+	t.Setenv(EnvCallsign, "N0ENV-1")
+	t.Setenv(EnvPasscode, "12345")
+	t.Setenv(EnvAdmins, "")
+	t.Setenv(EnvEchoRoute, "APRS,TCPIP*")
+	t.Setenv(EnvServer, ":14580")
+
+	cfg := Default()
+	ApplyEnv(cfg)
+	if cfg.ListenAddr != ":9000" || cfg.DBPath != "/tmp/x.db" {
+		t.Fatalf("Expected '%s', got '%s'", ":9000 /tmp/x.db", cfg.ListenAddr+" "+cfg.DBPath)
+	}
+	if got := strings.Join(cfg.APRSIS.Servers, ","); got != "a.example:14580,b.example:14580" {
+		t.Fatalf("Expected '%s', got '%s'", "a.example:14580,b.example:14580", got)
+	}
+	if cfg.Gateway.Callsign != "N0ENV-1" || cfg.Gateway.Passcode != "12345" {
+		t.Fatalf("Expected '%s', got '%s'", "N0ENV-1 12345", cfg.Gateway.Callsign+" "+cfg.Gateway.Passcode)
+	}
+	if len(cfg.Admins) != 0 {
+		t.Fatalf("Expected an empty admin variable to clear admins, got '%v'", cfg.Admins)
+	}
+	if got := strings.Join(cfg.EchoRoute, ","); got != "APRS,TCPIP*" {
+		t.Fatalf("Expected '%s', got '%s'", "APRS,TCPIP*", got)
+	}
+	if cfg.Server.Listen != ":14580" {
+		t.Fatalf("Expected '%s', got '%s'", ":14580", cfg.Server.Listen)
+	}
+}
+
+// TestValidate tests that broken settings are rejected
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(*Config)
+		want   string
+	}{
+		{"listen", func(c *Config) { c.ListenAddr = "" }, "listen address"},
+		{"servers", func(c *Config) { c.APRSIS.Servers = nil }, "APRS-IS servers"},
+		{"backoff", func(c *Config) { c.APRSIS.BackoffMax = c.APRSIS.BackoffMin - 1 }, "backoff"},
+		{"tnc addr", func(c *Config) { c.TNCs = []TNCConfig{{Name: "vhf"}} }, "no address"},
+		{"tnc port", func(c *Config) { c.TNCs = []TNCConfig{{Name: "vhf", Addr: "x:1", Port: 16}} }, "port must be"},
+		{"server", func(c *Config) { c.Server.Listen, c.Server.Keepalive = ":14580", 0 }, "keepalive"},
+		{"retry", func(c *Config) { c.Outbound.RetryMax = c.Outbound.RetryFirst - 1 }, "retry_max"},
+		{"quota", func(c *Config) { c.Inbound.DailyQuota = -1 }, "daily quota"},
+		{"policy", func(c *Config) { c.Policy.Quota = "bounce" }, "policy for quota"},
+		{"policy log", func(c *Config) { c.Policy.LogRetain = 0 }, "log retention"},
+		{"objects", func(c *Config) { c.Objects.KillHold = Duration(-time.Second) }, "kill hold"},
+		{"callsign", func(c *Config) { c.Gateway.Callsign = " " }, "callsign is empty"},
+	}
+	for _, tc := range cases {
+		cfg := Default()
+		tc.mutate(cfg)
+		cfg.normalize()
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: Expected error containing '%s', got '%v'", tc.name, tc.want, err)
+		}
+	}
+}
+
+// TestReload tests loading a file, notifying listeners and keeping the old config on error
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(body string) {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	defer Init("", nil)
+
+	var calls int
+	var last *Config
+	OnReload(func(old, new *Config) {
+		calls++
+		last = new
+	})
+
+	write(`{"gateway": {"callsign": "n0file-10"}, "inbound": {"ack_delay": "2s"}}`)
+	err := Init(path, func(c *Config) { c.ListenAddr = ":9999" })
+	if err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	cfg := Get()
+	if cfg.Gateway.Callsign != "N0FILE-10" || cfg.Inbound.AckDelay.D() != 2*time.Second {
+		t.Fatalf("Expected '%s', got '%s'", "N0FILE-10 2s", cfg.Gateway.Callsign+" "+cfg.Inbound.AckDelay.D().String())
+	}
+	if cfg.ListenAddr != ":9999" {
+		t.Fatalf("Expected the override to win, got '%s'", cfg.ListenAddr)
+	}
+	if cfg.Outbound.MaxQueue != Default().Outbound.MaxQueue {
+		t.Fatalf("Expected fields missing from the file to keep their defaults, got %d", cfg.Outbound.MaxQueue)
+	}
+	if got := strings.Join(cfg.EchoRoute, ","); got != "APZAMG,TCPIP*,qAC,N0FILE-10" {
+		t.Fatalf("Expected '%s', got '%s'", "APZAMG,TCPIP*,qAC,N0FILE-10", got)
+	}
+	if calls != 1 || last != cfg {
+		t.Fatalf("Expected one notification with the new config, got %d", calls)
+	}
+
+	write(`{"policy": {"blocked": "bounce"}}`)
+	if err := Reload(); err == nil {
+		t.Fatalf("Expected an invalid file to be rejected")
+	}
+	write(`{"gateway": `)
+	if err := Reload(); err == nil {
+		t.Fatalf("Expected a malformed file to be rejected")
+	}
+	if Get() != cfg || calls != 1 {
+		t.Fatalf("Expected the previous config to stay in effect")
+	}
+
+	write(`{"gateway": {"callsign": "N0FILE-11"}}`)
+	if err := Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if Get().Gateway.Callsign != "N0FILE-11" || calls != 2 {
+		t.Fatalf("Expected '%s', got '%s'", "N0FILE-11", Get().Gateway.Callsign)
+	}
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Conversation is the message-numbering state between a user (base
+// callsign) and one contact.
+type Conversation struct {
+	User           string
+	Contact        string
+	LastSent       string // Last message number we allocated
+	LastReceived   string // Last message number the contact sent us
+	ReceivedCopies int    // Times LastReceived has arrived
+	ReplyAck       bool   // The contact has sent REPLY-ACK {MM}AA messages
+}
+
+// GetConversation returns the state between user and contact, or a fresh
+// one if they have not exchanged numbered messages.
+func GetConversation(user, contact string) (*Conversation, error) {
+	c := &Conversation{User: user, Contact: contact}
+	err := db.QueryRow(`
+		SELECT last_sent, last_received, received_copies, reply_ack
+		FROM conversations WHERE user_callsign = ? AND contact_callsign = ?`,
+		user, contact,
+	).Scan(&c.LastSent, &c.LastReceived, &c.ReceivedCopies, &c.ReplyAck)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, nil
+	}
+	return c, err
+}
+
+// SaveConversation stores the state between c.User and c.Contact.
+func SaveConversation(c *Conversation) error {
+	_, err := db.Exec(`
+		INSERT INTO conversations (user_callsign, contact_callsign, last_sent, last_received, received_copies, reply_ack)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_callsign, contact_callsign) DO UPDATE SET
+			last_sent = excluded.last_sent,
+			last_received = excluded.last_received,
+			received_copies = excluded.received_copies,
+			reply_ack = excluded.reply_ack`,
+		c.User, c.Contact, c.LastSent, c.LastReceived, c.ReceivedCopies, c.ReplyAck,
+	)
+	return err
+}
+
+// InFlightMessageNumbers returns the numbers of messages the user (with any
+// SSID) sent to contact that are still waiting for an ack.
+func InFlightMessageNumbers(user, contact string) (map[string]bool, error) {
+	baseCallsign := strings.Split(user, "-")[0]
+	rows, err := db.Query(`
+		SELECT msg_no FROM messages
+		WHERE (from_callsign = ? OR from_callsign LIKE ? || '-%')
+			AND to_callsign = ? AND msg_no != '' AND status IN (?, ?, ?)`,
+		baseCallsign, baseCallsign, contact, StatusQueued, StatusSent, StatusRetrying,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inFlight := make(map[string]bool)
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		inFlight[n] = true
+	}
+	return inFlight, rows.Err()
+}
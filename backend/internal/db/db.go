@@ -37,7 +37,11 @@ func Init(path string) error {
 				from_callsign TEXT NOT NULL,
 				message TEXT NOT NULL,
 				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-				is_delivered BOOLEAN NOT NULL DEFAULT 0
+				is_delivered BOOLEAN NOT NULL DEFAULT 0,
+				msg_no TEXT NOT NULL DEFAULT '',
+				status TEXT NOT NULL DEFAULT '',
+				group_id INTEGER NOT NULL DEFAULT 0,
+				copies INTEGER NOT NULL DEFAULT 1
 			);
 			CREATE TABLE IF NOT EXISTS blocked_users (
 				id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -47,11 +51,113 @@ func Init(path string) error {
 				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
 				UNIQUE(user_id, blocked_callsign)
 			);
+			CREATE TABLE IF NOT EXISTS conversations (
+				user_callsign TEXT NOT NULL,
+				contact_callsign TEXT NOT NULL,
+				last_sent TEXT NOT NULL DEFAULT '',
+				last_received TEXT NOT NULL DEFAULT '',
+				received_copies INTEGER NOT NULL DEFAULT 0,
+				reply_ack BOOLEAN NOT NULL DEFAULT 0,
+				PRIMARY KEY(user_callsign, contact_callsign)
+			);
+			CREATE TABLE IF NOT EXISTS user_settings (
+				user_id INTEGER PRIMARY KEY,
+				ack_policy TEXT NOT NULL DEFAULT 'always',
+				blocked_action TEXT NOT NULL DEFAULT '',
+				quota_action TEXT NOT NULL DEFAULT '',
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			);
+			CREATE TABLE IF NOT EXISTS suspended_users (
+				user_id INTEGER PRIMARY KEY,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			);
+			CREATE TABLE IF NOT EXISTS deleted_accounts (
+				callsign TEXT PRIMARY KEY,
+				deleted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE TABLE IF NOT EXISTS policy_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_callsign TEXT NOT NULL,
+				from_callsign TEXT NOT NULL,
+				to_callsign TEXT NOT NULL,
+				msg_no TEXT NOT NULL DEFAULT '',
+				message TEXT NOT NULL,
+				reason TEXT NOT NULL,
+				action TEXT NOT NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS policy_log_user ON policy_log(user_callsign, id);
+			CREATE TABLE IF NOT EXISTS outbox (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				message_id INTEGER NOT NULL UNIQUE,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME NOT NULL,
+				next_at DATETIME NOT NULL,
+				FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE
+			);
+			CREATE TABLE IF NOT EXISTS stations (
+				callsign TEXT PRIMARY KEY,
+				last_heard DATETIME NOT NULL,
+				lat REAL,
+				lon REAL,
+				symbol TEXT NOT NULL DEFAULT '',
+				position_at DATETIME,
+				status TEXT NOT NULL DEFAULT '',
+				capabilities TEXT NOT NULL DEFAULT '',
+				path TEXT NOT NULL DEFAULT '',
+				igate TEXT NOT NULL DEFAULT '',
+				packets INTEGER NOT NULL DEFAULT 0
+			);
+			CREATE INDEX IF NOT EXISTS stations_last_heard ON stations(last_heard);
+			CREATE TABLE IF NOT EXISTS objects (
+				name TEXT NOT NULL,
+				originator TEXT NOT NULL,
+				item BOOLEAN NOT NULL DEFAULT 0,
+				killed BOOLEAN NOT NULL DEFAULT 0,
+				lat REAL NOT NULL,
+				lon REAL NOT NULL,
+				symbol TEXT NOT NULL DEFAULT '',
+				comment TEXT NOT NULL DEFAULT '',
+				reported_at DATETIME,
+				last_heard DATETIME NOT NULL,
+				PRIMARY KEY(name, originator)
+			);
+			CREATE INDEX IF NOT EXISTS objects_last_heard ON objects(last_heard);
+			CREATE INDEX IF NOT EXISTS objects_lat ON objects(lat);
 		`)
+		if err != nil {
+			return
+		}
+		err = migrate()
 	})
 	return err
 }
 
+// migrate adds columns introduced after a table was first created.
+func migrate() error {
+	columns := []struct{ table, name, def string }{
+		{"messages", "msg_no", "TEXT NOT NULL DEFAULT ''"},
+		{"messages", "status", "TEXT NOT NULL DEFAULT ''"},
+		{"messages", "group_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "copies", "INTEGER NOT NULL DEFAULT 1"},
+		{"user_settings", "blocked_action", "TEXT NOT NULL DEFAULT ''"},
+		{"user_settings", "quota_action", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.name).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err := db.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.name + " " + c.def); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func Close() {
 	if db != nil {
 		db.Close()
@@ -63,6 +169,11 @@ func CreateUser(user *models.User) error {
 		"INSERT INTO users (callsign, password_hash, passcode) VALUES (?, ?, ?)",
 		user.Callsign, user.PasswordHash, user.Passcode,
 	)
+	if err != nil {
+		return err
+	}
+	// A callsign registered again is no longer a deleted account.
+	_, err = db.Exec("DELETE FROM deleted_accounts WHERE callsign = ?", strings.Split(strings.ToUpper(user.Callsign), "-")[0])
 	return err
 }
 
@@ -127,8 +238,41 @@ type Message struct {
 	Message      string    `json:"message"`
 	CreatedAt    time.Time `json:"created_at"`
 	IsDelivered  bool      `json:"is_delivered"`
+	MsgNo        string    `json:"msg_no,omitempty"`   // Message number, for messages sent with one
+	Status       string    `json:"status,omitempty"`   // Delivery status of a sent message
+	GroupID      int64     `json:"group_id,omitempty"` // ID of the first segment, for segments of one long message
+	Copies       int       `json:"copies"`             // Times a received message was heard
+}
+
+// messageColumns are the columns scanMessages reads, in order.
+const messageColumns = "id, to_callsign, from_callsign, message, created_at, is_delivered, msg_no, status, group_id, copies"
+
+// scanMessages reads rows selected with messageColumns.
+func scanMessages(rows *sql.Rows) ([]*Message, error) {
+	defer rows.Close()
+	var messages []*Message
+	for rows.Next() {
+		var m Message
+		var created string
+		if err := rows.Scan(&m.ID, &m.ToCallsign, &m.FromCallsign, &m.Message, &created, &m.IsDelivered, &m.MsgNo, &m.Status, &m.GroupID, &m.Copies); err != nil {
+			return nil, err
+		}
+		m.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", created)
+		messages = append(messages, &m)
+	}
+	return messages, rows.Err()
 }
 
+// Delivery statuses of sent messages.
+const (
+	StatusQueued   = "queued"   // In the outbox, not transmitted yet
+	StatusSent     = "sent"     // Transmitted, waiting for an ack
+	StatusRetrying = "retrying" // Retransmitted at least once, waiting for an ack
+	StatusAcked    = "acked"    // The recipient acked it
+	StatusRejected = "rejected" // The recipient rejected it
+	StatusExpired  = "expired"  // Never acked; the outbox gave up
+)
+
 // StoreMessage inserts a message into the DB (for later delivery/history).
 func StoreMessage(to, from, msg string) error {
 	_, err := db.Exec(
@@ -138,11 +282,150 @@ func StoreMessage(to, from, msg string) error {
 	return err
 }
 
+// StoreSentMessage stores a message sent with a message number, so that the
+// recipient's ack or rej can be matched to it.
+func StoreSentMessage(to, from, msg, msgNo string) error {
+	_, err := db.Exec(
+		"INSERT INTO messages (to_callsign, from_callsign, message, msg_no, status) VALUES (?, ?, ?, ?, ?)",
+		to, from, msg, msgNo, StatusSent,
+	)
+	return err
+}
+
+// SetSentMessageStatus sets the status of the newest message the user (with
+// any SSID) sent to contact with msgNo that is still waiting for an ack, and
+// takes it out of the outbox. It returns the message's ID, or 0 if no such
+// message was found.
+func SetSentMessageStatus(user, contact, msgNo, status string) (int64, error) {
+	baseCallsign := strings.Split(user, "-")[0]
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`
+		SELECT id FROM messages
+		WHERE (from_callsign = ? OR from_callsign LIKE ? || '-%')
+			AND to_callsign = ? AND msg_no = ? AND status IN (?, ?, ?)
+		ORDER BY id DESC LIMIT 1`,
+		baseCallsign, baseCallsign, contact, msgNo, StatusQueued, StatusSent, StatusRetrying,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE messages SET status = ? WHERE id = ?", status, id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM outbox WHERE message_id = ?", id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// FindSentMessage returns the ID of the newest stored message from one
+// callsign to another with msgNo, or, when msgNo is empty, with exactly the
+// text msg. It returns 0 if there is none.
+func FindSentMessage(to, from, msgNo, msg string) (int64, error) {
+	var id int64
+	err := db.QueryRow(`
+		SELECT id FROM messages
+		WHERE UPPER(to_callsign) = UPPER(?) AND UPPER(from_callsign) = UPPER(?) AND msg_no = ?
+			AND (msg_no != '' OR message = ?)
+		ORDER BY id DESC LIMIT 1`,
+		to, from, msgNo, msg,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// GetMessage returns one message by ID, or nil if there is none.
+func GetMessage(id int64) (*Message, error) {
+	rows, err := db.Query("SELECT "+messageColumns+" FROM messages WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+	return messages[0], nil
+}
+
+// ListMessageGroup returns the segments of one long message, in order.
+func ListMessageGroup(groupID int64) ([]*Message, error) {
+	rows, err := db.Query("SELECT "+messageColumns+" FROM messages WHERE group_id = ? ORDER BY id ASC", groupID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+// InsertMessage stores a message received at the given time, like
+// StoreMessage, and returns its ID.
+func InsertMessage(to, from, msg string, at time.Time) (int64, error) {
+	res, err := db.Exec(
+		"INSERT INTO messages (to_callsign, from_callsign, message, created_at) VALUES (?, ?, ?, ?)",
+		to, from, msg, at.UTC().Format(sqlTime),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// CountMessageCopy records another copy of a received message heard and
+// returns how many copies have been heard in all.
+func CountMessageCopy(id int64) (int, error) {
+	var copies int
+	err := db.QueryRow("UPDATE messages SET copies = copies + 1 WHERE id = ? RETURNING copies", id).Scan(&copies)
+	return copies, err
+}
+
+// ReplaceMessages replaces the stored parts of a multipart message with one
+// message holding the whole text, keeping the first part's time and
+// delivered flag. It returns the new message's ID.
+func ReplaceMessages(ids []int64, to, from, msg string) (int64, error) {
+	if len(ids) == 0 {
+		return InsertMessage(to, from, msg, time.Now())
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO messages (to_callsign, from_callsign, message, created_at, is_delivered)
+		SELECT ?, ?, ?, created_at, is_delivered FROM messages WHERE id = ?`,
+		to, from, msg, ids[0],
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, old := range ids {
+		if _, err := tx.Exec("DELETE FROM messages WHERE id = ?", old); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
 // ListAllMessagesForUser returns all messages where the user (with any SSID) is either the sender or the recipient.
 func ListAllMessagesForUser(callsign string) ([]*Message, error) {
 	baseCallsign := strings.Split(callsign, "-")[0]
-	const query = `
-		SELECT id, to_callsign, from_callsign, message, created_at, is_delivered
+	query := `
+		SELECT ` + messageColumns + `
 		FROM messages
 		WHERE
 			(from_callsign = ? OR from_callsign LIKE ? || '-%') OR
@@ -153,19 +436,7 @@ func ListAllMessagesForUser(callsign string) ([]*Message, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var messages []*Message
-	for rows.Next() {
-		var m Message
-		var created string
-		if err := rows.Scan(&m.ID, &m.ToCallsign, &m.FromCallsign, &m.Message, &created, &m.IsDelivered); err != nil {
-			return nil, err
-		}
-		m.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", created)
-		messages = append(messages, &m)
-	}
-	return messages, nil
+	return scanMessages(rows)
 }
 
 // ListUndeliveredMessages returns all undelivered messages for a callsign, ordered oldest first.
@@ -173,8 +444,8 @@ func ListUndeliveredMessages(callsign string) ([]*Message, error) {
 	// The user's callsign is a base callsign (e.g., "K8SDR"), but messages in the DB
 	// may be addressed to a specific SSID (e.g., "K8SDR-9"). This query finds all
 	// messages for the base callsign, with or without an SSID.
-	const query = `
-		SELECT id, to_callsign, from_callsign, message, created_at, is_delivered
+	query := `
+		SELECT ` + messageColumns + `
 		FROM messages
 		WHERE (to_callsign = ? OR to_callsign LIKE ? || '-%') AND is_delivered = 0
 		ORDER BY created_at ASC`
@@ -183,19 +454,7 @@ func ListUndeliveredMessages(callsign string) ([]*Message, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var messages []*Message
-	for rows.Next() {
-		var m Message
-		var created string
-		if err := rows.Scan(&m.ID, &m.ToCallsign, &m.FromCallsign, &m.Message, &created, &m.IsDelivered); err != nil {
-			return nil, err
-		}
-		m.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", created)
-		messages = append(messages, &m)
-	}
-	return messages, nil
+	return scanMessages(rows)
 }
 
 // MarkMessagesDelivered marks a list of message IDs as delivered.
@@ -261,14 +520,26 @@ func ExportDataForUser(callsign string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	settings, err := GetUserSettings(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions, err := ListPolicyDecisions(user.Callsign, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	userInfo := map[string]interface{}{
 		"id":       user.ID,
 		"callsign": user.Callsign,
 	}
 
 	return map[string]interface{}{
-		"user_info": userInfo,
-		"messages":  messages,
+		"user_info":  userInfo,
+		"settings":   settings,
+		"messages":   messages,
+		"policy_log": decisions,
 	}, nil
 }
 
@@ -286,8 +557,18 @@ func DeleteUserAndData(userID int) error {
 	if err != nil {
 		return err
 	}
+	if _, err = db.Exec("DELETE FROM conversations WHERE user_callsign = ?", baseUser); err != nil {
+		return err
+	}
+	if _, err = db.Exec("DELETE FROM policy_log WHERE user_callsign = ?", baseUser); err != nil {
+		return err
+	}
+	// Remembered so messages still arriving for the callsign get the deleted-account policy.
+	if _, err = db.Exec("INSERT OR REPLACE INTO deleted_accounts (callsign) VALUES (?)", baseUser); err != nil {
+		return err
+	}
 
-	// Now delete the user, which will cascade to blocked_users
+	// Now delete the user, which will cascade to blocked_users, user_settings and suspended_users
 	_, err = db.Exec("DELETE FROM users WHERE id = ?", userID)
 	return err
 }
@@ -316,4 +597,4 @@ func GetMessageStats() (*MessageStats, error) {
 		return nil, err
 	}
 	return stats, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Object is an APRS object or item, keyed by name and originating station.
+type Object struct {
+	Name       string    `json:"name"`
+	Originator string    `json:"originator"` // Station that transmitted it
+	Item       bool      `json:"item"`       // An item rather than an object
+	Killed     bool      `json:"killed"`
+	Lat        float64   `json:"lat"`
+	Lon        float64   `json:"lon"`
+	Symbol     string    `json:"symbol"`
+	Comment    string    `json:"comment,omitempty"`
+	ReportedAt time.Time `json:"reported_at,omitempty"` // The object's own timestamp; items have none
+	LastHeard  time.Time `json:"last_heard"`
+}
+
+// SaveObject stores a report of o. A live report does not revive an object
+// killed at or after holdSince, as it is likely an older copy heard late.
+func SaveObject(o *Object, holdSince time.Time) error {
+	var reported interface{}
+	if !o.ReportedAt.IsZero() {
+		reported = o.ReportedAt.UTC().Format(sqlTime)
+	}
+	_, err := db.Exec(`
+		INSERT INTO objects (name, originator, item, killed, lat, lon, symbol, comment, reported_at, last_heard)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name, originator) DO UPDATE SET
+			item = excluded.item,
+			killed = excluded.killed,
+			lat = excluded.lat,
+			lon = excluded.lon,
+			symbol = excluded.symbol,
+			comment = excluded.comment,
+			reported_at = excluded.reported_at,
+			last_heard = excluded.last_heard
+		WHERE NOT (objects.killed AND NOT excluded.killed AND objects.last_heard >= ?)`,
+		o.Name, o.Originator, o.Item, o.Killed, o.Lat, o.Lon, o.Symbol, o.Comment, reported,
+		o.LastHeard.UTC().Format(sqlTime), holdSince.UTC().Format(sqlTime),
+	)
+	return err
+}
+
+// Box is a range of latitudes and longitudes in degrees. A MinLon greater
+// than MaxLon wraps across the antimeridian.
+type Box struct {
+	MinLat, MaxLat float64
+	MinLon, MaxLon float64
+}
+
+// ListLiveObjects returns the objects and items inside box heard since since
+// and not killed, in no particular order.
+func ListLiveObjects(since time.Time, box Box) ([]*Object, error) {
+	lonClause := "lon BETWEEN ? AND ?"
+	if box.MinLon > box.MaxLon {
+		lonClause = "(lon >= ? OR lon <= ?)"
+	}
+	rows, err := db.Query(`
+		SELECT name, originator, item, killed, lat, lon, symbol, comment, reported_at, last_heard
+		FROM objects WHERE NOT killed AND last_heard >= ? AND lat BETWEEN ? AND ? AND `+lonClause,
+		since.UTC().Format(sqlTime), box.MinLat, box.MaxLat, box.MinLon, box.MaxLon,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []*Object
+	for rows.Next() {
+		o := &Object{}
+		var reported sql.NullString
+		var lastHeard string
+		if err := rows.Scan(&o.Name, &o.Originator, &o.Item, &o.Killed, &o.Lat, &o.Lon, &o.Symbol, &o.Comment, &reported, &lastHeard); err != nil {
+			return nil, err
+		}
+		if reported.Valid {
+			o.ReportedAt = parseSQLTime(reported.String)
+		}
+		o.LastHeard = parseSQLTime(lastHeard)
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// PruneObjects deletes objects, live or killed, not heard since before and
+// returns how many went.
+func PruneObjects(before time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM objects WHERE last_heard < ?", before.UTC().Format(sqlTime))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"time"
+)
+
+// sqlTime is the layout DATETIME columns are stored and compared in.
+const sqlTime = "2006-01-02 15:04:05"
+
+// OutboxEntry is a message waiting to be transmitted or acked. Its status
+// lives on the message row.
+type OutboxEntry struct {
+	ID        int64
+	MessageID int64
+	From      string
+	To        string
+	Message   string // Message body as transmitted, including any {msgno}
+	MsgNo     string // Empty for messages that expect no ack
+	GroupID   int64  // Set for segments of one long message
+	Status    string
+	Attempts  int
+	CreatedAt time.Time
+	NextAt    time.Time
+}
+
+// QueueMessages stores messages the user is sending with status "queued"
+// and adds them to the outbox, due now. msgs and msgNos are parallel; more
+// than one message means segments of one long message, which share a group.
+func QueueMessages(to, from string, msgs, msgNos []string, now time.Time) ([]*OutboxEntry, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var entries []*OutboxEntry
+	var groupID int64
+	for i, msg := range msgs {
+		res, err := tx.Exec(
+			"INSERT INTO messages (to_callsign, from_callsign, message, msg_no, status, created_at, group_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			to, from, msg, msgNos[i], StatusQueued, now.UTC().Format(sqlTime), groupID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		e := &OutboxEntry{From: from, To: to, Message: msg, MsgNo: msgNos[i], Status: StatusQueued, CreatedAt: now, NextAt: now}
+		if e.MessageID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		if i == 0 && len(msgs) > 1 {
+			groupID = e.MessageID
+			if _, err := tx.Exec("UPDATE messages SET group_id = ? WHERE id = ?", groupID, groupID); err != nil {
+				return nil, err
+			}
+		}
+		e.GroupID = groupID
+		res, err = tx.Exec(
+			"INSERT INTO outbox (message_id, created_at, next_at) VALUES (?, ?, ?)",
+			e.MessageID, now.UTC().Format(sqlTime), now.UTC().Format(sqlTime),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if e.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, tx.Commit()
+}
+
+// DueOutbox returns the outbox entries due at or before now, oldest first.
+func DueOutbox(now time.Time) ([]*OutboxEntry, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.message_id, m.from_callsign, m.to_callsign, m.message, m.msg_no, m.status, m.group_id,
+			o.attempts, o.created_at, o.next_at
+		FROM outbox o JOIN messages m ON m.id = o.message_id
+		WHERE o.next_at <= ?
+		ORDER BY o.next_at ASC, o.id ASC`,
+		now.UTC().Format(sqlTime),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*OutboxEntry
+	for rows.Next() {
+		e := &OutboxEntry{}
+		var created, next string
+		if err := rows.Scan(&e.ID, &e.MessageID, &e.From, &e.To, &e.Message, &e.MsgNo, &e.Status, &e.GroupID, &e.Attempts, &created, &next); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = parseSQLTime(created)
+		e.NextAt = parseSQLTime(next)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// NextOutboxAt returns when the next outbox entry is due; ok is false when
+// the outbox is empty.
+func NextOutboxAt() (next time.Time, ok bool, err error) {
+	var s *string
+	if err := db.QueryRow("SELECT MIN(next_at) FROM outbox").Scan(&s); err != nil || s == nil {
+		return time.Time{}, false, err
+	}
+	return parseSQLTime(*s), true, nil
+}
+
+// UpdateOutbox saves an entry's status, attempts and next due time. Entries
+// in a final status, and unnumbered messages once sent, leave the outbox.
+func UpdateOutbox(e *OutboxEntry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE messages SET status = ? WHERE id = ? AND status IN (?, ?, ?)",
+		e.Status, e.MessageID, StatusQueued, StatusSent, StatusRetrying,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		// Answered meanwhile; SetSentMessageStatus already took it out of the outbox.
+		return err
+	}
+	switch {
+	case e.Status == StatusQueued, e.MsgNo != "" && (e.Status == StatusSent || e.Status == StatusRetrying):
+		_, err = tx.Exec("UPDATE outbox SET attempts = ?, next_at = ? WHERE id = ?", e.Attempts, e.NextAt.UTC().Format(sqlTime), e.ID)
+	default:
+		_, err = tx.Exec("DELETE FROM outbox WHERE id = ?", e.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// parseSQLTime reads a DATETIME column, which SQLite may hand back in either layout.
+func parseSQLTime(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	t, _ := time.Parse(sqlTime, s)
+	return t
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// Reasons a message for a user is refused.
+const (
+	ReasonBlocked   = "blocked"   // The sender is on the user's block list
+	ReasonSuspended = "suspended" // An admin suspended the user's account
+	ReasonQuota     = "quota"     // The user received more than the daily quota
+	ReasonDeleted   = "deleted"   // The account was deleted
+)
+
+// Policy actions for a refused message.
+const (
+	ActionDrop = "drop" // Discard without a word; the sender keeps retrying
+	ActionRej  = "rej"  // Discard and send a rej
+	ActionAck  = "ack"  // Discard but ack, so the sender stops retrying
+)
+
+// ValidPolicyAction reports whether a is one of the policy actions.
+func ValidPolicyAction(a string) bool {
+	return a == ActionDrop || a == ActionRej || a == ActionAck
+}
+
+// PolicyDecision records one message refused on a user's behalf.
+type PolicyDecision struct {
+	ID           int       `json:"id"`
+	UserCallsign string    `json:"user_callsign"` // Base callsign of the user it was for
+	FromCallsign string    `json:"from_callsign"`
+	ToCallsign   string    `json:"to_callsign"`
+	MsgNo        string    `json:"msg_no,omitempty"`
+	Message      string    `json:"message"`
+	Reason       string    `json:"reason"`
+	Action       string    `json:"action"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// LogPolicyDecision stores d.
+func LogPolicyDecision(d *PolicyDecision) error {
+	_, err := db.Exec(`
+		INSERT INTO policy_log (user_callsign, from_callsign, to_callsign, msg_no, message, reason, action, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.UserCallsign, d.FromCallsign, d.ToCallsign, d.MsgNo, d.Message, d.Reason, d.Action, d.CreatedAt.UTC().Format(sqlTime),
+	)
+	return err
+}
+
+// PrunePolicyDecisions deletes the decisions made before the given time and
+// returns how many went.
+func PrunePolicyDecisions(before time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM policy_log WHERE created_at < ?", before.UTC().Format(sqlTime))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ListPolicyDecisions returns the newest decisions made for the user (base
+// callsign), newest first. limit <= 0 returns all of them.
+func ListPolicyDecisions(callsign string, limit int) ([]*PolicyDecision, error) {
+	baseCallsign := strings.Split(strings.ToUpper(callsign), "-")[0]
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(`
+		SELECT id, user_callsign, from_callsign, to_callsign, msg_no, message, reason, action, created_at
+		FROM policy_log WHERE user_callsign = ? ORDER BY id DESC LIMIT ?`,
+		baseCallsign, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var decisions []*PolicyDecision
+	for rows.Next() {
+		var d PolicyDecision
+		var created string
+		if err := rows.Scan(&d.ID, &d.UserCallsign, &d.FromCallsign, &d.ToCallsign, &d.MsgNo, &d.Message, &d.Reason, &d.Action, &created); err != nil {
+			return nil, err
+		}
+		d.CreatedAt = parseSQLTime(created)
+		decisions = append(decisions, &d)
+	}
+	return decisions, rows.Err()
+}
+
+// SetSuspended suspends or reinstates a user's account.
+func SetSuspended(userID int, suspended bool) error {
+	var err error
+	if suspended {
+		_, err = db.Exec("INSERT OR IGNORE INTO suspended_users (user_id) VALUES (?)", userID)
+	} else {
+		_, err = db.Exec("DELETE FROM suspended_users WHERE user_id = ?", userID)
+	}
+	return err
+}
+
+// IsSuspended reports whether the user's account is suspended.
+func IsSuspended(userID int) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM suspended_users WHERE user_id = ?", userID).Scan(&count)
+	return count > 0, err
+}
+
+// IsDeletedAccount reports whether the base callsign belonged to an account that was deleted.
+func IsDeletedAccount(callsign string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM deleted_accounts WHERE callsign = ?", callsign).Scan(&count)
+	return count > 0, err
+}
+
+// CountMessagesReceivedSince counts the messages stored for the user (with
+// any SSID) since the given time.
+func CountMessagesReceivedSince(callsign string, since time.Time) (int, error) {
+	baseCallsign := strings.Split(callsign, "-")[0]
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM messages
+		WHERE (to_callsign = ? OR to_callsign LIKE ? || '-%') AND created_at >= ?`,
+		baseCallsign, baseCallsign, since.UTC().Format(sqlTime),
+	).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Ack policies: when the gateway acks messages received for a user.
+const (
+	AckAlways  = "always"  // Ack every numbered message
+	AckSession = "session" // Ack only while the user has a client attached
+	AckNever   = "never"   // Leave acking to the user's own station
+)
+
+// ValidAckPolicy reports whether p is one of the ack policies.
+func ValidAckPolicy(p string) bool {
+	return p == AckAlways || p == AckSession || p == AckNever
+}
+
+// UserSettings are a user's preferences for how the gateway handles their traffic.
+type UserSettings struct {
+	UserID        int    `json:"-"`
+	AckPolicy     string `json:"ack_policy"`
+	BlockedAction string `json:"blocked_action"` // Policy action for blocked senders; empty uses the gateway default
+	QuotaAction   string `json:"quota_action"`   // Policy action once over quota; empty uses the gateway default
+}
+
+// GetUserSettings returns a user's settings, or the defaults if they never changed any.
+func GetUserSettings(userID int) (*UserSettings, error) {
+	s := &UserSettings{UserID: userID, AckPolicy: AckAlways}
+	err := db.QueryRow(
+		"SELECT ack_policy, blocked_action, quota_action FROM user_settings WHERE user_id = ?", userID,
+	).Scan(&s.AckPolicy, &s.BlockedAction, &s.QuotaAction)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, nil
+	}
+	return s, err
+}
+
+// SaveUserSettings stores s for s.UserID.
+func SaveUserSettings(s *UserSettings) error {
+	_, err := db.Exec(`
+		INSERT INTO user_settings (user_id, ack_policy, blocked_action, quota_action) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			ack_policy = excluded.ack_policy,
+			blocked_action = excluded.blocked_action,
+			quota_action = excluded.quota_action`,
+		s.UserID, s.AckPolicy, s.BlockedAction, s.QuotaAction,
+	)
+	return err
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Station is what we know about a station heard on the feed.
+type Station struct {
+	Callsign     string    `json:"callsign"`
+	LastHeard    time.Time `json:"last_heard"`
+	HasPosition  bool      `json:"has_position"`
+	Lat          float64   `json:"lat,omitempty"`
+	Lon          float64   `json:"lon,omitempty"`
+	Symbol       string    `json:"symbol,omitempty"`      // Table then code, from the last position
+	PositionAt   time.Time `json:"position_at,omitempty"` // When the last position was heard
+	Status       string    `json:"status,omitempty"`      // Last status report
+	Capabilities string    `json:"capabilities,omitempty"`
+	Path         string    `json:"path,omitempty"`  // Path of the last packet, destination first
+	IGate        string    `json:"igate,omitempty"` // IGate that gated the last packet from RF
+	Packets      int       `json:"packets"`         // Packets heard since the station was first recorded
+}
+
+// SaveStations records a batch of sightings in one transaction. Fields a
+// sighting leaves empty (no position, status or capabilities) keep their
+// stored values; Packets is added to the stored count.
+func SaveStations(stations []*Station) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO stations (callsign, last_heard, lat, lon, symbol, position_at, status, capabilities, path, igate, packets)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(callsign) DO UPDATE SET
+			last_heard = MAX(last_heard, excluded.last_heard),
+			lat = COALESCE(excluded.lat, lat),
+			lon = COALESCE(excluded.lon, lon),
+			symbol = CASE WHEN excluded.position_at IS NULL THEN symbol ELSE excluded.symbol END,
+			position_at = COALESCE(excluded.position_at, position_at),
+			status = CASE WHEN excluded.status = '' THEN status ELSE excluded.status END,
+			capabilities = CASE WHEN excluded.capabilities = '' THEN capabilities ELSE excluded.capabilities END,
+			path = excluded.path,
+			igate = excluded.igate,
+			packets = packets + excluded.packets`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, s := range stations {
+		var lat, lon, positionAt interface{}
+		if s.HasPosition {
+			lat, lon, positionAt = s.Lat, s.Lon, s.PositionAt.UTC().Format(sqlTime)
+		}
+		if _, err := stmt.Exec(
+			strings.ToUpper(s.Callsign), s.LastHeard.UTC().Format(sqlTime), lat, lon, s.Symbol, positionAt,
+			s.Status, s.Capabilities, s.Path, s.IGate, s.Packets,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetStation returns what is stored about a station, or nil if it was never heard.
+func GetStation(callsign string) (*Station, error) {
+	var s Station
+	var lat, lon sql.NullFloat64
+	var lastHeard string
+	var positionAt sql.NullString
+	err := db.QueryRow(`
+		SELECT callsign, last_heard, lat, lon, symbol, position_at, status, capabilities, path, igate, packets
+		FROM stations WHERE callsign = ?`,
+		strings.ToUpper(strings.TrimSpace(callsign)),
+	).Scan(&s.Callsign, &lastHeard, &lat, &lon, &s.Symbol, &positionAt, &s.Status, &s.Capabilities, &s.Path, &s.IGate, &s.Packets)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.LastHeard = parseSQLTime(lastHeard)
+	if lat.Valid && lon.Valid && positionAt.Valid {
+		s.HasPosition = true
+		s.Lat, s.Lon = lat.Float64, lon.Float64
+		s.PositionAt = parseSQLTime(positionAt.String)
+	}
+	return &s, nil
+}
+
+// PruneStations deletes stations not heard since before and returns how many went.
+func PruneStations(before time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM stations WHERE last_heard < ?", before.UTC().Format(sqlTime))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -7,10 +7,10 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 
 	"aprsmessenger-gateway/internal/aprs"
+	"aprsmessenger-gateway/internal/config"
 	"aprsmessenger-gateway/internal/db"
 	"aprsmessenger-gateway/internal/models"
 
@@ -18,67 +18,32 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// --- BEGIN MESSAGE STATE TRACKING STRUCTS ---
-
-// MessageState holds the state for a message in a conversation.
-type MessageState struct {
-	LastSentMsgId     string // The last message ID sent (by us)
-	LastReceivedMsgId string // The last message ID received (from their side)
-	SentMsgRetryCount map[string]int   // messageId -> retry count (for received duplicates)
-	Mutex             sync.Mutex
-}
-
-// ConversationState tracks state for each user/conversation.
-var conversationStates = struct {
-	sync.RWMutex
-	m map[string]map[string]*MessageState // myCallsign -> otherCallsign -> *MessageState
-}{m: make(map[string]map[string]*MessageState)}
-
-// Utility for getting message state for a conversation.
-func getOrCreateMessageState(myCall, otherCall string) *MessageState {
-	conversationStates.Lock()
-	defer conversationStates.Unlock()
-	if conversationStates.m[myCall] == nil {
-		conversationStates.m[myCall] = make(map[string]*MessageState)
-	}
-	if conversationStates.m[myCall][otherCall] == nil {
-		conversationStates.m[myCall][otherCall] = &MessageState{
-			SentMsgRetryCount: make(map[string]int),
-		}
-	}
-	return conversationStates.m[myCall][otherCall]
-}
-
-// Utility for generating the next message ID (rolling 2 digits, 00-99).
-func nextMessageId(last string) string {
-	if last == "" {
-		return "01"
-	}
-	var n int
-	fmt.Sscanf(last, "%02d", &n)
-	n = (n + 1) % 100
-	return fmt.Sprintf("%02d", n)
-}
-
-// --- END MESSAGE STATE TRACKING STRUCTS ---
-
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
 // WSRequest defines the structure for all incoming websocket actions.
 type WSRequest struct {
-	Action          string `json:"action"`
-	Callsign        string `json:"callsign,omitempty"`
-	Password        string `json:"password,omitempty"`
-	Passcode        string `json:"passcode,omitempty"`
-	Token           string `json:"token,omitempty"` // For QR code login
-	ToCallsign      string `json:"to_callsign,omitempty"`
-	Message         string `json:"message,omitempty"`
-	FromCallsign    string `json:"from_callsign,omitempty"`
-	CallsignToBlock string `json:"callsign_to_block,omitempty"`
+	Action          string   `json:"action"`
+	Callsign        string   `json:"callsign,omitempty"`
+	Password        string   `json:"password,omitempty"`
+	Passcode        string   `json:"passcode,omitempty"`
+	Token           string   `json:"token,omitempty"` // For QR code login
+	ToCallsign      string   `json:"to_callsign,omitempty"`
+	Message         string   `json:"message,omitempty"`
+	FromCallsign    string   `json:"from_callsign,omitempty"`
+	CallsignToBlock string   `json:"callsign_to_block,omitempty"`
+	AckPolicy       string   `json:"ack_policy,omitempty"`     // For update_settings
+	BlockedAction   string   `json:"blocked_action,omitempty"` // For update_settings; "default" clears it
+	QuotaAction     string   `json:"quota_action,omitempty"`   // For update_settings; "default" clears it
+	Lat             *float64 `json:"lat,omitempty"`            // For list_objects
+	Lon             *float64 `json:"lon,omitempty"`            // For list_objects
+	Radius          float64  `json:"radius,omitempty"`         // For list_objects, in km; defaults to defaultObjectRadius
 }
 
+// defaultObjectRadius is the list_objects radius, in km, when none is given.
+const defaultObjectRadius = 50
+
 // WSResponse is a flexible map for sending responses back to the client.
 type WSResponse map[string]interface{}
 
@@ -99,16 +64,9 @@ func sendErrorResponse(conn *websocket.Conn, errMsg string) {
 	_ = conn.WriteJSON(response)
 }
 
-// isUserAdmin checks if a given callsign is in the hardcoded admin list.
+// isUserAdmin checks if a given callsign is in the configured admin list.
 func isUserAdmin(callsign string) bool {
-	baseCallsign := getBaseCallsign(callsign)
-	// In a real app, this would be a database role check.
-	adminCallsigns := map[string]struct{}{
-		"K8SDR": {},
-		"AD8NT": {},
-	}
-	_, isAdmin := adminCallsigns[baseCallsign]
-	return isAdmin
+	return config.Get().IsAdmin(getBaseCallsign(callsign))
 }
 
 // HandleWebSocket is the main entry point for websocket connections.
@@ -199,14 +157,30 @@ authenticated:
 			handleDeleteConversation(conn, user.Callsign, req)
 		case "block_callsign":
 			handleBlockCallsign(conn, user.ID, req)
+		case "get_settings":
+			handleGetSettings(conn, user.ID)
+		case "update_settings":
+			handleUpdateSettings(conn, user.ID, req)
+		case "get_policy_log":
+			handleGetPolicyLog(conn, user.Callsign)
+		case "get_station":
+			handleGetStation(conn, req)
+		case "list_objects":
+			handleListObjects(conn, req)
 		case "request_data_export":
 			handleRequestDataExport(conn, user.Callsign)
 		case "delete_account":
 			handleDeleteAccount(conn, user, req)
 		case "get_admin_stats":
 			handleGetAdminStats(conn, user)
+		case "get_gateway_status":
+			handleGetGatewayStatus(conn)
 		case "admin_broadcast":
 			handleAdminBroadcast(conn, user, req)
+		case "suspend_account":
+			handleSetSuspended(conn, user, req, true)
+		case "unsuspend_account":
+			handleSetSuspended(conn, user, req, false)
 		default:
 			sendErrorResponse(conn, "Unknown action.")
 		}
@@ -225,50 +199,54 @@ func handleSendMessage(conn *websocket.Conn, fromCallsign, baseUserCallsign stri
 		return
 	}
 
-	// Stateful message ID and REPLY-ACK tracking
-	state := getOrCreateMessageState(baseUserCallsign, toCallsign)
-	state.Mutex.Lock()
-	nextMsgId := nextMessageId(state.LastSentMsgId)
-	lastReceivedId := state.LastReceivedMsgId
-	state.LastSentMsgId = nextMsgId
-	state.Mutex.Unlock()
-
-	// Compose APRS payload: MSG{MM}AA (text with {msgId}ackId)
-	aprsPayload := req.Message
-	if lastReceivedId != "" {
-		aprsPayload = fmt.Sprintf("%s{%s}%s", req.Message, nextMsgId, lastReceivedId)
-	} else {
-		aprsPayload = fmt.Sprintf("%s{%s}", req.Message, nextMsgId)
+	// Only printable ASCII goes on the air; transliterate before measuring.
+	text := aprs.EncodeText(req.Message)
+	if text == "" {
+		sendErrorResponse(conn, "Message cannot be empty")
+		return
 	}
 
-	log.Printf("[WS] Queuing message from %s to %s with id %s, REPLY-ACK=%s", fromCallsign, toCallsign, nextMsgId, lastReceivedId)
-	err := aprs.GetAPRSManager().SendMessage(fromCallsign, toCallsign, aprsPayload)
-
+	// Long text goes out as numbered segments, each with its own message number.
+	segments, err := aprs.SplitMessage(text)
 	if err != nil {
 		sendErrorResponse(conn, "Failed to send message: "+err.Error())
-		log.Printf("[APRS] Error sending message from %s: %v", fromCallsign, err)
-	} else {
-		// Store the sent message for history.
-		if storeErr := db.StoreMessage(toCallsign, fromCallsign, aprsPayload); storeErr != nil {
-			log.Printf("[DB] Failed to store sent message for history from %s: %v", fromCallsign, storeErr)
+		return
+	}
+	payloads := make([]string, len(segments))
+	msgIds := make([]string, len(segments))
+	for i, text := range segments {
+		// Number the message for this conversation, with REPLY-ACK if the contact supports it.
+		payloads[i], msgIds[i], err = aprs.ComposeMessage(baseUserCallsign, toCallsign, text)
+		if err != nil {
+			sendErrorResponse(conn, "Failed to send message: "+err.Error())
+			log.Printf("[APRS] Error numbering message from %s: %v", fromCallsign, err)
+			return
 		}
+	}
 
-		// Echo back to sender: status=sending (immediately after sending to network)
-		echo := map[string]interface{}{
-			"type":               "message_status_update",
-			"contact_groupingId": toCallsign,
-			"messageId":          nextMsgId,
-			"status":             "sent", // Could be "sending" if you want an intermediate step
-			"retryCount":         0,
-			"time":               time.Now().Format(time.RFC3339),
-		}
-		_ = conn.WriteJSON(echo)
+	log.Printf("[WS] Queuing message from %s to %s: %q", fromCallsign, toCallsign, payloads)
+	// The outbox stores it and pushes each status change, from "queued" on.
+	if err := aprs.GetAPRSManager().QueueSegments(fromCallsign, toCallsign, payloads, msgIds); err != nil {
+		sendErrorResponse(conn, "Failed to send message: "+err.Error())
+		log.Printf("[APRS] Error queuing message from %s: %v", fromCallsign, err)
+		return
+	}
 
-		// Broadcast the sent message to the user's other clients for synchronization.
-		if session := aprs.GetSessionsManager().GetSession(baseUserCallsign); session != nil {
-			echoRoute := []string{"APRS", "K8SDR-10"}
-			session.BroadcastMessage(fromCallsign, toCallsign, aprsPayload, echoRoute, conn)
-		}
+	// Tell the sender exactly what goes over the air, so their copy matches history.
+	_ = conn.WriteJSON(WSResponse{
+		"type":               "message_transmitted",
+		"contact_groupingId": toCallsign,
+		"messageId":          msgIds[0], // The first segment's, for older clients
+		"msgIds":             msgIds,
+		"segments":           len(segments),
+		"message":            text,
+		"payloads":           payloads,
+		"changed":            text != req.Message,
+	})
+
+	// Broadcast the sent message to the user's other clients for synchronization.
+	if session := aprs.GetSessionsManager().GetSession(baseUserCallsign); session != nil {
+		session.BroadcastMessage(fromCallsign, toCallsign, text, aprs.ParsePath(config.Get().EchoRoute).Travelled(), conn)
 	}
 }
 
@@ -349,6 +327,8 @@ func handleCreateAccount(conn *websocket.Conn, req WSRequest) {
 		sendErrorResponse(conn, "Server error: could not create user")
 		return
 	}
+	// Widen the APRS-IS filter so traffic for the new user reaches us.
+	aprs.GetAPRSManager().RefreshFilter()
 	sendSuccessResponse(conn, nil)
 	log.Printf("Account created for callsign: %s", callsign)
 }
@@ -385,6 +365,103 @@ func handleBlockCallsign(conn *websocket.Conn, userID int, req WSRequest) {
 	}
 }
 
+func handleGetSettings(conn *websocket.Conn, userID int) {
+	settings, err := db.GetUserSettings(userID)
+	if err != nil {
+		log.Printf("[DB] Error loading settings for user %d: %v", userID, err)
+		sendErrorResponse(conn, "Failed to load settings.")
+		return
+	}
+	_ = conn.WriteJSON(WSResponse{"type": "settings", "settings": settings})
+}
+
+// handleUpdateSettings changes the settings given in the request and leaves the rest.
+func handleUpdateSettings(conn *websocket.Conn, userID int, req WSRequest) {
+	settings, err := db.GetUserSettings(userID)
+	if err != nil {
+		log.Printf("[DB] Error loading settings for user %d: %v", userID, err)
+		sendErrorResponse(conn, "Failed to load settings.")
+		return
+	}
+	if req.AckPolicy != "" {
+		if !db.ValidAckPolicy(req.AckPolicy) {
+			sendErrorResponse(conn, "Ack policy must be 'always', 'session' or 'never'.")
+			return
+		}
+		settings.AckPolicy = req.AckPolicy
+	}
+	for _, a := range []struct {
+		requested string
+		setting   *string
+	}{{req.BlockedAction, &settings.BlockedAction}, {req.QuotaAction, &settings.QuotaAction}} {
+		switch {
+		case a.requested == "":
+		case a.requested == "default":
+			*a.setting = ""
+		case db.ValidPolicyAction(a.requested):
+			*a.setting = a.requested
+		default:
+			sendErrorResponse(conn, "Policy action must be 'drop', 'rej', 'ack' or 'default'.")
+			return
+		}
+	}
+	if err := db.SaveUserSettings(settings); err != nil {
+		log.Printf("[DB] Error saving settings for user %d: %v", userID, err)
+		sendErrorResponse(conn, "Failed to save settings.")
+		return
+	}
+	log.Printf("[WS] User %d updated settings: ack policy %s, blocked %q, quota %q",
+		userID, settings.AckPolicy, settings.BlockedAction, settings.QuotaAction)
+	_ = conn.WriteJSON(WSResponse{"type": "settings", "settings": settings})
+}
+
+// handleGetPolicyLog sends the messages the gateway refused on the user's behalf, newest first.
+func handleGetPolicyLog(conn *websocket.Conn, callsign string) {
+	decisions, err := db.ListPolicyDecisions(callsign, 100)
+	if err != nil {
+		log.Printf("[DB] Error loading policy log for %s: %v", callsign, err)
+		sendErrorResponse(conn, "Failed to load policy log.")
+		return
+	}
+	_ = conn.WriteJSON(WSResponse{"type": "policy_log", "decisions": decisions})
+}
+
+// handleGetStation returns what the gateway has heard from a station; station
+// is null if it has not been heard.
+func handleGetStation(conn *websocket.Conn, req WSRequest) {
+	callsign := strings.ToUpper(strings.TrimSpace(req.Callsign))
+	if callsign == "" {
+		sendErrorResponse(conn, "Callsign is required.")
+		return
+	}
+	station, err := aprs.GetAPRSManager().Station(callsign)
+	if err != nil {
+		log.Printf("[DB] Error loading station %s: %v", callsign, err)
+		sendErrorResponse(conn, "Failed to load station.")
+		return
+	}
+	_ = conn.WriteJSON(WSResponse{"type": "station", "callsign": callsign, "station": station})
+}
+
+// handleListObjects returns the live objects and items near a point, nearest first.
+func handleListObjects(conn *websocket.Conn, req WSRequest) {
+	if req.Lat == nil || req.Lon == nil || *req.Lat < -90 || *req.Lat > 90 || *req.Lon < -180 || *req.Lon > 180 {
+		sendErrorResponse(conn, "A valid lat and lon are required.")
+		return
+	}
+	radius := req.Radius
+	if radius <= 0 {
+		radius = defaultObjectRadius
+	}
+	objects, err := aprs.GetAPRSManager().Objects(*req.Lat, *req.Lon, radius)
+	if err != nil {
+		log.Printf("[DB] Error listing objects: %v", err)
+		sendErrorResponse(conn, "Failed to list objects.")
+		return
+	}
+	_ = conn.WriteJSON(WSResponse{"type": "objects", "lat": *req.Lat, "lon": *req.Lon, "radius": radius, "objects": objects})
+}
+
 func handleRequestDataExport(conn *websocket.Conn, callsign string) {
 	data, err := db.ExportDataForUser(callsign)
 	if err != nil {
@@ -406,6 +483,7 @@ func handleDeleteAccount(conn *websocket.Conn, user *models.User, req WSRequest)
 		return
 	}
 	log.Printf("[WS] DELETED ACCOUNT for user %s (ID: %d)", user.Callsign, user.ID)
+	aprs.GetAPRSManager().RefreshFilter()
 	_ = conn.WriteJSON(WSResponse{"type": "account_deleted", "success": true})
 }
 
@@ -433,9 +511,14 @@ func handleGetAdminStats(conn *websocket.Conn, user *models.User) {
 	// Don't send password hashes to the client, even the admin.
 	clientUsers := make([]map[string]interface{}, len(users))
 	for i, u := range users {
+		suspended, err := db.IsSuspended(u.ID)
+		if err != nil {
+			log.Printf("[WS ADMIN] Failed to check suspension for %s: %v", u.Callsign, err)
+		}
 		clientUsers[i] = map[string]interface{}{
-			"id":       u.ID,
-			"callsign": u.Callsign,
+			"id":        u.ID,
+			"callsign":  u.Callsign,
+			"suspended": suspended,
 		}
 	}
 
@@ -445,10 +528,39 @@ func handleGetAdminStats(conn *websocket.Conn, user *models.User) {
 		"users":     clientUsers,
 		"stats":     stats,
 		"userCount": len(users),
+		"gateway":   aprs.GetAPRSManager().Status(),
 	}
 	_ = conn.WriteJSON(response)
 }
 
+// handleGetGatewayStatus reports which APRS-IS server the gateway is on and why.
+func handleGetGatewayStatus(conn *websocket.Conn) {
+	_ = conn.WriteJSON(WSResponse{
+		"type":   "gateway_status",
+		"status": aprs.GetAPRSManager().Status(),
+	})
+}
+
+// handleSetSuspended suspends or reinstates the account named in req.Callsign.
+func handleSetSuspended(conn *websocket.Conn, user *models.User, req WSRequest, suspended bool) {
+	if !isUserAdmin(user.Callsign) {
+		sendErrorResponse(conn, "Access denied.")
+		return
+	}
+	target, err := db.GetUserByCallsign(getBaseCallsign(cleanCallsign(req.Callsign)))
+	if err != nil || target == nil {
+		sendErrorResponse(conn, "User not found.")
+		return
+	}
+	if err := db.SetSuspended(target.ID, suspended); err != nil {
+		log.Printf("[WS ADMIN] Failed to set suspension for %s: %v", target.Callsign, err)
+		sendErrorResponse(conn, "Failed to update account.")
+		return
+	}
+	log.Printf("[WS ADMIN] %s set suspended=%v for %s", user.Callsign, suspended, target.Callsign)
+	_ = conn.WriteJSON(WSResponse{"type": "account_suspended", "callsign": target.Callsign, "suspended": suspended})
+}
+
 // handleAdminBroadcast sends a system-wide message from an admin.
 func handleAdminBroadcast(conn *websocket.Conn, user *models.User, req WSRequest) {
 	if !isUserAdmin(user.Callsign) {
@@ -509,4 +621,4 @@ func validCallsign(callsign string) bool {
 	// A simple regex for callsign with optional SSID
 	re := regexp.MustCompile(`^[A-Z0-9]{1,6}(-[0-9]{1,2})?$`)
 	return re.MatchString(callsign)
-}
\ No newline at end of file
+}
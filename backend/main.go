@@ -1,34 +1,90 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"aprsmessenger-gateway/internal/aprs"
+	"aprsmessenger-gateway/internal/config"
 	"aprsmessenger-gateway/internal/db"
 	"aprsmessenger-gateway/internal/ws"
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv(config.EnvConfigFile), "path to JSON config file")
+	listenAddr := flag.String("listen", "", "HTTP listen address (e.g. :8585)")
+	dbPath := flag.String("db", "", "path to the SQLite database")
+	servers := flag.String("aprsis-servers", "", "comma-separated APRS-IS servers (host:port)")
+	callsign := flag.String("callsign", "", "gateway login callsign")
+	passcode := flag.String("passcode", "", "gateway APRS-IS passcode")
+	admins := flag.String("admins", "", "comma-separated admin callsigns")
+	flag.Parse()
+
+	// Flags override the file and environment, and are re-applied on every reload.
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	overrides := func(cfg *config.Config) {
+		if set["listen"] {
+			cfg.ListenAddr = *listenAddr
+		}
+		if set["db"] {
+			cfg.DBPath = *dbPath
+		}
+		if set["aprsis-servers"] {
+			cfg.APRSIS.Servers = config.SplitList(*servers)
+		}
+		if set["callsign"] {
+			cfg.Gateway.Callsign = *callsign
+		}
+		if set["passcode"] {
+			cfg.Gateway.Passcode = *passcode
+		}
+		if set["admins"] {
+			cfg.Admins = config.SplitList(*admins)
+		}
+	}
+	if err := config.Init(*configPath, overrides); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg := config.Get()
+
 	// Ensure data directory exists
-	dataDir := filepath.Join(".", "data")
-	_ = os.MkdirAll(dataDir, 0755)
+	_ = os.MkdirAll(filepath.Dir(cfg.DBPath), 0755)
 
 	// Open DB connection
-	dbPath := filepath.Join(dataDir, "users.db")
-	err := db.Init(dbPath)
+	err := db.Init(cfg.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to init DB: %v", err)
 	}
 	defer db.Close()
 
+	// The listen address and DB are bound once; everything else is picked up live.
+	config.OnReload(func(old, new *config.Config) {
+		if old.ListenAddr != new.ListenAddr || old.DBPath != new.DBPath {
+			log.Printf("[CONFIG] Listen address and DB path changes take effect after a restart")
+		}
+	})
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			log.Printf("[CONFIG] SIGHUP received, reloading configuration")
+			if err := config.Reload(); err != nil {
+				log.Printf("[CONFIG] Reload failed, keeping previous configuration: %v", err)
+			}
+		}
+	}()
+
 	// Start the global APRS Manager. It now handles both listening and sending.
 	aprs.GetAPRSManager().Start()
 
 	http.HandleFunc("/ws", ws.HandleWebSocket)
 
-	log.Println("Server started on :8585")
-	log.Fatal(http.ListenAndServe(":8585", nil))
-}
\ No newline at end of file
+	log.Printf("Server started on %s", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, nil))
+}